@@ -0,0 +1,224 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/hscells/groove/combinator"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/trecresults"
+	"sync"
+)
+
+// flightCall is a computation that is in progress, or has completed.
+type flightCall struct {
+	wg  sync.WaitGroup
+	v   interface{}
+	err error
+}
+
+// flight deduplicates concurrent computations: while a computation for a key is in progress, other requests for
+// the same key wait for, and share, its result.
+type flight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+func newFlight() *flight {
+	return &flight{calls: make(map[string]*flightCall)}
+}
+
+// do computes the value for a key, or waits for the computation that is already in progress for the key.
+func (f *flight) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	if f == nil {
+		return fn()
+	}
+	f.mu.Lock()
+	if c, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		c.wg.Wait()
+		return c.v, c.err
+	}
+	c := new(flightCall)
+	c.wg.Add(1)
+	f.calls[key] = c
+	f.mu.Unlock()
+
+	c.v, c.err = fn()
+	c.wg.Done()
+
+	f.mu.Lock()
+	delete(f.calls, key)
+	f.mu.Unlock()
+	return c.v, c.err
+}
+
+// lockedMeasurementCache makes a cache safe to use concurrently.
+type lockedMeasurementCache struct {
+	mu    sync.Mutex
+	cache MeasurementCacher
+}
+
+func (l *lockedMeasurementCache) Read(key string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Read(key)
+}
+
+func (l *lockedMeasurementCache) Write(key string, val []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Write(key, val)
+}
+
+// run calls fn for each i in [0, n), with at most the number of workers of the executor running at once. No further
+// calls are made after one fails; the calls in progress are waited for, and the error of the lowest i that failed is
+// returned.
+func (m MeasurementExecutor) run(n int, fn func(i int) error) error {
+	if m.workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, n)
+	sem := make(chan struct{}, m.workers)
+	failed := make(chan struct{})
+	var once sync.Once
+	var wg sync.WaitGroup
+schedule:
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-failed:
+			break schedule
+		}
+		// A worker may have failed while waiting for the semaphore.
+		select {
+		case <-failed:
+			<-sem
+			break schedule
+		default:
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if errs[i] = fn(i); errs[i] != nil {
+				once.Do(func() {
+					close(failed)
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sharedRetrieval is a statistics source that executes each query once, so that measurements of the same query (e.g.
+// post-retrieval predictors) share the retrieved documents.
+type sharedRetrieval struct {
+	stats.StatisticsSource
+	flight  *flight
+	mu      sync.Mutex
+	results map[string]trecresults.ResultList
+	// pending is the number of measurements that have yet to be computed with the source.
+	pending int
+}
+
+func newSharedRetrieval(ss stats.StatisticsSource) stats.StatisticsSource {
+	if ss == nil {
+		return nil
+	}
+	return &sharedRetrieval{
+		StatisticsSource: ss,
+		flight:           newFlight(),
+		results:          make(map[string]trecresults.ResultList),
+	}
+}
+
+// sharedRetrievals are the statistics sources that queries are measured with: queries with the same representation
+// share a source, so that they share the retrieved documents. Each query is measured with the number of measurements
+// specified, after each of which the source must be released (see release).
+func sharedRetrievals(queries []pipeline.Query, ss stats.StatisticsSource, measurements int) []stats.StatisticsSource {
+	sources := make([]stats.StatisticsSource, len(queries))
+	shared := make(map[string]stats.StatisticsSource)
+	for i, query := range queries {
+		key := combinator.CanonicalString(query.Query)
+		if _, ok := shared[key]; !ok {
+			shared[key] = newSharedRetrieval(ss)
+		}
+		sources[i] = shared[key]
+		if s, ok := sources[i].(*sharedRetrieval); ok {
+			s.pending += measurements
+		}
+	}
+	return sources
+}
+
+// release records that a measurement has been computed with a source. Once every measurement of the queries that
+// share the source has been computed, the retrieved documents are released.
+func release(ss stats.StatisticsSource) {
+	s, ok := ss.(*sharedRetrieval)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending--
+	if s.pending <= 0 {
+		s.results = make(map[string]trecresults.ResultList)
+	}
+}
+
+// Unwrap is the statistics source that queries are executed by (see stats.Unwrap).
+func (s *sharedRetrieval) Unwrap() stats.StatisticsSource {
+	return s.StatisticsSource
+}
+
+// Execute executes a query, or returns the results of the query if it has already been executed with the same
+// options. Since the results are shared, they must not be modified.
+func (s *sharedRetrieval) Execute(query pipeline.Query, options stats.SearchOptions) (trecresults.ResultList, error) {
+	q, err := query.Restricted()
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s/%d/%s", combinator.CanonicalString(q), options.Size, options.RunName)
+
+	s.mu.Lock()
+	results, ok := s.results[key]
+	s.mu.Unlock()
+	if ok {
+		return results, nil
+	}
+
+	v, err := s.flight.do(key, func() (interface{}, error) {
+		s.mu.Lock()
+		results, ok := s.results[key]
+		s.mu.Unlock()
+		if ok {
+			return results, nil
+		}
+		results, err := s.StatisticsSource.Execute(query, options)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.results[key] = results
+		s.mu.Unlock()
+		return results, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(trecresults.ResultList), nil
+}
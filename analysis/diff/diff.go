@@ -0,0 +1,455 @@
+// Package diff reports the structural changes between two queries, such as keywords that were added or removed,
+// and operators or fields that were changed. This makes the rewrites performed by query chains and formulators
+// auditable.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/combinator"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/transmute"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeType is the type of change made to a query.
+type ChangeType string
+
+const (
+	KeywordAdded     ChangeType = "keyword-added"
+	KeywordRemoved   ChangeType = "keyword-removed"
+	ClauseAdded      ChangeType = "clause-added"
+	ClauseRemoved    ChangeType = "clause-removed"
+	OperatorChanged  ChangeType = "operator-changed"
+	FieldsChanged    ChangeType = "fields-changed"
+	AdjacencyChanged ChangeType = "adjacency-changed"
+	ExplosionChanged ChangeType = "explosion-changed"
+)
+
+// Delta is the difference in the documents retrieved by a construct before and after a change.
+type Delta struct {
+	// Before and After are the number of documents retrieved before and after the change.
+	Before int `json:"before"`
+	After  int `json:"after"`
+	// Gained are the documents retrieved after the change that were not retrieved before it, and Lost are the
+	// documents retrieved before the change that are not retrieved after it.
+	Gained int `json:"gained"`
+	Lost   int `json:"lost"`
+}
+
+func (d Delta) String() string {
+	return fmt.Sprintf("%d -> %d documents (+%d, -%d)", d.Before, d.After, d.Gained, d.Lost)
+}
+
+// Change is a single change made to a query.
+type Change struct {
+	Type ChangeType
+	// Path is the position of the changed construct in the query after the change (or before the change, for
+	// constructs that were removed), as the indices of each clause from the root of the query.
+	Path []int
+	// Before and After are the construct before and after the change; Before is nil for constructs that were
+	// added, and After is nil for constructs that were removed.
+	Before cqr.CommonQueryRepresentation
+	After  cqr.CommonQueryRepresentation
+	// Delta is the difference in the documents retrieved by the construct, when it has been computed (see
+	// Diff.Retrieval).
+	Delta *Delta
+}
+
+// Diff is the changes made to a query.
+type Diff struct {
+	Before  cqr.CommonQueryRepresentation
+	After   cqr.CommonQueryRepresentation
+	Changes []Change
+	// Delta is the difference in the documents retrieved by the whole query, when it has been computed.
+	Delta *Delta
+}
+
+// format formats a construct of a query in the PubMed syntax, since it is the most readable.
+func format(q cqr.CommonQueryRepresentation) string {
+	if q == nil {
+		return ""
+	}
+	s, err := transmute.CompileCqr2PubMed(q)
+	if err != nil || len(s) == 0 {
+		return q.String()
+	}
+	return s
+}
+
+func formatPath(path []int) string {
+	if len(path) == 0 {
+		return "query"
+	}
+	p := make([]string, len(path))
+	for i, idx := range path {
+		p[i] = strconv.Itoa(idx + 1)
+	}
+	return strings.Join(p, ".")
+}
+
+// Description describes the change in words.
+func (c Change) Description() string {
+	switch c.Type {
+	case KeywordAdded, ClauseAdded:
+		return fmt.Sprintf("added %s", format(c.After))
+	case KeywordRemoved, ClauseRemoved:
+		return fmt.Sprintf("removed %s", format(c.Before))
+	case OperatorChanged, AdjacencyChanged:
+		return fmt.Sprintf("changed operator %s to %s", operator(c.Before), operator(c.After))
+	case FieldsChanged:
+		return fmt.Sprintf("changed fields of %s from %s to %s", term(c.Before), strings.Join(keywordFields(c.Before), ","), strings.Join(keywordFields(c.After), ","))
+	case ExplosionChanged:
+		if exploded(c.After) {
+			return fmt.Sprintf("exploded %s", term(c.After))
+		}
+		return fmt.Sprintf("stopped exploding %s", term(c.After))
+	}
+	return string(c.Type)
+}
+
+func (c Change) String() string {
+	symbol := "~"
+	switch c.Type {
+	case KeywordAdded, ClauseAdded:
+		symbol = "+"
+	case KeywordRemoved, ClauseRemoved:
+		symbol = "-"
+	}
+	s := fmt.Sprintf("%s %s: %s", symbol, formatPath(c.Path), c.Description())
+	if c.Delta != nil {
+		s += fmt.Sprintf(" [%s]", c.Delta)
+	}
+	return s
+}
+
+// MarshalJSON formats the constructs of a change in the PubMed syntax.
+func (c Change) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type        ChangeType `json:"type"`
+		Path        string     `json:"path"`
+		Description string     `json:"description"`
+		Before      string     `json:"before,omitempty"`
+		After       string     `json:"after,omitempty"`
+		Delta       *Delta     `json:"delta,omitempty"`
+	}{c.Type, formatPath(c.Path), c.Description(), format(c.Before), format(c.After), c.Delta})
+}
+
+// String formats the changes as readable text, one change per line.
+func (d Diff) String() string {
+	if len(d.Changes) == 0 {
+		return "no changes\n"
+	}
+	var b bytes.Buffer
+	for _, c := range d.Changes {
+		b.WriteString(c.String())
+		b.WriteString("\n")
+	}
+	if d.Delta != nil {
+		b.WriteString(fmt.Sprintf("query: %s\n", d.Delta))
+	}
+	return b.String()
+}
+
+// MarshalJSON formats the queries of a diff in the PubMed syntax.
+func (d Diff) MarshalJSON() ([]byte, error) {
+	changes := d.Changes
+	if changes == nil {
+		changes = []Change{}
+	}
+	return json.Marshal(struct {
+		Before  string   `json:"before"`
+		After   string   `json:"after"`
+		Changes []Change `json:"changes"`
+		Delta   *Delta   `json:"delta,omitempty"`
+	}{format(d.Before), format(d.After), changes, d.Delta})
+}
+
+func operator(q cqr.CommonQueryRepresentation) string {
+	if b, ok := q.(cqr.BooleanQuery); ok {
+		return strings.ToLower(strings.TrimSpace(b.Operator))
+	}
+	return ""
+}
+
+func isAdjacency(q cqr.CommonQueryRepresentation) bool {
+	return strings.HasPrefix(operator(q), "adj")
+}
+
+func term(q cqr.CommonQueryRepresentation) string {
+	if k, ok := q.(cqr.Keyword); ok {
+		return strings.ToLower(strings.TrimSpace(k.QueryString))
+	}
+	return ""
+}
+
+func keywordFields(q cqr.CommonQueryRepresentation) []string {
+	k, ok := q.(cqr.Keyword)
+	if !ok {
+		return nil
+	}
+	f := make([]string, len(k.Fields))
+	copy(f, k.Fields)
+	sort.Strings(f)
+	return f
+}
+
+func exploded(q cqr.CommonQueryRepresentation) bool {
+	k, ok := q.(cqr.Keyword)
+	if !ok {
+		return false
+	}
+	exp, ok := k.Options[cqr.ExplodedString].(bool)
+	return ok && exp
+}
+
+// similarity is the proportion of keywords two clauses have in common.
+func similarity(a, b cqr.CommonQueryRepresentation) float64 {
+	terms := make(map[string]bool)
+	for _, k := range analysis.QueryKeywords(a) {
+		terms[term(k)] = true
+	}
+	union := len(terms)
+	common := 0
+	seen := make(map[string]bool)
+	for _, k := range analysis.QueryKeywords(b) {
+		t := term(k)
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		if terms[t] {
+			common++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
+
+// differ accumulates the changes between two queries.
+type differ struct {
+	changes []Change
+}
+
+func appendPath(path []int, i int) []int {
+	p := make([]int, len(path)+1)
+	copy(p, path)
+	p[len(path)] = i
+	return p
+}
+
+func (d *differ) added(q cqr.CommonQueryRepresentation, path []int) {
+	t := ClauseAdded
+	if _, ok := q.(cqr.Keyword); ok {
+		t = KeywordAdded
+	}
+	d.changes = append(d.changes, Change{Type: t, Path: path, After: q})
+}
+
+func (d *differ) removed(q cqr.CommonQueryRepresentation, path []int) {
+	t := ClauseRemoved
+	if _, ok := q.(cqr.Keyword); ok {
+		t = KeywordRemoved
+	}
+	d.changes = append(d.changes, Change{Type: t, Path: path, Before: q})
+}
+
+// diff compares two constructs that are in the same position of each query.
+func (d *differ) diff(before, after cqr.CommonQueryRepresentation, beforePath, afterPath []int) {
+	switch b := before.(type) {
+	case cqr.Keyword:
+		a, ok := after.(cqr.Keyword)
+		if !ok || term(a) != term(b) {
+			d.removed(before, beforePath)
+			d.added(after, afterPath)
+			return
+		}
+		if strings.Join(keywordFields(b), ",") != strings.Join(keywordFields(a), ",") {
+			d.changes = append(d.changes, Change{Type: FieldsChanged, Path: afterPath, Before: b, After: a})
+		}
+		if exploded(b) != exploded(a) {
+			d.changes = append(d.changes, Change{Type: ExplosionChanged, Path: afterPath, Before: b, After: a})
+		}
+	case cqr.BooleanQuery:
+		a, ok := after.(cqr.BooleanQuery)
+		if !ok {
+			d.removed(before, beforePath)
+			d.added(after, afterPath)
+			return
+		}
+		if operator(b) != operator(a) {
+			t := OperatorChanged
+			if isAdjacency(b) && isAdjacency(a) {
+				t = AdjacencyChanged
+			}
+			d.changes = append(d.changes, Change{Type: t, Path: afterPath, Before: b, After: a})
+		}
+		d.children(b.Children, a.Children, beforePath, afterPath)
+	}
+}
+
+// children matches the children of two clauses to one another, and compares each matched pair. Children are matched
+// first if they are equivalent (see combinator.Equivalent), then if they are keywords with the same term, then by
+// the keywords they have in common. Children that cannot be matched were added or removed.
+func (d *differ) children(before, after []cqr.CommonQueryRepresentation, beforePath, afterPath []int) {
+	match := make([]int, len(before))
+	matched := make([]bool, len(after))
+	for i := range match {
+		match[i] = -1
+	}
+
+	pair := func(equal func(b, a cqr.CommonQueryRepresentation) bool) {
+		for i, b := range before {
+			if match[i] >= 0 {
+				continue
+			}
+			for j, a := range after {
+				if !matched[j] && equal(b, a) {
+					match[i] = j
+					matched[j] = true
+					break
+				}
+			}
+		}
+	}
+	pair(combinator.Equivalent)
+	pair(func(b, a cqr.CommonQueryRepresentation) bool {
+		_, bk := b.(cqr.Keyword)
+		_, ak := a.(cqr.Keyword)
+		return bk && ak && term(b) == term(a)
+	})
+
+	// Clauses are matched greedily by the proportion of keywords they have in common.
+	type candidate struct {
+		i, j  int
+		score float64
+	}
+	var candidates []candidate
+	for i, b := range before {
+		if _, ok := b.(cqr.BooleanQuery); !ok || match[i] >= 0 {
+			continue
+		}
+		for j, a := range after {
+			if _, ok := a.(cqr.BooleanQuery); !ok || matched[j] {
+				continue
+			}
+			if s := similarity(b, a); s > 0 {
+				candidates = append(candidates, candidate{i: i, j: j, score: s})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(x, y int) bool {
+		return candidates[x].score > candidates[y].score
+	})
+	for _, c := range candidates {
+		if match[c.i] < 0 && !matched[c.j] {
+			match[c.i] = c.j
+			matched[c.j] = true
+		}
+	}
+
+	for i, b := range before {
+		if match[i] < 0 {
+			d.removed(b, appendPath(beforePath, i))
+			continue
+		}
+		d.diff(b, after[match[i]], appendPath(beforePath, i), appendPath(afterPath, match[i]))
+	}
+	for j, a := range after {
+		if !matched[j] {
+			d.added(a, appendPath(afterPath, j))
+		}
+	}
+}
+
+// Queries reports the changes made to a query to produce another query.
+func Queries(before, after cqr.CommonQueryRepresentation) Diff {
+	d := &differ{}
+	switch {
+	case before == nil && after == nil:
+	case before == nil:
+		d.added(after, nil)
+	case after == nil:
+		d.removed(before, nil)
+	default:
+		d.diff(before, after, nil, nil)
+	}
+	return Diff{Before: before, After: after, Changes: d.changes}
+}
+
+// nodes collects every node of a logical tree by the hash of its query.
+func nodes(node combinator.LogicalTreeNode, n map[uint64]combinator.LogicalTreeNode) {
+	n[combinator.HashCQR(node.Query())] = node
+	if c, ok := node.(combinator.Combinator); ok {
+		for _, clause := range c.Clauses {
+			nodes(clause, n)
+		}
+	}
+}
+
+// delta computes the difference between two sets of documents.
+func delta(before, after combinator.Documents) *Delta {
+	b, a := before.Set(), after.Set()
+	d := &Delta{Before: len(b), After: len(a)}
+	for doc := range a {
+		if _, ok := b[doc]; !ok {
+			d.Gained++
+		}
+	}
+	for doc := range b {
+		if _, ok := a[doc]; !ok {
+			d.Lost++
+		}
+	}
+	return d
+}
+
+// Retrieval computes the difference in the documents retrieved by each changed construct, and by the whole query,
+// using logical trees (see combinator.LogicalTree). The delta of a construct describes the construct in isolation
+// (e.g. the documents retrieved by a keyword that was added), rather than its effect on the whole query. The cache
+// may be nil.
+func (d Diff) Retrieval(topic string, ss stats.StatisticsSource, cache combinator.QueryCacher) (Diff, error) {
+	if d.Before == nil || d.After == nil {
+		return d, fmt.Errorf("retrieval cannot be computed for a diff with a missing query")
+	}
+	before, cache, err := combinator.NewLogicalTree(pipeline.NewQuery(topic, topic, d.Before), ss, cache)
+	if err != nil {
+		return d, err
+	}
+	after, cache, err := combinator.NewLogicalTree(pipeline.NewQuery(topic, topic, d.After), ss, cache)
+	if err != nil {
+		return d, err
+	}
+
+	n := make(map[uint64]combinator.LogicalTreeNode)
+	nodes(before.Root, n)
+	nodes(after.Root, n)
+	documents := func(q cqr.CommonQueryRepresentation) combinator.Documents {
+		if q == nil {
+			return nil
+		}
+		if node, ok := n[combinator.HashCQR(q)]; ok {
+			return node.Documents(cache)
+		}
+		return nil
+	}
+
+	changes := make([]Change, len(d.Changes))
+	for i, c := range d.Changes {
+		c.Delta = delta(documents(c.Before), documents(c.After))
+		changes[i] = c
+	}
+	d.Changes = changes
+	d.Delta = delta(before.Documents(cache), after.Documents(cache))
+	return d, nil
+}
@@ -0,0 +1,69 @@
+package diff_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis/diff"
+	"github.com/hscells/transmute/fields"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestQueries(t *testing.T) {
+	before := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("neoplasms", fields.MeshHeadings).SetOption(cqr.ExplodedString, true),
+			cqr.NewKeyword("cancer", fields.TitleAbstract),
+			cqr.NewKeyword("tumour", fields.TitleAbstract),
+		}),
+		cqr.NewBooleanQuery("adj2", []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("breast", fields.TitleAbstract),
+			cqr.NewKeyword("screening", fields.TitleAbstract),
+		}),
+	})
+	after := cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+		cqr.NewBooleanQuery("adj5", []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("breast", fields.TitleAbstract),
+			cqr.NewKeyword("screening", fields.TitleAbstract),
+		}),
+		cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("cancer", fields.Title),
+			cqr.NewKeyword("neoplasms", fields.MeshHeadings).SetOption(cqr.ExplodedString, false),
+			cqr.NewKeyword("carcinoma", fields.TitleAbstract),
+		}),
+	})
+
+	d := diff.Queries(before, after)
+	expected := []struct {
+		change diff.ChangeType
+		path   string
+	}{
+		{diff.OperatorChanged, "query"},
+		{diff.ExplosionChanged, "2.2"},
+		{diff.FieldsChanged, "2.1"},
+		{diff.KeywordRemoved, "1.3"},
+		{diff.KeywordAdded, "2.3"},
+		{diff.AdjacencyChanged, "1"},
+	}
+	if len(d.Changes) != len(expected) {
+		t.Fatalf("expected %d changes, got:\n%s", len(expected), d)
+	}
+	for i, e := range expected {
+		c := d.Changes[i]
+		path := "query"
+		if len(c.Path) > 0 {
+			p := make([]string, len(c.Path))
+			for j, idx := range c.Path {
+				p[j] = strconv.Itoa(idx + 1)
+			}
+			path = strings.Join(p, ".")
+		}
+		if c.Type != e.change || path != e.path {
+			t.Errorf("expected %s at %s, got %s", e.change, e.path, c)
+		}
+	}
+
+	if d := diff.Queries(before, before); len(d.Changes) != 0 {
+		t.Errorf("expected no changes, got:\n%s", d)
+	}
+}
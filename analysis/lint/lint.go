@@ -0,0 +1,408 @@
+// Package lint checks Boolean queries for problems before they are executed, such as empty clauses, fields that
+// cannot be searched, and MeSH headings that do not exist.
+package lint
+
+import (
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/meshexp"
+	"github.com/hscells/transmute/fields"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Severity is how serious an issue is. Errors are issues that will cause a query to fail or retrieve nothing,
+// while warnings are issues that are likely to be mistakes.
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// Rules that can be reported.
+const (
+	EmptyClause        = "empty-clause"
+	SingleChild        = "single-child"
+	UnbalancedNot      = "unbalanced-not"
+	RedundantNesting   = "redundant-nesting"
+	UnknownField       = "unknown-field"
+	ShortTruncation    = "short-truncation"
+	InvalidDate        = "invalid-date"
+	ContradictoryDates = "contradictory-dates"
+	UnknownMeSHHeading = "unknown-mesh-heading"
+)
+
+// DefaultMinTruncation is the default minimum number of characters that must precede a wildcard.
+const DefaultMinTruncation = 4
+
+// Position is the position of an issue in the original text of a query. Lines and columns start at 1; a zero
+// line means the position is not known.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) String() string {
+	if p.Line == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Issue is a problem identified in a query.
+type Issue struct {
+	Rule      string   `json:"rule"`
+	Severity  Severity `json:"severity"`
+	Message   string   `json:"message"`
+	Construct string   `json:"construct"`
+	Position  Position `json:"position"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", i.Position, i.Severity, i.Message, i.Rule)
+}
+
+// Issues is a list of issues, in the order they appear in a query.
+type Issues []Issue
+
+// Errors counts the number of issues that are errors.
+func (i Issues) Errors() int {
+	n := 0
+	for _, issue := range i {
+		if issue.Severity == Error {
+			n++
+		}
+	}
+	return n
+}
+
+// Linter checks queries for issues.
+type Linter struct {
+	fields        map[string]bool
+	tree          *meshexp.MeSHTree
+	minTruncation int
+}
+
+// Fields sets the fields that can be searched; keywords that search any other field are reported. Fields are not
+// checked unless they are set.
+func Fields(f ...string) func(*Linter) {
+	return func(l *Linter) {
+		l.fields = make(map[string]bool)
+		for _, field := range f {
+			l.fields[field] = true
+		}
+	}
+}
+
+// Source sets the fields that can be searched to the fields of a statistics source, if the statistics source is
+// a stats.FieldedStatisticsSource.
+func Source(ss stats.StatisticsSource) func(*Linter) {
+	return func(l *Linter) {
+		if s, ok := ss.(stats.FieldedStatisticsSource); ok {
+			Fields(s.Fields()...)(l)
+		}
+	}
+}
+
+// MeSHTree sets the MeSH tree that MeSH headings are checked against (e.g. meshexp.Default()). MeSH headings are
+// not checked unless a tree is set.
+func MeSHTree(tree *meshexp.MeSHTree) func(*Linter) {
+	return func(l *Linter) {
+		l.tree = tree
+	}
+}
+
+// MinTruncation sets the minimum number of characters that must precede a wildcard (DefaultMinTruncation by
+// default). Truncating shorter stems matches too many terms to be safe, and PubMed ignores them.
+func MinTruncation(n int) func(*Linter) {
+	return func(l *Linter) {
+		l.minTruncation = n
+	}
+}
+
+// NewLinter creates a new linter.
+func NewLinter(options ...func(*Linter)) Linter {
+	l := Linter{
+		minTruncation: DefaultMinTruncation,
+	}
+	for _, option := range options {
+		option(&l)
+	}
+	return l
+}
+
+// meshFields are the fields that contain MeSH headings.
+var meshFields = map[string]bool{
+	fields.MeshHeadings:          true,
+	fields.MeSHTerms:             true,
+	fields.MeSHMajorTopic:        true,
+	fields.MajorFocusMeshHeading: true,
+}
+
+// linter is the state of a linter while a single query is checked.
+type linter struct {
+	Linter
+	issues    Issues
+	positions []Position
+}
+
+func (l *linter) report(rule string, severity Severity, construct cqr.CommonQueryRepresentation, keyword int, format string, args ...interface{}) {
+	var p Position
+	if keyword >= 0 && keyword < len(l.positions) {
+		p = l.positions[keyword]
+	}
+	l.issues = append(l.issues, Issue{
+		Rule:      rule,
+		Severity:  severity,
+		Message:   fmt.Sprintf(format, args...),
+		Construct: construct.String(),
+		Position:  p,
+	})
+}
+
+// Lint checks a query for issues. The text is the original text of the query, which is used to find the position
+// of each issue; it may be empty if the query was not parsed from text.
+func (l Linter) Lint(query cqr.CommonQueryRepresentation, text string) Issues {
+	s := &linter{Linter: l, positions: locate(text, analysis.QueryKeywords(query))}
+	s.lint(query, nil, 0)
+	return s.issues
+}
+
+// lint checks a query and its children. The keyword is the index of the first keyword of the query.
+func (l *linter) lint(query cqr.CommonQueryRepresentation, parent *cqr.BooleanQuery, keyword int) {
+	switch q := query.(type) {
+	case cqr.Keyword:
+		l.keyword(q, keyword)
+	case cqr.BooleanQuery:
+		l.clause(q, parent, keyword)
+		l.dates(q, keyword)
+		for _, child := range q.Children {
+			l.lint(child, &q, keyword)
+			keyword += len(analysis.QueryKeywords(child))
+		}
+	}
+}
+
+func (l *linter) clause(q cqr.BooleanQuery, parent *cqr.BooleanQuery, keyword int) {
+	operator := strings.ToLower(strings.TrimSpace(q.Operator))
+	switch {
+	case len(q.Children) == 0:
+		// An empty clause has no keywords, so its position is not known.
+		l.report(EmptyClause, Error, q, -1, "%s clause has no children", operator)
+		return
+	case operator == cqr.NOT && len(q.Children) == 1:
+		l.report(UnbalancedNot, Error, q, keyword, "not clause has nothing to exclude from")
+	case operator == cqr.NOT && len(q.Children) > 2:
+		l.report(UnbalancedNot, Warning, q, keyword, "not clause with %d children is evaluated differently by different search engines", len(q.Children))
+	case len(q.Children) == 1:
+		l.report(SingleChild, Warning, q, keyword, "%s clause has a single child", operator)
+	}
+
+	if parent != nil && (operator == cqr.AND || operator == cqr.OR) && strings.EqualFold(strings.TrimSpace(parent.Operator), operator) {
+		l.report(RedundantNesting, Warning, q, keyword, "%s clause is nested in another %s clause", operator, operator)
+	}
+}
+
+func (l *linter) keyword(k cqr.Keyword, keyword int) {
+	if l.fields != nil {
+		for _, field := range k.Fields {
+			if !l.fields[field] {
+				l.report(UnknownField, Error, k, keyword, "field %s cannot be searched", field)
+			}
+		}
+	}
+
+	term := strings.Trim(k.QueryString, `"`)
+	if i := strings.IndexAny(term, "*?$"); i >= 0 && utf8.RuneCountInString(term[:i]) < l.minTruncation {
+		l.report(ShortTruncation, Warning, k, keyword, "%s is truncated after fewer than %d characters", term, l.minTruncation)
+	} else if truncated, ok := k.Options["truncated"].(bool); ok && truncated && i < 0 && utf8.RuneCountInString(term) < l.minTruncation {
+		l.report(ShortTruncation, Warning, k, keyword, "%s is truncated after fewer than %d characters", term, l.minTruncation)
+	}
+
+	if l.tree != nil {
+		for _, field := range k.Fields {
+			if !meshFields[field] {
+				continue
+			}
+			heading := strings.TrimSpace(strings.TrimRight(term, "#*"))
+			if i := strings.Index(heading, "/"); i > 0 {
+				heading = heading[:i]
+			}
+			if !l.tree.Contains(heading) {
+				l.report(UnknownMeSHHeading, Error, k, keyword, "%s is not a MeSH heading", heading)
+			}
+			break
+		}
+	}
+
+	for _, field := range k.Fields {
+		if field == fields.PublicationDate {
+			if start, end, err := DateRange(k.QueryString); err != nil {
+				l.report(InvalidDate, Error, k, keyword, "%v", err)
+			} else if start.After(end) {
+				l.report(ContradictoryDates, Error, k, keyword, "date range starts after it ends")
+			}
+			break
+		}
+	}
+}
+
+// dates checks that the date ranges of the children of an and clause overlap.
+func (l *linter) dates(q cqr.BooleanQuery, keyword int) {
+	if !strings.EqualFold(strings.TrimSpace(q.Operator), cqr.AND) {
+		return
+	}
+	var (
+		start, end time.Time
+		n          int
+	)
+	for _, child := range q.Children {
+		k, ok := child.(cqr.Keyword)
+		if !ok || !isDate(k) {
+			continue
+		}
+		s, e, err := DateRange(k.QueryString)
+		if err != nil || s.After(e) {
+			continue
+		}
+		if n == 0 || s.After(start) {
+			start = s
+		}
+		if n == 0 || e.Before(end) {
+			end = e
+		}
+		n++
+	}
+	if n > 1 && start.After(end) {
+		l.report(ContradictoryDates, Error, q, keyword, "date ranges do not overlap, so the query retrieves nothing")
+	}
+}
+
+func isDate(k cqr.Keyword) bool {
+	for _, field := range k.Fields {
+		if field == fields.PublicationDate {
+			return true
+		}
+	}
+	return false
+}
+
+// dateRe matches dates in the formats YYYY, YYYY/MM, and YYYY/MM/DD (or with hyphens).
+var dateRe = regexp.MustCompile(`^(\d{4})(?:[/-](\d{1,2})(?:[/-](\d{1,2}))?)?$`)
+
+// parseDate parses a date, returning the first and last day of the period it refers to (e.g. a year).
+func parseDate(s string) (time.Time, time.Time, error) {
+	m := dateRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%q is not a date", s)
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	switch {
+	case len(m[2]) == 0:
+		start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(1, 0, -1), nil
+	case len(m[3]) == 0:
+		if month < 1 || month > 12 {
+			return time.Time{}, time.Time{}, fmt.Errorf("%q is not a date", s)
+		}
+		start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, -1), nil
+	}
+	d := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if d.Year() != year || int(d.Month()) != month || d.Day() != day {
+		return time.Time{}, time.Time{}, fmt.Errorf("%q is not a date", s)
+	}
+	return d, d, nil
+}
+
+// DateRange parses a publication date keyword, which is either a single date or a range of dates separated by a
+// colon (e.g. 2000/01:2010/12), into the first and last day it covers.
+func DateRange(s string) (time.Time, time.Time, error) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	parts := strings.Split(s, ":")
+	switch len(parts) {
+	case 1:
+		return parseDate(parts[0])
+	case 2:
+		start, _, err := parseDate(parts[0])
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		_, end, err := parseDate(parts[1])
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return start, end, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("%q is not a date range", s)
+}
+
+// locate finds the position of each keyword in the original text of a query. Keywords are searched for in order,
+// so repeated keywords are found at successive occurrences.
+func locate(text string, keywords []cqr.Keyword) []Position {
+	positions := make([]Position, len(keywords))
+	cursor := 0
+	for i, k := range keywords {
+		term := strings.TrimRight(strings.Trim(k.QueryString, `"`), "#")
+		if j := strings.IndexAny(term, "*?$"); j > 0 {
+			term = term[:j]
+		}
+		if len(term) == 0 {
+			continue
+		}
+		offset, n := indexFold(text[cursor:], term)
+		if offset >= 0 {
+			offset += cursor
+			cursor = offset + n
+		} else if offset, _ = indexFold(text, term); offset < 0 {
+			continue
+		}
+		positions[i] = position(text, offset)
+	}
+	return positions
+}
+
+// indexFold finds the first occurrence of substr in s ignoring case, and returns its byte offset in s and its length
+// in s (or -1 if there is none). The text is not lowercased to search it, since lowercasing changes the length of
+// some characters (e.g. İ), so that offsets in the lowercased text are not offsets in the original.
+func indexFold(s, substr string) (int, int) {
+	for i := range s {
+		if n := prefixFold(s[i:], substr); n >= 0 {
+			return i, n
+		}
+	}
+	return -1, 0
+}
+
+// prefixFold is the length in bytes of the prefix of s that matches prefix ignoring case, or -1 if s does not start
+// with prefix.
+func prefixFold(s, prefix string) int {
+	n := 0
+	for _, r := range prefix {
+		if n >= len(s) {
+			return -1
+		}
+		c, size := utf8.DecodeRuneInString(s[n:])
+		if c != r && !strings.EqualFold(string(c), string(r)) {
+			return -1
+		}
+		n += size
+	}
+	return n
+}
+
+// position converts a byte offset in text into a line and column.
+func position(text string, offset int) Position {
+	line := strings.Count(text[:offset], "\n") + 1
+	column := utf8.RuneCountInString(text[strings.LastIndex(text[:offset], "\n")+1:offset]) + 1
+	return Position{Offset: offset, Line: line, Column: column}
+}
@@ -0,0 +1,103 @@
+package lint_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis/lint"
+	"github.com/hscells/meshexp"
+	"github.com/hscells/transmute/fields"
+	"testing"
+)
+
+func TestLinter_Lint(t *testing.T) {
+	text := `(cancer[tiab] OR (tumour[tiab] OR ca*[tiab])) AND (rat[xx] NOT) AND 2010:2000[dp] AND ()`
+	q := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("cancer", fields.TitleAbstract),
+			cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+				cqr.NewKeyword("tumour", fields.TitleAbstract),
+				cqr.NewKeyword("ca*", fields.TitleAbstract),
+			}),
+		}),
+		cqr.NewBooleanQuery(cqr.NOT, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("rat", "xx"),
+		}),
+		cqr.NewKeyword("2010:2000", fields.PublicationDate),
+		cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{}),
+	})
+
+	issues := lint.NewLinter(lint.Fields(fields.TitleAbstract, fields.PublicationDate)).Lint(q, text)
+
+	expected := []struct {
+		rule   string
+		line   int
+		column int
+	}{
+		{lint.RedundantNesting, 1, 19},
+		{lint.ShortTruncation, 1, 35},
+		{lint.UnbalancedNot, 1, 52},
+		{lint.UnknownField, 1, 52},
+		{lint.ContradictoryDates, 1, 69},
+		{lint.EmptyClause, 0, 0},
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("expected %d issues, got %v", len(expected), issues)
+	}
+	for i, e := range expected {
+		if issues[i].Rule != e.rule || issues[i].Position.Line != e.line || issues[i].Position.Column != e.column {
+			t.Errorf("expected %s at %d:%d, got %v", e.rule, e.line, e.column, issues[i])
+		}
+	}
+	if issues.Errors() != 4 {
+		t.Errorf("expected 4 errors, got %d", issues.Errors())
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	start, end, err := lint.DateRange("2000/02:2010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start.Format("20060102") != "20000201" || end.Format("20060102") != "20101231" {
+		t.Errorf("unexpected range %v to %v", start, end)
+	}
+	if _, _, err := lint.DateRange("2000/13/01"); err == nil {
+		t.Error("expected an invalid date")
+	}
+}
+
+func TestLinter_LintPositions(t *testing.T) {
+	// Lowercasing İ and ẞ changes their length, which must not change the positions of the keywords after them.
+	text := "(İİ[tiab] OR Cancer[xx])\nAND ẞ[xx]"
+	q := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("İİ", fields.TitleAbstract),
+			cqr.NewKeyword("cancer", "xx"),
+		}),
+		cqr.NewKeyword("ß", "xx"),
+	})
+	issues := lint.NewLinter(lint.Fields(fields.TitleAbstract)).Lint(q, text)
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %v", issues)
+	}
+	if p := issues[0].Position; p.Line != 1 || p.Column != 14 || p.Offset != 15 {
+		t.Errorf("expected cancer at 1:14, got %v", issues[0])
+	}
+	if p := issues[1].Position; p.Line != 2 || p.Column != 5 {
+		t.Errorf("expected ß at 2:5, got %v", issues[1])
+	}
+}
+
+func TestLinter_LintMeSH(t *testing.T) {
+	tree, err := meshexp.Default()
+	if err != nil {
+		t.Skip("the MeSH tree could not be loaded")
+	}
+	q := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("Neoplasms", fields.MeshHeadings),
+		cqr.NewKeyword("Not A Heading", fields.MeshHeadings),
+	})
+	issues := lint.NewLinter(lint.MeSHTree(tree)).Lint(q, "")
+	if len(issues) != 1 || issues[0].Rule != lint.UnknownMeSHHeading {
+		t.Errorf("expected only the unknown heading to be reported, got %v", issues)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/hscells/groove/stats"
 	"github.com/hscells/transmute/fields"
 	"github.com/peterbourgon/diskv"
+	"log"
 	"math"
 	"strings"
 )
@@ -46,60 +47,175 @@ func (m MemoryMeasurementCache) Write(key string, val []byte) error {
 	return nil
 }
 
-// MeasurementExecutor executes measurements while caching the results to improve performance.
+// MissingValuePolicy determines what a measurement executor does when a measurement cannot be computed.
+type MissingValuePolicy int
+
+const (
+	// FailOnError stops executing measurements and returns the error (the default).
+	FailOnError MissingValuePolicy = iota
+	// MissingOnError records the measurement as missing (NaN) and logs the error, so that the other measurements can
+	// still be computed. Missing values are output as such by measurement formatters.
+	MissingOnError
+)
+
+// MeasurementExecutor executes measurements while caching the results to improve performance. Only the results of
+// measurements that succeed are cached. Measurements can be computed concurrently (see MeasurementWorkers); identical
+// measurements of the same query that are requested concurrently are only computed once, and the measurements of a
+// query share the documents that the query retrieves (i.e. each query is executed once by the statistics source).
 type MeasurementExecutor struct {
-	cache MeasurementCacher
+	cache    MeasurementCacher
+	policy   MissingValuePolicy
+	policies map[string]MissingValuePolicy
+	workers  int
+	flight   *flight
 }
 
-// NewDiskMeasurementExecutor creates a measurement executor that caches to disk.
-func NewDiskMeasurementExecutor(d *diskv.Diskv) MeasurementExecutor {
-	return MeasurementExecutor{
-		cache: d,
+// MeasurementWorkers sets the maximum number of measurements that are computed concurrently (by default, one).
+func MeasurementWorkers(n int) func(*MeasurementExecutor) {
+	return func(m *MeasurementExecutor) {
+		m.workers = n
+	}
+}
+
+// MeasurementMissingValues sets the policy for measurements that cannot be computed. When measurement names are
+// specified, the policy only applies to those measurements, otherwise it applies to every measurement.
+func MeasurementMissingValues(policy MissingValuePolicy, measurements ...string) func(*MeasurementExecutor) {
+	return func(m *MeasurementExecutor) {
+		if len(measurements) == 0 {
+			m.policy = policy
+			return
+		}
+		if m.policies == nil {
+			m.policies = make(map[string]MissingValuePolicy)
+		}
+		for _, measurement := range measurements {
+			m.policies[measurement] = policy
+		}
+	}
+}
+
+func newMeasurementExecutor(cache MeasurementCacher, options ...func(*MeasurementExecutor)) MeasurementExecutor {
+	m := MeasurementExecutor{
+		cache:   cache,
+		workers: 1,
+		flight:  newFlight(),
+	}
+	for _, option := range options {
+		option(&m)
 	}
+	return m
+}
+
+// NewDiskMeasurementExecutor creates a measurement executor that caches to disk.
+func NewDiskMeasurementExecutor(d *diskv.Diskv, options ...func(*MeasurementExecutor)) MeasurementExecutor {
+	return newMeasurementExecutor(d, options...)
 }
 
 // NewMemoryMeasurementExecutor creates a measurement executor that caches to memory.
-func NewMemoryMeasurementExecutor() MeasurementExecutor {
-	return MeasurementExecutor{
-		cache: make(MemoryMeasurementCache),
+func NewMemoryMeasurementExecutor(options ...func(*MeasurementExecutor)) MeasurementExecutor {
+	return newMeasurementExecutor(&lockedMeasurementCache{cache: make(MemoryMeasurementCache)}, options...)
+}
+
+// restrictionKey identifies the date restriction of a query in cache keys, so that the measurements of a query with
+// and without a date restriction are cached separately. Queries without a date restriction have an empty key.
+func restrictionKey(query pipeline.Query) string {
+	d, err := query.DateRestriction()
+	if err != nil {
+		start, _ := query.GetMetadata(pipeline.DateStartMetadata)
+		end, _ := query.GetMetadata(pipeline.DateEndMetadata)
+		return fmt.Sprintf("/invalid:%s-%s", start, end)
+	}
+	if d == nil {
+		return ""
 	}
+	return "/" + d.String()
 }
 
-// hash hashes a query and measurement pair ready to be cached.
-func hash(representation cqr.CommonQueryRepresentation, measurement Measurement) string {
-	if representation == nil {
+// hash hashes a query and measurement pair ready to be cached. Queries that are logically the same (see
+// combinator.Canonical) and have the same date restriction have the same hash.
+func hash(query pipeline.Query, measurement Measurement) string {
+	if query.Query == nil {
 		return "0"
 	}
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(representation.String()+measurement.Name())))
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(combinator.CanonicalString(query.Query)+measurement.Name()+restrictionKey(query))))
 	//h := fnv.New32()
 	//h.Write([]byte(representation.String() + measurement.Name()))
 	//return strconv.Itoa(int(h.Sum32()))
 }
 
-// Execute executes the specified measurements on the query using the statistics source.
-func (m MeasurementExecutor) Execute(query pipeline.Query, ss stats.StatisticsSource, measurements ...Measurement) ([]float64, error) {
-	results := make([]float64, len(measurements))
-	for i, measurement := range measurements {
-		qHash := hash(query.Query, measurement)
+// missingValuePolicy is the policy for a measurement.
+func (m MeasurementExecutor) missingValuePolicy(measurement interface{ Name() string }) MissingValuePolicy {
+	if policy, ok := m.policies[measurement.Name()]; ok {
+		return policy
+	}
+	return m.policy
+}
+
+// measure computes a measurement of a query, or reads it from the cache. Measurements that fail are handled
+// according to the missing value policy of the executor.
+func (m MeasurementExecutor) measure(query pipeline.Query, ss stats.StatisticsSource, measurement Measurement) (float64, error) {
+	qHash := hash(query, measurement)
+	cached := func() (float64, bool) {
 		if v, err := m.cache.Read(qHash); err == nil && len(v) > 0 {
 			bits := binary.BigEndian.Uint64(v)
-			f := math.Float64frombits(bits)
-			results[i] = f
-			continue
+			return math.Float64frombits(bits), true
 		}
+		return 0, false
+	}
+	if v, ok := cached(); ok {
+		return v, nil
+	}
 
-		var v float64
+	v, err := m.flight.do(measurement.Name()+"/"+qHash, func() (interface{}, error) {
+		// The measurement may have been computed since the cache was read.
+		if v, ok := cached(); ok {
+			return v, nil
+		}
 		v, err := measurement.Execute(query, ss)
-		if err != nil {
-			return nil, err
+		if err != nil || math.IsNaN(v) {
+			return v, err
 		}
-		results[i] = v
 		buff := make([]byte, 8)
 		binary.BigEndian.PutUint64(buff[:], math.Float64bits(v))
-		err = m.cache.Write(qHash, buff)
-		if err != nil {
-			return nil, err
+		return v, m.cache.Write(qHash, buff)
+	})
+	if err != nil {
+		if m.missingValuePolicy(measurement) == MissingOnError {
+			log.Printf("measurement %s is missing for topic %s: %v", measurement.Name(), query.Topic, err)
+			return math.NaN(), nil
 		}
+		return 0, fmt.Errorf("measurement %s for topic %s: %v", measurement.Name(), query.Topic, err)
+	}
+	return v.(float64), nil
+}
+
+// Execute executes the specified measurements on the query using the statistics source. Measurements that fail are
+// handled according to the missing value policy of the executor.
+func (m MeasurementExecutor) Execute(query pipeline.Query, ss stats.StatisticsSource, measurements ...Measurement) ([]float64, error) {
+	results, err := m.ExecuteQueries([]pipeline.Query{query}, ss, measurements...)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// ExecuteQueries executes the specified measurements on each of the queries using the statistics source, where the
+// results contain the measurements of each query. The measurements of every query are computed concurrently, up to
+// the number of workers of the executor.
+func (m MeasurementExecutor) ExecuteQueries(queries []pipeline.Query, ss stats.StatisticsSource, measurements ...Measurement) ([][]float64, error) {
+	results := make([][]float64, len(queries))
+	sources := sharedRetrievals(queries, ss, len(measurements))
+	for i := range queries {
+		results[i] = make([]float64, len(measurements))
+	}
+	err := m.run(len(queries)*len(measurements), func(i int) (err error) {
+		q, j := i/len(measurements), i%len(measurements)
+		defer release(sources[q])
+		results[q][j], err = m.measure(queries[q], sources[q], measurements[j])
+		return
+	})
+	if err != nil {
+		return nil, err
 	}
 	return results, nil
 }
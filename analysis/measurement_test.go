@@ -0,0 +1,280 @@
+package analysis_test
+
+import (
+	"errors"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/trecresults"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type flakyMeasurement struct {
+	calls int
+	fail  bool
+}
+
+func (m *flakyMeasurement) Name() string {
+	return "Flaky"
+}
+
+func (m *flakyMeasurement) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	m.calls++
+	if m.fail {
+		return 0, errors.New("backend unavailable")
+	}
+	return 1, nil
+}
+
+func TestMeasurementExecutor_Execute(t *testing.T) {
+	q := pipeline.NewQuery("", "1", cqr.NewKeyword("cancer", "ti"))
+	m := &flakyMeasurement{fail: true}
+
+	e := analysis.NewMemoryMeasurementExecutor()
+	if _, err := e.Execute(q, nil, m); err == nil {
+		t.Fatal("expected the error of the measurement")
+	}
+
+	// Failed measurements are not cached, so the measurement is computed again.
+	m.fail = false
+	v, err := e.Execute(q, nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v[0] != 1 || m.calls != 2 {
+		t.Errorf("expected the measurement to be computed again, got %f after %d calls", v[0], m.calls)
+	}
+
+	m.fail = true
+	e = analysis.NewMemoryMeasurementExecutor(analysis.MeasurementMissingValues(analysis.MissingOnError, "Flaky"))
+	v, err = e.Execute(q, nil, m, analysis.TermCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(v[0]) || v[1] != 1 {
+		t.Errorf("expected the measurement to be missing, got %v", v)
+	}
+}
+
+type restrictedMeasurement struct{}
+
+func (restrictedMeasurement) Name() string {
+	return "Restricted"
+}
+
+func (restrictedMeasurement) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	d, err := q.DateRestriction()
+	if err != nil || d == nil {
+		return 0, err
+	}
+	return float64(d.Start.Year()), nil
+}
+
+func TestMeasurementExecutor_ExecuteRestricted(t *testing.T) {
+	q := pipeline.NewQuery("", "1", cqr.NewKeyword("cancer", "ti"))
+	d, err := pipeline.ParseDateRestriction("1990", "2000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same query with and without a date restriction is cached separately.
+	e := analysis.NewMemoryMeasurementExecutor()
+	unrestricted, err := e.Execute(q, nil, restrictedMeasurement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restricted, err := e.Execute(q.SetDateRestriction(d), nil, restrictedMeasurement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unrestricted[0] != 0 || restricted[0] != 1990 {
+		t.Errorf("expected the restricted query to be measured separately, got %v and %v", unrestricted, restricted)
+	}
+}
+
+type clauseSizes struct {
+	calls int
+}
+
+func (m *clauseSizes) Name() string {
+	return "ClauseSizes"
+}
+
+func (m *clauseSizes) ExecuteStructured(q pipeline.Query, s stats.StatisticsSource) (pipeline.MeasurementResult, error) {
+	m.calls++
+	var r pipeline.MeasurementResult
+	err := analysis.WalkQuery(q.Query, func(path string, node cqr.CommonQueryRepresentation) error {
+		if b, ok := node.(cqr.BooleanQuery); ok {
+			r.Annotate(path, "size", float64(len(b.Children)))
+		}
+		return nil
+	})
+	return r, err
+}
+
+func TestMeasurementExecutor_ExecuteStructured(t *testing.T) {
+	q := pipeline.NewQuery("", "1", cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("cancer", "ti"),
+		cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("screening", "ti"),
+			cqr.NewKeyword("mammography", "ti"),
+			cqr.NewKeyword("ultrasound", "ti"),
+		}),
+	}))
+	m := &clauseSizes{}
+
+	e := analysis.NewMemoryMeasurementExecutor()
+	for i := 0; i < 2; i++ {
+		results, err := e.ExecuteStructured(q, nil, m, analysis.Scalar(analysis.TermCount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[0].Annotations["/"]["size"] != 2 || results[0].Annotations["/1"]["size"] != 3 {
+			t.Errorf("expected the clauses to be annotated with their sizes, got %v", results[0].Annotations)
+		}
+		if results[1].Values["TermCount"] != 4 {
+			t.Errorf("expected a term count of 4, got %v", results[1].Values)
+		}
+	}
+	if m.calls != 1 {
+		t.Errorf("expected the result to be cached, got %d calls", m.calls)
+	}
+
+	// An equivalent query with the clauses in a different order has the annotations at its own paths.
+	reordered := q.WithQuery(cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		q.Query.(cqr.BooleanQuery).Children[1],
+		q.Query.(cqr.BooleanQuery).Children[0],
+	}))
+	results, err := e.ExecuteStructured(reordered, nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Annotations["/0"]["size"] != 3 || m.calls != 2 {
+		t.Errorf("expected the reordered query to be annotated at its own paths, got %v", results[0].Annotations)
+	}
+}
+
+type emptyMeasurement struct {
+	calls int
+}
+
+func (m *emptyMeasurement) Name() string {
+	return "Empty"
+}
+
+func (m *emptyMeasurement) ExecuteStructured(q pipeline.Query, s stats.StatisticsSource) (pipeline.MeasurementResult, error) {
+	m.calls++
+	return pipeline.MeasurementResult{}, nil
+}
+
+func TestMeasurementExecutor_ExecuteStructuredEmpty(t *testing.T) {
+	q := pipeline.NewQuery("", "1", cqr.NewKeyword("cancer", "ti"))
+	m := &emptyMeasurement{}
+
+	// An empty result is a result, so it is cached like any other.
+	e := analysis.NewMemoryMeasurementExecutor()
+	for i := 0; i < 2; i++ {
+		results, err := e.ExecuteStructured(q, nil, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !results[0].Empty() {
+			t.Errorf("expected an empty result, got %v", results[0])
+		}
+	}
+	if m.calls != 1 {
+		t.Errorf("expected the empty result to be cached, got %d calls", m.calls)
+	}
+}
+
+type countingSource struct {
+	stats.StatisticsSource
+	executions int32
+}
+
+func (s *countingSource) SearchOptions() stats.SearchOptions {
+	return stats.SearchOptions{Size: 10}
+}
+
+func (s *countingSource) Execute(query pipeline.Query, options stats.SearchOptions) (trecresults.ResultList, error) {
+	atomic.AddInt32(&s.executions, 1)
+	time.Sleep(10 * time.Millisecond)
+	return trecresults.ResultList{{DocId: "1", Score: 2}, {DocId: "2", Score: 1}}, nil
+}
+
+type retrievalMeasurement struct {
+	name  string
+	calls int32
+}
+
+func (m *retrievalMeasurement) Name() string {
+	return m.name
+}
+
+func (m *retrievalMeasurement) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	atomic.AddInt32(&m.calls, 1)
+	results, err := s.Execute(q, s.SearchOptions())
+	if err != nil {
+		return 0, err
+	}
+	return float64(len(results)), nil
+}
+
+func TestMeasurementExecutor_ExecuteQueries(t *testing.T) {
+	q := pipeline.NewQuery("", "1", cqr.NewKeyword("cancer", "ti"))
+	ss := &countingSource{}
+	a, b := &retrievalMeasurement{name: "A"}, &retrievalMeasurement{name: "B"}
+
+	// The same query is measured twice concurrently, and both measurements retrieve documents for it.
+	e := analysis.NewMemoryMeasurementExecutor(analysis.MeasurementWorkers(4))
+	results, err := e.ExecuteQueries([]pipeline.Query{q, q}, ss, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r[0] != 2 || r[1] != 2 {
+			t.Errorf("expected each measurement to be 2, got %v", r)
+		}
+	}
+	if a.calls != 1 || b.calls != 1 {
+		t.Errorf("expected each measurement to be computed once, got %d and %d", a.calls, b.calls)
+	}
+	if ss.executions != 1 {
+		t.Errorf("expected the query to be executed once, got %d", ss.executions)
+	}
+}
+
+type failingMeasurement struct {
+	calls int32
+}
+
+func (m *failingMeasurement) Name() string {
+	return "Failing"
+}
+
+func (m *failingMeasurement) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	atomic.AddInt32(&m.calls, 1)
+	time.Sleep(time.Millisecond)
+	return 0, errors.New("backend unavailable")
+}
+
+func TestMeasurementExecutor_ExecuteQueriesFailure(t *testing.T) {
+	queries := make([]pipeline.Query, 20)
+	for i := range queries {
+		queries[i] = pipeline.NewQuery("", "1", cqr.NewKeyword(string(rune('a'+i)), "ti"))
+	}
+	m := &failingMeasurement{}
+
+	// No more measurements are computed once one fails.
+	e := analysis.NewMemoryMeasurementExecutor(analysis.MeasurementWorkers(2))
+	if _, err := e.ExecuteQueries(queries, nil, m); err == nil {
+		t.Fatal("expected the error of the measurement")
+	}
+	if m.calls >= int32(len(queries)) {
+		t.Errorf("expected the remaining measurements to be cancelled, got %d calls", m.calls)
+	}
+}
@@ -1,14 +1,25 @@
 package analysis
 
 import (
+	"fmt"
+	"github.com/hscells/cqr"
 	"github.com/hscells/groove/pipeline"
 	"github.com/hscells/groove/stats"
 	"github.com/hscells/meshexp"
 	"github.com/hscells/transmute/fields"
+	"math"
 	"strings"
 )
 
-var MeSHTree, _ = meshexp.Default()
+var MeSHTree, meshTreeErr = meshexp.Default()
+
+// meshTree is the MeSH tree, or the error that occurred loading it.
+func meshTree() (*meshexp.MeSHTree, error) {
+	if MeSHTree == nil {
+		return nil, fmt.Errorf("MeSH tree could not be loaded: %v", meshTreeErr)
+	}
+	return MeSHTree, nil
+}
 
 var (
 	MeshKeywordCount     = meshKeywordCount{}
@@ -16,6 +27,9 @@ var (
 	MeshNonExplodedCount = meshNonExplodedCount{}
 	MeshAvgDepth         = meshAvgDepth{}
 	MeshMaxDepth         = meshMaxDepth{}
+	// MeshSpecificity is the average specificity of the MeSH headings of a query: the depth of each heading in the
+	// MeSH tree, discounted by the (logarithm of the) number of headings below it when it is exploded.
+	MeshSpecificity = meshSpecificity{}
 )
 
 func normalise(q string) string {
@@ -65,9 +79,13 @@ func (meshAvgDepth) Execute(q pipeline.Query, s stats.StatisticsSource) (float64
 	if len(keywords) == 0 {
 		return 0, nil
 	}
+	tree, err := meshTree()
+	if err != nil {
+		return 0, err
+	}
 	var sum int64
 	for _, kw := range keywords {
-		sum += MeSHTree.Depth(normalise(kw.QueryString))
+		sum += tree.Depth(normalise(kw.QueryString))
 	}
 	return float64(sum) / float64(len(keywords)), nil
 }
@@ -83,12 +101,43 @@ func (meshMaxDepth) Execute(q pipeline.Query, s stats.StatisticsSource) (float64
 	if len(keywords) == 0 {
 		return 0, nil
 	}
+	tree, err := meshTree()
+	if err != nil {
+		return 0, err
+	}
 	var max int64
 	for _, kw := range keywords {
-		d := MeSHTree.Depth(normalise(kw.QueryString))
+		d := tree.Depth(normalise(kw.QueryString))
 		if d > max {
 			max = d
 		}
 	}
 	return float64(max), nil
 }
+
+type meshSpecificity struct{}
+
+func (meshSpecificity) Name() string {
+	return "MeshSpecificity"
+}
+
+func (meshSpecificity) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	keywords := KeywordsWithField(q.Query, fields.MeshHeadings)
+	if len(keywords) == 0 {
+		return 0, nil
+	}
+	tree, err := meshTree()
+	if err != nil {
+		return 0, err
+	}
+	var sum float64
+	for _, kw := range keywords {
+		heading := normalise(kw.QueryString)
+		specificity := float64(tree.Depth(heading))
+		if exp, ok := kw.Options[cqr.ExplodedString].(bool); ok && exp {
+			specificity /= 1 + math.Log(1+float64(len(tree.Explode(heading))))
+		}
+		sum += specificity
+	}
+	return sum / float64(len(keywords)), nil
+}
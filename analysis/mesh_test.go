@@ -0,0 +1,55 @@
+package analysis_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/transmute/fields"
+	"math"
+	"testing"
+)
+
+func TestMeshSpecificity(t *testing.T) {
+	if analysis.MeSHTree == nil {
+		t.Skip("the MeSH tree could not be loaded")
+	}
+	specificity := func(query cqr.CommonQueryRepresentation) float64 {
+		v, err := analysis.MeshSpecificity.Execute(pipeline.NewQuery("1", "1", query), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	heading := func(heading string, exploded bool) cqr.CommonQueryRepresentation {
+		return cqr.NewKeyword(heading, fields.MeshHeadings).SetOption(cqr.ExplodedString, exploded)
+	}
+
+	if v := specificity(cqr.NewKeyword("neoplasms", fields.TitleAbstract)); v != 0 {
+		t.Errorf("expected no specificity without MeSH headings, got %v", v)
+	}
+
+	// A heading that is not exploded is as specific as its depth.
+	depth := float64(analysis.MeSHTree.Depth("Neoplasms"))
+	if v := specificity(heading("Neoplasms", false)); v != depth {
+		t.Errorf("expected the specificity of Neoplasms to be its depth %v, got %v", depth, v)
+	}
+	if v := specificity(heading(`"Neoplasms*"`, false)); v != depth {
+		t.Errorf("expected the heading to be normalised, got %v", v)
+	}
+
+	// Exploding a heading makes it less specific, by the number of headings below it.
+	exploded := depth / (1 + math.Log(1+float64(len(analysis.MeSHTree.Explode("Neoplasms")))))
+	if v := specificity(heading("Neoplasms", true)); math.Abs(v-exploded) > 1e-9 || v >= depth {
+		t.Errorf("expected the specificity of exploded Neoplasms to be %v, got %v", exploded, v)
+	}
+
+	// The specificity of a query is the average specificity of its headings.
+	breast := float64(analysis.MeSHTree.Depth("Breast Neoplasms"))
+	if breast <= depth {
+		t.Errorf("expected Breast Neoplasms to be deeper than Neoplasms, got %v and %v", breast, depth)
+	}
+	q := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{heading("Neoplasms", false), heading("Breast Neoplasms", false)})
+	if v := specificity(q); math.Abs(v-(depth+breast)/2) > 1e-9 {
+		t.Errorf("expected the average specificity %v, got %v", (depth+breast)/2, v)
+	}
+}
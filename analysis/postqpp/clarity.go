@@ -16,13 +16,13 @@ func (clarityScore) Name() string {
 }
 
 func (clarityScore) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
-	lambda, ok := s.Parameters()["lambda"]
-	if !ok {
-		lambda = 0.6
-	}
+	lambda := parameter(s, ParameterLambda, 0.6)
 
 	results, err := s.Execute(q, s.SearchOptions())
 	if err != nil {
+		return 0.0, err
+	}
+	if len(results) == 0 {
 		return 0.0, nil
 	}
 
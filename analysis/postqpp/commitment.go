@@ -9,7 +9,7 @@ import (
 
 type normalisedQueryCommitment struct{}
 
-// NormalisedQueryCommitment.
+// NormalisedQueryCommitment. Parameters: k (default 100).
 var NormalisedQueryCommitment = normalisedQueryCommitment{}
 
 func (normalisedQueryCommitment) Name() string {
@@ -19,11 +19,14 @@ func (normalisedQueryCommitment) Name() string {
 func (normalisedQueryCommitment) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
 	results, err := s.Execute(q, s.SearchOptions())
 	if err != nil {
+		return 0.0, err
+	}
+	if len(results) == 0 {
 		return 0.0, nil
 	}
 
 	// Handle the case that the query retrieves less than k documents.
-	k := s.Parameters()["k"]
+	k := parameter(s, ParameterK, DefaultK)
 	if float64(len(results)) < k {
 		k = float64(len(results))
 	}
@@ -0,0 +1,244 @@
+package postqpp
+
+import (
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/trecresults"
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/stat"
+	"math"
+	"sort"
+)
+
+type queryFeedback struct{}
+type jensenShannonDivergence struct{}
+type utilityEstimation struct {
+	predictor analysis.Measurement
+}
+
+var (
+	// QueryFeedback aims to measure how robust the results of a query are to noise, as the overlap between the top k
+	// documents of the query and the top k documents of a query made from the most likely terms of the relevance model
+	// of the top k documents (Zhou and Croft, 2007). Parameters: k (default 100), terms (default 100), and lambda
+	// (default 0.6).
+	QueryFeedback = queryFeedback{}
+	// JensenShannonDivergence aims to measure how much the language model of the top k documents diverges from the
+	// collection language model, as a bounded, symmetric alternative to the clarity score (Carmel et al., 2006).
+	// Parameters: k (default 100).
+	JensenShannonDivergence = jensenShannonDivergence{}
+)
+
+// UtilityEstimation creates a predictor using the utility estimation framework (UEF), which scales the value of
+// another predictor by how similar the ranking of the top k documents is to their ranking by the relevance model of
+// the top k documents (Shtok et al., 2010). Parameters: k (default 100), terms (default 100), lambda (default 0.6),
+// and mu (default 2500), as well as the parameters of the predictor.
+func UtilityEstimation(predictor analysis.Measurement) analysis.Measurement {
+	return utilityEstimation{predictor: predictor}
+}
+
+// relevanceModel estimates a relevance model from the top ranked documents, weighting each document by its score.
+func relevanceModel(s stats.StatisticsSource, results trecresults.ResultList) (*stats.LanguageModel, error) {
+	docIds := make([]string, len(results))
+	for i, result := range results {
+		docIds[i] = result.DocId
+	}
+	top := scores(results)
+	return stats.NewLanguageModel(s, docIds, top, "tiab", stats.LanguageModelWeights(documentWeights(top)))
+}
+
+// documentWeights weights documents by their score relative to the mean score. Negative scores (e.g. log
+// likelihoods) are shifted so that the lowest score is zero, so that higher scores always have higher weights, and
+// documents are weighted equally when the mean score is zero.
+func documentWeights(scores []float64) []float64 {
+	N := float64(len(scores))
+	weights := make([]float64, len(scores))
+	if len(scores) == 0 {
+		return weights
+	}
+	shift := 0.0
+	if min := floats.Min(scores); min < 0 {
+		shift = -min
+	}
+	avgScore := stat.Mean(scores, nil) + shift
+	for i, score := range scores {
+		if avgScore == 0 {
+			weights[i] = 1 / N
+		} else {
+			weights[i] = ((score + shift) / avgScore) / N
+		}
+	}
+	return weights
+}
+
+// expansionTerms are the n most likely terms of a relevance model.
+func expansionTerms(lm *stats.LanguageModel, lambda float64, n int) []string {
+	p := stats.JelinekMercerTermProbability(lambda)
+	terms := make([]string, 0, len(lm.TermCount))
+	for term := range lm.TermCount {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		pi, pj := p(*lm, terms[i]), p(*lm, terms[j])
+		if pi != pj {
+			return pi > pj
+		}
+		return terms[i] < terms[j]
+	})
+	if n < len(terms) {
+		terms = terms[:n]
+	}
+	return terms
+}
+
+func (queryFeedback) Name() string {
+	return "QueryFeedback"
+}
+
+func (queryFeedback) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	results, err := s.Execute(q, s.SearchOptions())
+	if err != nil {
+		return 0.0, err
+	}
+	k := parameter(s, ParameterK, DefaultK)
+	top := topK(results, k)
+	if len(top) == 0 {
+		return 0.0, nil
+	}
+
+	lm, err := relevanceModel(s, top)
+	if err != nil {
+		return 0.0, err
+	}
+	terms := expansionTerms(lm, parameter(s, ParameterLambda, 0.6), int(parameter(s, ParameterTerms, 100)))
+	if len(terms) == 0 {
+		return 0.0, nil
+	}
+	keywords := make([]cqr.CommonQueryRepresentation, len(terms))
+	for i, term := range terms {
+		keywords[i] = cqr.NewKeyword(term, fields.TitleAbstract)
+	}
+	expansion := q
+	expansion.Query = cqr.NewBooleanQuery(cqr.OR, keywords)
+
+	feedback, err := s.Execute(expansion, s.SearchOptions())
+	if err != nil {
+		return 0.0, err
+	}
+
+	retrieved := make(map[string]bool, len(top))
+	for _, result := range top {
+		retrieved[result.DocId] = true
+	}
+	overlap := 0.0
+	for _, result := range topK(feedback, k) {
+		if retrieved[result.DocId] {
+			overlap++
+		}
+	}
+	return overlap / float64(len(top)), nil
+}
+
+func (jensenShannonDivergence) Name() string {
+	return "JensenShannonDivergence"
+}
+
+func (jensenShannonDivergence) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	results, err := s.Execute(q, s.SearchOptions())
+	if err != nil {
+		return 0.0, err
+	}
+	top := topK(results, parameter(s, ParameterK, DefaultK))
+	if len(top) == 0 {
+		return 0.0, nil
+	}
+
+	docIds := make([]string, len(top))
+	for i, result := range top {
+		docIds[i] = result.DocId
+	}
+	lm, err := stats.NewLanguageModel(s, docIds, scores(top), "tiab")
+	if err != nil {
+		return 0.0, err
+	}
+
+	// Both models are normalised over the vocabulary of the top k documents so that they are distributions.
+	var pNorm, qNorm float64
+	for term := range lm.TermCount {
+		pNorm += lm.DocumentTermProbability(term)
+		qNorm += lm.CollectionTermProbability(term)
+	}
+	if pNorm == 0 || qNorm == 0 {
+		return 0.0, nil
+	}
+
+	kl := func(p, m float64) float64 {
+		if p == 0 {
+			return 0
+		}
+		return p * math.Log2(p/m)
+	}
+	jsd := 0.0
+	for term := range lm.TermCount {
+		p := lm.DocumentTermProbability(term) / pNorm
+		c := lm.CollectionTermProbability(term) / qNorm
+		m := (p + c) / 2
+		jsd += 0.5*kl(p, m) + 0.5*kl(c, m)
+	}
+	return jsd, nil
+}
+
+func (u utilityEstimation) Name() string {
+	return "UEF" + u.predictor.Name()
+}
+
+func (u utilityEstimation) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	results, err := s.Execute(q, s.SearchOptions())
+	if err != nil {
+		return 0.0, err
+	}
+	top := topK(results, parameter(s, ParameterK, DefaultK))
+	if len(top) < 2 {
+		return 0.0, nil
+	}
+
+	lm, err := relevanceModel(s, top)
+	if err != nil {
+		return 0.0, err
+	}
+	lambda := parameter(s, ParameterLambda, 0.6)
+	mu := parameter(s, ParameterMu, 2500)
+	p := stats.JelinekMercerTermProbability(lambda)
+	terms := expansionTerms(lm, lambda, int(parameter(s, ParameterTerms, 100)))
+
+	// Re-rank the top k documents by the cross entropy between the relevance model and each document.
+	reranked := make([]float64, len(top))
+	for i, result := range top {
+		tf, err := termFrequencies(s, result.DocId)
+		if err != nil {
+			return 0.0, err
+		}
+		length := 0.0
+		for _, f := range tf {
+			length += f
+		}
+		for _, term := range terms {
+			collection := math.Max(lm.CollectionTermProbability(term), 1e-10)
+			reranked[i] += p(*lm, term) * math.Log((tf[term]+mu*collection)/(length+mu))
+		}
+	}
+
+	similarity := stat.Correlation(scores(top), reranked, nil)
+	if math.IsNaN(similarity) {
+		return 0.0, nil
+	}
+
+	v, err := u.predictor.Execute(q, s)
+	if err != nil {
+		return 0.0, fmt.Errorf("%s: %v", u.predictor.Name(), err)
+	}
+	return similarity * v, nil
+}
@@ -12,10 +12,11 @@ type weightedInformationGain struct{}
 type weightedExpansionGain struct{}
 
 var (
-	// WeightedInformationGain aims to measure the weighted entropy of the top k ranked documents.
+	// WeightedInformationGain aims to measure the weighted entropy of the top k ranked documents. Parameters: k
+	// (default 100).
 	WeightedInformationGain = weightedInformationGain{}
 	// WeightedExpansionGain aims to analyse the quality of retrieved pseudo relevant documents by measuring the
-	// likelihood that they will have topic drift.
+	// likelihood that they will have topic drift. Parameters: k (default 100).
 	WeightedExpansionGain = weightedExpansionGain{}
 )
 
@@ -35,7 +36,7 @@ func (wig weightedInformationGain) Execute(q pipeline.Query, s stats.StatisticsS
 	D := results[len(results)-1].Score
 	totalScore := 0.0
 
-	k := s.Parameters()["k"]
+	k := parameter(s, ParameterK, DefaultK)
 	if float64(len(results)) < k {
 		k = float64(len(results))
 	}
@@ -74,7 +75,7 @@ func (weg weightedExpansionGain) Execute(q pipeline.Query, s stats.StatisticsSou
 		return 0.0, nil
 	}
 
-	k := s.Parameters()["k"]
+	k := parameter(s, ParameterK, DefaultK)
 	if float64(len(results)) < k {
 		k = float64(len(results))
 	}
@@ -0,0 +1,47 @@
+package postqpp
+
+import (
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/trecresults"
+)
+
+// Parameters of statistics sources that configure the post-retrieval predictors. A predictor uses its default value
+// for a parameter when the statistics source does not set it.
+const (
+	// ParameterK is the number of top-ranked documents that predictors consider (DefaultK by default).
+	ParameterK = "k"
+	// ParameterLambda is the Jelinek-Mercer smoothing of language models.
+	ParameterLambda = "lambda"
+	// ParameterMu is the Dirichlet smoothing of document language models.
+	ParameterMu = "mu"
+	// ParameterTerms is the number of terms of a relevance model (e.g. to expand a query with).
+	ParameterTerms = "terms"
+	// ParameterSamples is the number of times that top-ranked documents are sampled.
+	ParameterSamples = "samples"
+	// ParameterNeighbours is the number of most similar documents that scores are regularised with.
+	ParameterNeighbours = "neighbours"
+	// ParameterSeed is the seed used to sample documents.
+	ParameterSeed = "seed"
+)
+
+// DefaultK is the number of top-ranked documents that predictors consider when ParameterK is not set.
+const DefaultK = 100
+
+// parameter is the value of a parameter of a statistics source, or the default value if it is not set.
+func parameter(s stats.StatisticsSource, name string, value float64) float64 {
+	if v, ok := s.Parameters()[name]; ok {
+		return v
+	}
+	return value
+}
+
+// topK is the top k results, or all of the results if there are less than k.
+func topK(results trecresults.ResultList, k float64) trecresults.ResultList {
+	if k < 1 {
+		k = 1
+	}
+	if int(k) < len(results) {
+		return results[:int(k)]
+	}
+	return results
+}
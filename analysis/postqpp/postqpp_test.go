@@ -0,0 +1,190 @@
+package postqpp_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis/postqpp"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/trecresults"
+	"math"
+	"strings"
+	"testing"
+)
+
+// stubSource is a statistics source that retrieves the same documents for every query. The documents are a list of
+// terms, each of which occurs once.
+type stubSource struct {
+	stats.StatisticsSource
+	docs       map[string]string
+	results    trecresults.ResultList
+	parameters map[string]float64
+}
+
+// newStubSource creates a stub source that retrieves documents in order with the specified scores.
+func newStubSource(parameters map[string]float64, docs []string, scores ...float64) stubSource {
+	s := stubSource{docs: make(map[string]string), parameters: parameters}
+	for i, doc := range docs {
+		id := string(rune('a' + i))
+		s.docs[id] = doc
+		s.results = append(s.results, &trecresults.Result{DocId: id, Score: scores[i], Rank: int64(i + 1)})
+	}
+	return s
+}
+
+func (s stubSource) SearchOptions() stats.SearchOptions {
+	return stats.SearchOptions{Size: len(s.results)}
+}
+
+func (s stubSource) Parameters() map[string]float64 {
+	return s.parameters
+}
+
+func (s stubSource) TermVector(document string) (stats.TermVector, error) {
+	var tv stats.TermVector
+	for _, term := range strings.Fields(s.docs[document]) {
+		ttf := 0.0
+		for _, doc := range s.docs {
+			ttf += float64(strings.Count(doc, term))
+		}
+		tv = append(tv, stats.TermVectorTerm{Term: term, Field: "tiab", TermFrequency: 1, TotalTermFrequency: ttf})
+	}
+	return tv, nil
+}
+
+func (s stubSource) VocabularySize(field string) (float64, error) {
+	return 100, nil
+}
+
+func (s stubSource) Execute(query pipeline.Query, options stats.SearchOptions) (trecresults.ResultList, error) {
+	return s.results, nil
+}
+
+type constantPredictor struct{}
+
+func (constantPredictor) Name() string {
+	return "Constant"
+}
+
+func (constantPredictor) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	return 2, nil
+}
+
+var q = pipeline.NewQuery("1", "1", cqr.NewKeyword("cancer", "tiab"))
+
+func TestScoreMagnitudeVariance(t *testing.T) {
+	s := newStubSource(nil, []string{"a", "b", "c"}, 4, 2, 1)
+	v, err := postqpp.ScoreMagnitudeVariance.Execute(q, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(v-1.1038617) > 1e-6 {
+		t.Errorf("expected SMV of 1.1038617, got %f", v)
+	}
+}
+
+func TestRobustStandardDeviation(t *testing.T) {
+	v, err := postqpp.RobustStandardDeviation.Execute(q, newStubSource(nil, []string{"a", "b", "c"}, 2, 2, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 0 {
+		t.Errorf("expected no deviation of equal scores, got %f", v)
+	}
+
+	s := newStubSource(map[string]float64{postqpp.ParameterSeed: 1}, []string{"a", "b", "c"}, 4, 2, 1)
+	v, err = postqpp.RobustStandardDeviation.Execute(q, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v <= 0 {
+		t.Errorf("expected a deviation of different scores, got %f", v)
+	}
+	// Samples are drawn with a seed, so the deviation is the same each time.
+	if w, _ := postqpp.RobustStandardDeviation.Execute(q, s); w != v {
+		t.Errorf("expected the same deviation with the same seed, got %f and %f", v, w)
+	}
+}
+
+func TestAutocorrelation(t *testing.T) {
+	// The most similar document of each document is the document with the next closest score.
+	s := newStubSource(map[string]float64{postqpp.ParameterNeighbours: 1}, []string{"x y", "x y", "z w", "z w"}, 4, 3, 2, 1)
+	v, err := postqpp.Autocorrelation.Execute(q, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(v-0.6) > 1e-9 {
+		t.Errorf("expected an autocorrelation of 0.6, got %f", v)
+	}
+
+	v, err = postqpp.Autocorrelation.Execute(q, newStubSource(nil, []string{"x", "y"}, 2, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 0 {
+		t.Errorf("expected no autocorrelation of less than three documents, got %f", v)
+	}
+}
+
+func TestQueryFeedback(t *testing.T) {
+	// The stub source retrieves the same documents for the expanded query, so they overlap completely.
+	for _, scores := range [][]float64{{3, 2, 1}, {1, 0, -1}, {-1, -2, -3}} {
+		s := newStubSource(map[string]float64{postqpp.ParameterTerms: 2}, []string{"x x y", "x y", "z"}, scores...)
+		v, err := postqpp.QueryFeedback.Execute(q, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != 1 {
+			t.Errorf("expected complete overlap for scores %v, got %f", scores, v)
+		}
+	}
+}
+
+func TestJensenShannonDivergence(t *testing.T) {
+	s := newStubSource(nil, []string{"x x y", "x y", "z"}, 3, 2, 1)
+	v, err := postqpp.JensenShannonDivergence.Execute(q, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v <= 0 || v > 1 {
+		t.Errorf("expected a divergence in (0, 1], got %f", v)
+	}
+
+	v, err = postqpp.JensenShannonDivergence.Execute(q, newStubSource(nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 0 {
+		t.Errorf("expected no divergence without documents, got %f", v)
+	}
+}
+
+func TestUtilityEstimation(t *testing.T) {
+	uef := postqpp.UtilityEstimation(constantPredictor{})
+	if uef.Name() != "UEFConstant" {
+		t.Errorf("expected the name of the predictor, got %s", uef.Name())
+	}
+
+	// The documents with the highest scores are the most similar to the relevance model, and the weights of the
+	// documents stay in the order of their scores when the mean score is zero or the scores are negative.
+	for _, scores := range [][]float64{{3, 2, 1}, {1, 0, -1}, {-1, -2, -3}} {
+		s := newStubSource(map[string]float64{postqpp.ParameterTerms: 2}, []string{"x x y", "x y", "z"}, scores...)
+		v, err := uef.Execute(q, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v <= 0 || v > 2 {
+			t.Errorf("expected the predictor to be scaled by a positive similarity for scores %v, got %f", scores, v)
+		}
+	}
+}
+
+func TestWeightedInformationGain(t *testing.T) {
+	// Without k, the predictor considers every document when fewer than the default are retrieved.
+	v, err := postqpp.WeightedInformationGain.Execute(q, newStubSource(nil, []string{"a", "b", "c"}, 4, 2, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(v-4.0/3) > 1e-9 {
+		t.Errorf("expected WIG of 4/3, got %f", v)
+	}
+}
@@ -0,0 +1,212 @@
+package postqpp
+
+import (
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/trecresults"
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/stat"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+type scoreMagnitudeVariance struct{}
+type robustStandardDeviation struct{}
+type autocorrelation struct{}
+
+var (
+	// ScoreMagnitudeVariance (SMV) aims to measure both the magnitude and the variance of the scores of the top k
+	// ranked documents (Tao and Wu, 2014). As in NQC, scores are normalised by the score of the last retrieved document
+	// in place of the score of the collection. Parameters: k (default 100).
+	ScoreMagnitudeVariance = scoreMagnitudeVariance{}
+	// RobustStandardDeviation (RSD) aims to measure the standard deviation of the scores of the top k ranked
+	// documents, robustly estimated as the mean over samples of the top k documents, drawn in proportion to their
+	// scores (Roitman, 2017). Parameters: k (default 100), samples (default 100), and seed (default 0).
+	RobustStandardDeviation = robustStandardDeviation{}
+	// Autocorrelation aims to measure how consistently similar documents in the top k are scored, as the correlation
+	// between the scores of documents and the scores regularised by their most similar neighbours (Diaz, 2007).
+	// Parameters: k (default 100) and neighbours (default 5).
+	Autocorrelation = autocorrelation{}
+)
+
+// scores extracts the scores of results.
+func scores(results trecresults.ResultList) []float64 {
+	s := make([]float64, len(results))
+	for i, result := range results {
+		s[i] = result.Score
+	}
+	return s
+}
+
+func (scoreMagnitudeVariance) Name() string {
+	return "SMV"
+}
+
+func (scoreMagnitudeVariance) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	results, err := s.Execute(q, s.SearchOptions())
+	if err != nil {
+		return 0.0, err
+	}
+	if len(results) == 0 {
+		return 0.0, nil
+	}
+
+	D := results[len(results)-1].Score
+	top := scores(topK(results, parameter(s, ParameterK, DefaultK)))
+	mu := stat.Mean(top, nil)
+	if D <= 0 || mu <= 0 {
+		return 0.0, nil
+	}
+
+	smv := 0.0
+	for _, score := range top {
+		if score > 0 {
+			smv += score * math.Abs(math.Log(score/mu))
+		}
+	}
+	return smv / (float64(len(top)) * D), nil
+}
+
+func (robustStandardDeviation) Name() string {
+	return "RSD"
+}
+
+func (robustStandardDeviation) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	results, err := s.Execute(q, s.SearchOptions())
+	if err != nil {
+		return 0.0, err
+	}
+	if len(results) == 0 {
+		return 0.0, nil
+	}
+
+	D := results[len(results)-1].Score
+	top := scores(topK(results, parameter(s, ParameterK, DefaultK)))
+	samples := int(parameter(s, ParameterSamples, 100))
+	if samples < 1 {
+		samples = 1
+	}
+
+	// Documents are drawn in proportion to their scores, shifted so that every document can be drawn.
+	min := floats.Min(top)
+	cumulative := make([]float64, len(top))
+	total := 0.0
+	for i, score := range top {
+		total += score - min + 1e-6
+		cumulative[i] = total
+	}
+
+	r := rand.New(rand.NewSource(int64(parameter(s, ParameterSeed, 0))))
+	sample := make([]float64, len(top))
+	rsd := 0.0
+	for i := 0; i < samples; i++ {
+		for j := range sample {
+			sample[j] = top[sort.SearchFloat64s(cumulative, r.Float64()*total)]
+		}
+		if len(sample) > 1 {
+			rsd += stat.StdDev(sample, nil)
+		}
+	}
+	rsd /= float64(samples)
+
+	if D > 0 {
+		return rsd / D, nil
+	}
+	return rsd, nil
+}
+
+func (autocorrelation) Name() string {
+	return "Autocorrelation"
+}
+
+// cosine is the cosine similarity of two term frequency vectors.
+func cosine(a, b map[string]float64) float64 {
+	var dot, na, nb float64
+	for term, x := range a {
+		dot += x * b[term]
+		na += x * x
+	}
+	for _, y := range b {
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// termFrequencies is the frequency of the terms of a document, summed over fields.
+func termFrequencies(s stats.StatisticsSource, document string) (map[string]float64, error) {
+	tv, err := s.TermVector(document)
+	if err != nil {
+		return nil, err
+	}
+	tf := make(map[string]float64, len(tv))
+	for _, term := range tv {
+		tf[term.Term] += term.TermFrequency
+	}
+	return tf, nil
+}
+
+func (autocorrelation) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	results, err := s.Execute(q, s.SearchOptions())
+	if err != nil {
+		return 0.0, err
+	}
+	top := topK(results, parameter(s, ParameterK, DefaultK))
+	if len(top) < 3 {
+		return 0.0, nil
+	}
+
+	tfs := make([]map[string]float64, len(top))
+	for i, result := range top {
+		tfs[i], err = termFrequencies(s, result.DocId)
+		if err != nil {
+			return 0.0, err
+		}
+	}
+
+	neighbours := int(parameter(s, ParameterNeighbours, 5))
+	if neighbours > len(top)-1 {
+		neighbours = len(top) - 1
+	}
+	if neighbours < 1 {
+		neighbours = 1
+	}
+
+	original := scores(top)
+	regularised := make([]float64, len(top))
+	for i := range top {
+		type neighbour struct {
+			j   int
+			sim float64
+		}
+		var nn []neighbour
+		for j := range top {
+			if i != j {
+				nn = append(nn, neighbour{j, cosine(tfs[i], tfs[j])})
+			}
+		}
+		sort.SliceStable(nn, func(a, b int) bool {
+			return nn[a].sim > nn[b].sim
+		})
+
+		var score, norm float64
+		for _, n := range nn[:neighbours] {
+			score += n.sim * original[n.j]
+			norm += n.sim
+		}
+		if norm > 0 {
+			regularised[i] = score / norm
+		} else {
+			regularised[i] = original[i]
+		}
+	}
+
+	r := stat.Correlation(original, regularised, nil)
+	if math.IsNaN(r) {
+		return 0.0, nil
+	}
+	return r, nil
+}
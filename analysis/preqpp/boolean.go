@@ -0,0 +1,188 @@
+package preqpp
+
+import (
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"gonum.org/v1/gonum/floats"
+	"math"
+	"strings"
+)
+
+// clauseOperator normalises the operator of a Boolean clause; adjacency operators are treated as AND.
+func clauseOperator(q cqr.BooleanQuery) string {
+	op := strings.ToLower(strings.TrimSpace(q.Operator))
+	if strings.Contains(op, "adj") {
+		return cqr.AND
+	}
+	return op
+}
+
+// clauseStatistic computes a statistic of a Boolean query by computing the statistic of each keyword, and combining the
+// statistics of the children of each clause according to its operator.
+func clauseStatistic(r cqr.CommonQueryRepresentation, keyword func(cqr.Keyword) (float64, error), combine func(operator string, values []float64) float64) (float64, error) {
+	switch q := r.(type) {
+	case cqr.Keyword:
+		return keyword(q)
+	case cqr.BooleanQuery:
+		values := make([]float64, 0, len(q.Children))
+		for _, child := range q.Children {
+			v, err := clauseStatistic(child, keyword, combine)
+			if err != nil {
+				return 0, err
+			}
+			values = append(values, v)
+		}
+		if len(values) == 0 {
+			return 0, nil
+		}
+		return combine(clauseOperator(q), values), nil
+	}
+	return 0, fmt.Errorf("unknown query type %T", r)
+}
+
+// combineProbabilities combines the probabilities that documents match the children of a clause, assuming that the
+// children are independent.
+func combineProbabilities(operator string, p []float64) float64 {
+	switch operator {
+	case cqr.OR:
+		q := 1.0
+		for _, v := range p {
+			q *= 1 - v
+		}
+		return 1 - q
+	case cqr.NOT:
+		q := p[0]
+		for _, v := range p[1:] {
+			q *= 1 - v
+		}
+		return q
+	default:
+		q := 1.0
+		for _, v := range p {
+			q *= v
+		}
+		return q
+	}
+}
+
+// estimateRetrievalSize estimates the number of documents a query retrieves from the document frequency of each
+// keyword (in any of its fields), assuming that keywords occur independently of each other.
+func estimateRetrievalSize(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	N, err := s.CollectionSize()
+	if err != nil {
+		return 0.0, err
+	}
+	if N == 0 {
+		return 0.0, nil
+	}
+	p, err := clauseStatistic(q.Query, func(k cqr.Keyword) (float64, error) {
+		fields := make([]float64, len(k.Fields))
+		for i, field := range k.Fields {
+			df, err := s.DocumentFrequency(k.QueryString, field)
+			if err != nil {
+				return 0.0, err
+			}
+			fields[i] = math.Min(df/N, 1)
+		}
+		if len(fields) == 0 {
+			return 0.0, nil
+		}
+		return combineProbabilities(cqr.OR, fields), nil
+	}, combineProbabilities)
+	if err != nil {
+		return 0.0, err
+	}
+	return p * N, nil
+}
+
+type booleanRetrievalSizeEstimate struct{}
+type booleanIndependenceRatio struct{}
+type booleanIDF struct {
+	name string
+	or   func([]float64) float64
+}
+
+var (
+	// BooleanRetrievalSizeEstimate is the estimated number of documents a Boolean query retrieves, computed from the
+	// document frequency of each keyword following the structure of the query, and assuming that keywords occur
+	// independently of each other.
+	BooleanRetrievalSizeEstimate = booleanRetrievalSizeEstimate{}
+	// BooleanIndependenceRatio is the ratio of the estimated number of documents a Boolean query retrieves (see
+	// BooleanRetrievalSizeEstimate) to the actual number of documents it retrieves. Since the keywords of the
+	// clauses of a query are rarely independent, this measures how correlated (ratio < 1) or exclusive (ratio > 1)
+	// the intersected clauses of a query are. The estimate is computed from the document frequency of keywords in
+	// the whole collection, so it is compared to the number of documents the query retrieves without its date
+	// restriction.
+	BooleanIndependenceRatio = booleanIndependenceRatio{}
+	// BooleanMaxIDF is the IDF of a Boolean query following its structure: the IDF of AND clauses is the sum of the
+	// IDF of their children, and the IDF of OR clauses is the maximum IDF of their children.
+	BooleanMaxIDF = booleanIDF{name: "BooleanMaxIDF", or: floats.Max}
+	// BooleanMinIDF is the IDF of a Boolean query following its structure: the IDF of AND clauses is the sum of the
+	// IDF of their children, and the IDF of OR clauses is the minimum IDF of their children.
+	BooleanMinIDF = booleanIDF{name: "BooleanMinIDF", or: floats.Min}
+	// BooleanAvgIDF is the IDF of a Boolean query following its structure: the IDF of AND clauses is the sum of the
+	// IDF of their children, and the IDF of OR clauses is the average IDF of their children.
+	BooleanAvgIDF = booleanIDF{name: "BooleanAvgIDF", or: func(v []float64) float64 {
+		return floats.Sum(v) / float64(len(v))
+	}}
+)
+
+func (booleanRetrievalSizeEstimate) Name() string {
+	return "BooleanRetrievalSizeEstimate"
+}
+
+func (booleanRetrievalSizeEstimate) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	return estimateRetrievalSize(q, s)
+}
+
+func (booleanIndependenceRatio) Name() string {
+	return "BooleanIndependenceRatio"
+}
+
+func (booleanIndependenceRatio) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	estimate, err := estimateRetrievalSize(q, s)
+	if err != nil {
+		return 0.0, err
+	}
+	actual, err := s.RetrievalSize(q.Query)
+	if err != nil {
+		return 0.0, err
+	}
+	if actual == 0 {
+		return 0.0, nil
+	}
+	return estimate / actual, nil
+}
+
+func (b booleanIDF) Name() string {
+	return b.name
+}
+
+func (b booleanIDF) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	return clauseStatistic(q.Query, func(k cqr.Keyword) (float64, error) {
+		fields := make([]float64, len(k.Fields))
+		for i, field := range k.Fields {
+			idf, err := s.InverseDocumentFrequency(k.QueryString, field)
+			if err != nil {
+				return 0.0, err
+			}
+			fields[i] = idf
+		}
+		if len(fields) == 0 {
+			return 0.0, nil
+		}
+		return b.or(fields), nil
+	}, func(operator string, idf []float64) float64 {
+		switch operator {
+		case cqr.OR:
+			return b.or(idf)
+		case cqr.NOT:
+			// Excluding documents does not change the specificity of the retrieved documents.
+			return idf[0]
+		default:
+			return floats.Sum(idf)
+		}
+	})
+}
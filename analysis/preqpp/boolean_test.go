@@ -0,0 +1,152 @@
+package preqpp_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis/preqpp"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/transmute/fields"
+	"math"
+	"testing"
+)
+
+// dfSource is a statistics source of a collection of 1000 documents, in which every query retrieves 10 documents,
+// or 5 documents when the query is restricted by date.
+type dfSource struct {
+	stats.StatisticsSource
+	df map[string]float64
+}
+
+func (s dfSource) DocumentFrequency(term, field string) (float64, error) {
+	if field == "ab" {
+		return s.df[term] / 2, nil
+	}
+	return s.df[term], nil
+}
+
+func (s dfSource) InverseDocumentFrequency(term, field string) (float64, error) {
+	return math.Log(1000 / s.df[term]), nil
+}
+
+func (s dfSource) CollectionSize() (float64, error) {
+	return 1000, nil
+}
+
+func (s dfSource) RetrievalSize(query cqr.CommonQueryRepresentation) (float64, error) {
+	if q, ok := query.(cqr.BooleanQuery); ok && len(q.Children) == 2 {
+		if k, ok := q.Children[1].(cqr.Keyword); ok && k.Fields[0] == fields.PublicationDate {
+			return 5, nil
+		}
+	}
+	return 10, nil
+}
+
+var source = dfSource{df: map[string]float64{"a": 100, "b": 50, "c": 10}}
+
+func boolean(operator string, keywords ...string) pipeline.Query {
+	children := make([]cqr.CommonQueryRepresentation, len(keywords))
+	for i, keyword := range keywords {
+		children[i] = cqr.NewKeyword(keyword, "ti")
+	}
+	return pipeline.NewQuery("1", "1", cqr.NewBooleanQuery(operator, children))
+}
+
+func TestBooleanRetrievalSizeEstimate(t *testing.T) {
+	for _, c := range []struct {
+		query    pipeline.Query
+		expected float64
+	}{
+		// p(a) = 0.1, p(b) = 0.05, and p(c) = 0.01.
+		{boolean(cqr.AND, "a", "b"), 5},
+		{boolean(cqr.OR, "a", "b"), 145},
+		{boolean(cqr.NOT, "a", "b", "c"), 94.05},
+		// Adjacency is estimated as an intersection.
+		{boolean("adj3", "a", "b"), 5},
+		// The fields of a keyword are combined as alternatives: p(a in ti or ab) = 1 - 0.9 * 0.95.
+		{pipeline.NewQuery("1", "1", cqr.NewKeyword("a", "ti", "ab")), 145},
+		{pipeline.NewQuery("1", "1", cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("a", "ti"),
+			cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{cqr.NewKeyword("b", "ti"), cqr.NewKeyword("c", "ti")}),
+		})), 5.95},
+	} {
+		v, err := preqpp.BooleanRetrievalSizeEstimate.Execute(c.query, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(v-c.expected) > 1e-9 {
+			t.Errorf("expected %v to retrieve %v documents, got %v", c.query.Query, c.expected, v)
+		}
+	}
+}
+
+func TestBooleanIndependenceRatio(t *testing.T) {
+	q := boolean(cqr.AND, "a", "b")
+	d, err := pipeline.ParseDateRestriction("1990", "2000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The estimate is compared to the number of documents retrieved without the date restriction.
+	for _, query := range []pipeline.Query{q, q.SetDateRestriction(d)} {
+		v, err := preqpp.BooleanIndependenceRatio.Execute(query, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(v-0.5) > 1e-9 {
+			t.Errorf("expected a ratio of 0.5, got %v", v)
+		}
+	}
+}
+
+func TestBooleanIDF(t *testing.T) {
+	idf := func(term string) float64 {
+		return math.Log(1000 / source.df[term])
+	}
+	for _, c := range []struct {
+		query    pipeline.Query
+		max, min float64
+	}{
+		{boolean(cqr.AND, "a", "b"), idf("a") + idf("b"), idf("a") + idf("b")},
+		{boolean("adj3", "a", "b"), idf("a") + idf("b"), idf("a") + idf("b")},
+		{boolean(cqr.OR, "a", "b"), idf("b"), idf("a")},
+		// Excluding documents does not change the IDF.
+		{boolean(cqr.NOT, "a", "c"), idf("a"), idf("a")},
+	} {
+		max, err := preqpp.BooleanMaxIDF.Execute(c.query, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		min, err := preqpp.BooleanMinIDF.Execute(c.query, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(max-c.max) > 1e-9 || math.Abs(min-c.min) > 1e-9 {
+			t.Errorf("expected the IDF of %v to be %v and %v, got %v and %v", c.query.Query, c.max, c.min, max, min)
+		}
+	}
+}
+
+func TestIDFProfile(t *testing.T) {
+	q := pipeline.NewQuery("1", "1", cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("a", "ti", "ab"),
+		cqr.NewKeyword("a", "mh"),
+	}))
+	r, err := preqpp.IDFProfile.ExecuteStructured(q, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same query string in different fields is kept apart.
+	if len(r.Maps["idf"]) != 3 || r.Maps["idf"]["ti:a"] != r.Maps["idf"]["mh:a"] {
+		t.Errorf("expected the IDF of a in each field, got %v", r.Maps["idf"])
+	}
+	if len(r.Vectors["idf"]) != 2 || r.Annotations["/0"]["idf"] != r.Annotations["/1"]["idf"] {
+		t.Errorf("expected the IDF of each keyword, got %v and %v", r.Vectors["idf"], r.Annotations)
+	}
+
+	r, err = preqpp.IDFProfile.ExecuteStructured(pipeline.NewQuery("1", "1", cqr.NewBooleanQuery(cqr.AND, nil)), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Empty() {
+		t.Errorf("expected an empty profile without keywords, got %v", r)
+	}
+}
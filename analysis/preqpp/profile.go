@@ -0,0 +1,60 @@
+package preqpp
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"gonum.org/v1/gonum/floats"
+	"sort"
+)
+
+type idfProfile struct{}
+
+// IDFProfile is the IDF of each keyword of a query. The result contains the IDF of the query string of each keyword
+// in each of its fields (in the `idf` map, keyed by `<field>:<query string>`), the IDF of each keyword (annotating
+// each keyword node), the sorted IDF of the keywords (the `idf` vector), and the minimum, maximum, and average IDF.
+// The IDF of a keyword in several fields is the average IDF of the keyword in each field. A query without keywords
+// has an empty profile.
+var IDFProfile = idfProfile{}
+
+func (idfProfile) Name() string {
+	return "IDFProfile"
+}
+
+func (idfProfile) ExecuteStructured(q pipeline.Query, s stats.StatisticsSource) (pipeline.MeasurementResult, error) {
+	var r pipeline.MeasurementResult
+	var profile []float64
+	err := analysis.WalkQuery(q.Query, func(path string, node cqr.CommonQueryRepresentation) error {
+		k, ok := node.(cqr.Keyword)
+		if !ok || len(k.Fields) == 0 {
+			return nil
+		}
+		sumIDF := 0.0
+		for _, field := range k.Fields {
+			idf, err := s.InverseDocumentFrequency(k.QueryString, field)
+			if err != nil {
+				return err
+			}
+			r.SetMap("idf", field+":"+k.QueryString, idf)
+			sumIDF += idf
+		}
+		idf := sumIDF / float64(len(k.Fields))
+		r.Annotate(path, "idf", idf)
+		profile = append(profile, idf)
+		return nil
+	})
+	if err != nil {
+		return pipeline.MeasurementResult{}, err
+	}
+	if len(profile) == 0 {
+		return r, nil
+	}
+
+	sort.Float64s(profile)
+	r.SetVector("idf", profile)
+	r.SetValue("min", profile[0])
+	r.SetValue("max", profile[len(profile)-1])
+	r.SetValue("avg", floats.Sum(profile)/float64(len(profile)))
+	return r, nil
+}
@@ -20,7 +20,7 @@ func (qs queryScope) Name() string {
 }
 
 func (qs queryScope) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
-	Nq, err := s.RetrievalSize(q.Query)
+	Nq, err := stats.RetrievalSize(s, q)
 	if err != nil {
 		return 0.0, err
 	}
@@ -15,5 +15,5 @@ func (retrievalSize) Name() string {
 }
 
 func (retrievalSize) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
-	return s.RetrievalSize(q.Query)
+	return stats.RetrievalSize(s, q)
 }
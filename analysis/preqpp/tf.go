@@ -17,12 +17,12 @@ func (tf TF) Name() string {
 
 func (tf TF) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
 
-	e, ok := s.(stats.EntrezStatisticsSource)
+	e, ok := stats.Unwrap(s).(stats.EntrezStatisticsSource)
 	if !ok {
 		return 0, nil
 	}
 
-	results, err := e.Execute(q, s.SearchOptions())
+	results, err := s.Execute(q, s.SearchOptions())
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,145 @@
+// Package qppeval evaluates query performance predictors: how well the values of a predictor (an
+// analysis.Measurement) for each topic correlate with the retrieval effectiveness of the topic (an eval.Evaluator).
+package qppeval
+
+import (
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+	"math"
+	"sort"
+)
+
+// Correlation is a correlation coefficient, and the bounds of its confidence interval.
+type Correlation struct {
+	Coefficient float64
+	Low         float64
+	High        float64
+	N           int
+}
+
+// Correlator computes a correlation coefficient. Confidence intervals are computed using the Fisher transformation
+// of the coefficient, with the standard error of the transformed coefficient for n observations.
+type Correlator struct {
+	Name        string
+	Coefficient func(x, y []float64) float64
+	StdErr      func(n int) float64
+}
+
+var (
+	// Pearson is Pearson's linear correlation coefficient.
+	Pearson = Correlator{
+		Name: "pearson",
+		Coefficient: func(x, y []float64) float64 {
+			return stat.Correlation(x, y, nil)
+		},
+		StdErr: func(n int) float64 {
+			return math.Sqrt(1 / float64(n-3))
+		},
+	}
+	// Spearman is Spearman's rank correlation coefficient. The standard error is that of Fieller et al. (1957).
+	Spearman = Correlator{
+		Name: "spearman",
+		Coefficient: func(x, y []float64) float64 {
+			return stat.Correlation(ranks(x), ranks(y), nil)
+		},
+		StdErr: func(n int) float64 {
+			return math.Sqrt(1.06 / float64(n-3))
+		},
+	}
+	// Kendall is Kendall's tau-b rank correlation coefficient. The standard error is that of Fieller et al. (1957).
+	Kendall = Correlator{
+		Name:        "kendall",
+		Coefficient: kendall,
+		StdErr: func(n int) float64 {
+			return math.Sqrt(0.437 / float64(n-4))
+		},
+	}
+)
+
+// Correlate computes the correlation between x and y. If confidence is non-zero, the bounds of the confidence
+// interval at that level (e.g. 0.95) are computed, otherwise they are NaN. They are also NaN when there are too few
+// observations for an interval.
+func (c Correlator) Correlate(x, y []float64, confidence float64) Correlation {
+	r := Correlation{Coefficient: math.NaN(), Low: math.NaN(), High: math.NaN(), N: len(x)}
+	if len(x) < 2 || len(x) != len(y) {
+		return r
+	}
+	r.Coefficient = c.Coefficient(x, y)
+	if confidence <= 0 || math.IsNaN(r.Coefficient) {
+		return r
+	}
+	se := c.StdErr(len(x))
+	if se <= 0 || math.IsNaN(se) || math.IsInf(se, 0) {
+		return r
+	}
+	z := math.Atanh(math.Max(-1+1e-12, math.Min(1-1e-12, r.Coefficient)))
+	crit := distuv.UnitNormal.Quantile(1 - (1-confidence)/2)
+	r.Low, r.High = math.Tanh(z-crit*se), math.Tanh(z+crit*se)
+	return r
+}
+
+// ranks are the fractional ranks of values, i.e. tied values share the mean of their ranks. Ranks start at 1.
+func ranks(values []float64) []float64 {
+	idx := make([]int, len(values))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return values[idx[i]] < values[idx[j]]
+	})
+	r := make([]float64, len(values))
+	for i := 0; i < len(idx); {
+		j := i
+		for j+1 < len(idx) && values[idx[j+1]] == values[idx[i]] {
+			j++
+		}
+		rank := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			r[idx[k]] = rank
+		}
+		i = j + 1
+	}
+	return r
+}
+
+// kendall computes Kendall's tau-b, which accounts for ties in either variable.
+func kendall(x, y []float64) float64 {
+	var concordant, discordant, tiesX, tiesY float64
+	for i := 0; i < len(x); i++ {
+		for j := i + 1; j < len(x); j++ {
+			dx, dy := x[i]-x[j], y[i]-y[j]
+			switch {
+			case dx == 0 && dy == 0:
+			case dx == 0:
+				tiesX++
+			case dy == 0:
+				tiesY++
+			case (dx > 0) == (dy > 0):
+				concordant++
+			default:
+				discordant++
+			}
+		}
+	}
+	d := math.Sqrt((concordant + discordant + tiesX) * (concordant + discordant + tiesY))
+	if d == 0 {
+		return math.NaN()
+	}
+	return (concordant - discordant) / d
+}
+
+// SMARE is the scaled mean absolute rank error (Faggioli et al., 2021) of predicted values compared to the actual
+// values, i.e. the mean difference between the rank of each topic by the predictor and by its effectiveness, scaled
+// by the number of topics. Lower is better, and zero is a perfect prediction of the ranking of topics.
+func SMARE(predicted, actual []float64) float64 {
+	if len(predicted) == 0 || len(predicted) != len(actual) {
+		return math.NaN()
+	}
+	p, a := ranks(predicted), ranks(actual)
+	var sum float64
+	for i := range p {
+		sum += math.Abs(p[i] - a[i])
+	}
+	n := float64(len(p))
+	return sum / (n * n)
+}
@@ -0,0 +1,180 @@
+package qppeval
+
+import (
+	"fmt"
+	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"log"
+	"math"
+	"sort"
+)
+
+// CombinedPredictor is the name of the predictor that linearly combines every other predictor (see CrossValidate).
+const CombinedPredictor = "LinearRegression"
+
+// EvaluationOptions are the options for evaluating predictors.
+type EvaluationOptions struct {
+	// Correlators are the correlation coefficients that are computed (by default, Pearson, Spearman and Kendall).
+	Correlators []Correlator
+	// Confidence is the confidence level of intervals around the coefficients (e.g. 0.95). Zero disables intervals.
+	Confidence float64
+	// Folds is the number of folds used to combine predictors (see CrossValidate). Zero disables the combination.
+	Folds int
+	// Seed is the seed used to assign topics to folds.
+	Seed int64
+}
+
+// Correlators sets the correlation coefficients that are computed.
+func Correlators(correlators ...Correlator) func(*EvaluationOptions) {
+	return func(o *EvaluationOptions) {
+		o.Correlators = correlators
+	}
+}
+
+// ConfidenceInterval computes confidence intervals around the coefficients at the specified level.
+func ConfidenceInterval(level float64) func(*EvaluationOptions) {
+	return func(o *EvaluationOptions) {
+		o.Confidence = level
+	}
+}
+
+// CombinePredictors combines the predictors with a linear model using k-fold cross validation, which is evaluated
+// as the CombinedPredictor.
+func CombinePredictors(k int, seed int64) func(*EvaluationOptions) {
+	return func(o *EvaluationOptions) {
+		o.Folds = k
+		o.Seed = seed
+	}
+}
+
+// Predict computes the predictors for each query, keyed by the topic of the query and the name of the predictor. The
+// predictors are computed concurrently, up to the number of workers of the executor. Predictions are correlated with
+// the evaluation of each topic, so an error is returned if more than one query has the same topic.
+func Predict(executor analysis.MeasurementExecutor, queries []pipeline.Query, ss stats.StatisticsSource, predictors ...analysis.Measurement) (map[string]map[string]float64, error) {
+	seen := make(map[string]string, len(queries))
+	for _, query := range queries {
+		if other, ok := seen[query.Topic]; ok {
+			return nil, fmt.Errorf("topic %s has more than one query (%s and %s)", query.Topic, other, query.Name)
+		}
+		seen[query.Topic] = query.Name
+	}
+
+	values, err := executor.ExecuteQueries(queries, ss, predictors...)
+	if err != nil {
+		return nil, err
+	}
+	predictions := make(map[string]map[string]float64, len(queries))
+	for j, query := range queries {
+		predictions[query.Topic] = make(map[string]float64, len(predictors))
+		for i, predictor := range predictors {
+			predictions[query.Topic][predictor.Name()] = values[j][i]
+		}
+	}
+	return predictions, nil
+}
+
+// lookup is the value of a topic for a measure, if it exists and is a number.
+func lookup(values map[string]map[string]float64, topic, measure string) (float64, bool) {
+	v, ok := values[topic][measure]
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// pairs are the values of a predictor and an evaluation measure for the topics that have both.
+func pairs(predictions, scores map[string]map[string]float64, predictor, measure string) (x, y []float64) {
+	topics := make([]string, 0, len(predictions))
+	for topic := range predictions {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		p, ok := lookup(predictions, topic, predictor)
+		if !ok {
+			continue
+		}
+		s, ok := lookup(scores, topic, measure)
+		if !ok {
+			continue
+		}
+		x = append(x, p)
+		y = append(y, s)
+	}
+	return
+}
+
+// names extracts the sorted set of names from values keyed by topic.
+func names(values map[string]map[string]float64) []string {
+	seen := make(map[string]bool)
+	var n []string
+	for _, topic := range values {
+		for name := range topic {
+			if !seen[name] {
+				seen[name] = true
+				n = append(n, name)
+			}
+		}
+	}
+	sort.Strings(n)
+	return n
+}
+
+// Evaluate correlates the predictions for each topic (keyed by the topic and the name of the predictor, see
+// Predict) with the evaluation of each topic (keyed by the topic and the name of the evaluation measure, as in the
+// results of eval.Evaluate). Topics missing either value are ignored.
+//
+// The results are keyed by the name of the predictor, and contain `<measure>_<correlator>` for each correlation
+// coefficient (with `_ci_low` and `_ci_high` suffixes for confidence intervals), and `<measure>_smare` for sMARE, so
+// that they can be formatted with an output.EvaluationFormatter. The rows of the results are predictors rather than
+// topics, so the mean of each row is meaningless and should be omitted (see output.EvaluationOmitMean).
+//
+// When the predictors cannot be combined for a measure (e.g. the linear model is singular), the combined predictor
+// is not evaluated for that measure, and the reason is logged.
+func Evaluate(predictions, scores map[string]map[string]float64, options ...func(*EvaluationOptions)) (map[string]map[string]float64, error) {
+	o := EvaluationOptions{
+		Correlators: []Correlator{Pearson, Spearman, Kendall},
+	}
+	for _, option := range options {
+		option(&o)
+	}
+
+	predictors := names(predictions)
+	measures := names(scores)
+	results := make(map[string]map[string]float64, len(predictors)+1)
+	evaluate := func(predictor string, predictions map[string]map[string]float64, measure string) {
+		if results[predictor] == nil {
+			results[predictor] = make(map[string]float64)
+		}
+		x, y := pairs(predictions, scores, predictor, measure)
+		for _, correlator := range o.Correlators {
+			c := correlator.Correlate(x, y, o.Confidence)
+			results[predictor][measure+"_"+correlator.Name] = c.Coefficient
+			if o.Confidence > 0 {
+				results[predictor][measure+"_"+correlator.Name+"_ci_low"] = c.Low
+				results[predictor][measure+"_"+correlator.Name+"_ci_high"] = c.High
+			}
+		}
+		results[predictor][measure+"_smare"] = SMARE(x, y)
+	}
+
+	for _, measure := range measures {
+		for _, predictor := range predictors {
+			evaluate(predictor, predictions, measure)
+		}
+		if o.Folds > 0 {
+			combined, err := CrossValidate(predictions, scores, predictors, measure, o.Folds, o.Seed)
+			if err != nil {
+				log.Printf("cannot combine predictors for %s: %v\n", measure, err)
+				continue
+			}
+			c := make(map[string]map[string]float64, len(combined))
+			for topic, v := range combined {
+				c[topic] = map[string]float64{CombinedPredictor: v}
+			}
+			evaluate(CombinedPredictor, c, measure)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,98 @@
+package qppeval_test
+
+import (
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/analysis/qppeval"
+	"github.com/hscells/groove/pipeline"
+	"math"
+	"testing"
+)
+
+func TestCorrelate(t *testing.T) {
+	x := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	y := []float64{2, 1, 4, 3, 6, 5, 8, 7}
+
+	if c := qppeval.Kendall.Correlate(x, y, 0); math.Abs(c.Coefficient-0.7143) > 1e-4 {
+		t.Errorf("expected a tau of 0.7143, got %f", c.Coefficient)
+	}
+	if c := qppeval.Spearman.Correlate(x, y, 0); math.Abs(c.Coefficient-0.9048) > 1e-4 {
+		t.Errorf("expected a rho of 0.9048, got %f", c.Coefficient)
+	}
+	c := qppeval.Pearson.Correlate(x, y, 0.95)
+	if !(c.Low < c.Coefficient && c.Coefficient < c.High && c.High <= 1) {
+		t.Errorf("expected the interval [%f, %f] to contain %f", c.Low, c.High, c.Coefficient)
+	}
+
+	if s := qppeval.SMARE(x, x); s != 0 {
+		t.Errorf("expected an sMARE of 0 for a perfect prediction, got %f", s)
+	}
+	if s := qppeval.SMARE(x, y); s != 0.125 {
+		t.Errorf("expected an sMARE of 0.125, got %f", s)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	predictions := make(map[string]map[string]float64)
+	scores := make(map[string]map[string]float64)
+	for i := 0; i < 20; i++ {
+		topic := fmt.Sprintf("%d", i)
+		a, b := float64(i%7), float64(i%5)
+		predictions[topic] = map[string]float64{"A": a, "B": b}
+		scores[topic] = map[string]float64{"AP": 0.1 + 0.05*a + 0.02*b}
+	}
+	predictions["missing"] = map[string]float64{"A": 1, "B": math.NaN()}
+
+	results, err := qppeval.Evaluate(predictions, scores, qppeval.ConfidenceInterval(0.95), qppeval.CombinePredictors(5, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, predictor := range []string{"A", "B", qppeval.CombinedPredictor} {
+		for _, measure := range []string{"AP_pearson", "AP_pearson_ci_low", "AP_spearman", "AP_kendall", "AP_smare"} {
+			if _, ok := results[predictor][measure]; !ok {
+				t.Errorf("expected %s to have %s", predictor, measure)
+			}
+		}
+	}
+	if r := results[qppeval.CombinedPredictor]["AP_pearson"]; math.Abs(r-1) > 1e-9 {
+		t.Errorf("expected the combined predictor to perfectly correlate, got %f", r)
+	}
+	if r := results[qppeval.CombinedPredictor]["AP_pearson"]; r <= results["A"]["AP_pearson"] {
+		t.Errorf("expected the combined predictor to outperform A")
+	}
+}
+
+func TestEvaluateSingular(t *testing.T) {
+	predictions := make(map[string]map[string]float64)
+	scores := make(map[string]map[string]float64)
+	for i := 0; i < 20; i++ {
+		topic := fmt.Sprintf("%d", i)
+		a := float64(i % 7)
+		// B is a multiple of A, so the predictors cannot be combined.
+		predictions[topic] = map[string]float64{"A": a, "B": 2 * a}
+		scores[topic] = map[string]float64{"AP": 0.1 + 0.05*a}
+	}
+
+	results, err := qppeval.Evaluate(predictions, scores, qppeval.CombinePredictors(5, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := results["A"]["AP_pearson"]; !ok {
+		t.Errorf("expected A to be evaluated, got %v", results)
+	}
+	if _, ok := results[qppeval.CombinedPredictor]; ok {
+		t.Errorf("expected the combined predictor to be skipped, got %v", results[qppeval.CombinedPredictor])
+	}
+}
+
+func TestPredictDuplicateTopics(t *testing.T) {
+	queries := []pipeline.Query{
+		pipeline.NewQuery("original", "1", cqr.NewKeyword("cancer", "ti")),
+		pipeline.NewQuery("variant", "1", cqr.NewKeyword("tumour", "ti")),
+	}
+	_, err := qppeval.Predict(analysis.NewMemoryMeasurementExecutor(), queries, nil, analysis.TermCount)
+	if err == nil {
+		t.Error("expected an error for queries with the same topic")
+	}
+}
@@ -0,0 +1,112 @@
+package qppeval
+
+import (
+	"fmt"
+	"gonum.org/v1/gonum/mat"
+	"math/rand"
+	"sort"
+)
+
+// LinearModel is a linear combination of predictors.
+type LinearModel struct {
+	Intercept    float64
+	Coefficients []float64
+}
+
+// Predict predicts a value from the values of the predictors.
+func (m LinearModel) Predict(x []float64) float64 {
+	y := m.Intercept
+	for i, c := range m.Coefficients {
+		y += c * x[i]
+	}
+	return y
+}
+
+// FitLinearModel fits a linear model to observations using ordinary least squares, where x contains the values of
+// each predictor for an observation and y contains the observed values.
+func FitLinearModel(x [][]float64, y []float64) (LinearModel, error) {
+	if len(x) == 0 || len(x) != len(y) {
+		return LinearModel{}, fmt.Errorf("cannot fit a linear model to %d observations of %d values", len(x), len(y))
+	}
+	p := len(x[0]) + 1
+	if len(x) < p {
+		return LinearModel{}, fmt.Errorf("cannot fit a linear model of %d predictors to %d observations", p-1, len(x))
+	}
+	a := mat.NewDense(len(x), p, nil)
+	for i, row := range x {
+		if len(row) != p-1 {
+			return LinearModel{}, fmt.Errorf("observation %d has %d predictors, expected %d", i, len(row), p-1)
+		}
+		a.Set(i, 0, 1)
+		for j, v := range row {
+			a.Set(i, j+1, v)
+		}
+	}
+	var beta mat.VecDense
+	if err := beta.SolveVec(a, mat.NewVecDense(len(y), append([]float64(nil), y...))); err != nil {
+		return LinearModel{}, err
+	}
+	m := LinearModel{Intercept: beta.AtVec(0), Coefficients: make([]float64, p-1)}
+	for j := range m.Coefficients {
+		m.Coefficients[j] = beta.AtVec(j + 1)
+	}
+	return m, nil
+}
+
+// CrossValidate combines predictors with a linear model using k-fold cross validation. Topics are randomly (but
+// reproducibly, using the seed) assigned to k folds, and the combined prediction for the topics of each fold is made
+// by a model fitted to the topics of the other folds. Only topics that have a value for every predictor and the
+// evaluation measure are used.
+func CrossValidate(predictions, scores map[string]map[string]float64, predictors []string, measure string, k int, seed int64) (map[string]float64, error) {
+	var topics []string
+	for topic := range predictions {
+		if _, ok := lookup(scores, topic, measure); !ok {
+			continue
+		}
+		complete := true
+		for _, predictor := range predictors {
+			if _, ok := lookup(predictions, topic, predictor); !ok {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			topics = append(topics, topic)
+		}
+	}
+	if k < 2 || k > len(topics) {
+		return nil, fmt.Errorf("cannot cross validate %d topics with %d folds", len(topics), k)
+	}
+	sort.Strings(topics)
+	rand.New(rand.NewSource(seed)).Shuffle(len(topics), func(i, j int) {
+		topics[i], topics[j] = topics[j], topics[i]
+	})
+
+	observation := func(topic string) []float64 {
+		x := make([]float64, len(predictors))
+		for i, predictor := range predictors {
+			x[i] = predictions[topic][predictor]
+		}
+		return x
+	}
+
+	combined := make(map[string]float64, len(topics))
+	for fold := 0; fold < k; fold++ {
+		var x [][]float64
+		var y []float64
+		for i, topic := range topics {
+			if i%k != fold {
+				x = append(x, observation(topic))
+				y = append(y, scores[topic][measure])
+			}
+		}
+		m, err := FitLinearModel(x, y)
+		if err != nil {
+			return nil, fmt.Errorf("fold %d: %v", fold, err)
+		}
+		for i := fold; i < len(topics); i += k {
+			combined[topics[i]] = m.Predict(observation(topics[i]))
+		}
+	}
+	return combined, nil
+}
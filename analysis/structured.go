@@ -0,0 +1,166 @@
+package analysis
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"log"
+	"math"
+	"strconv"
+)
+
+// StructuredMeasurement is a measurement that computes more than a single value for a query, e.g. a value for each
+// term or clause of the query, or a distribution.
+type StructuredMeasurement interface {
+	// Name is the name of the measurement in the output. It should not contain any spaces.
+	Name() string
+	// ExecuteStructured computes the implemented measurement for a query and optionally using the specified statistics.
+	ExecuteStructured(q pipeline.Query, s stats.StatisticsSource) (pipeline.MeasurementResult, error)
+}
+
+// scalarMeasurement is a measurement that computes a single value, as a structured measurement.
+type scalarMeasurement struct {
+	Measurement
+}
+
+// Scalar creates a structured measurement from a measurement; the result contains a single value named after the
+// measurement.
+func Scalar(measurement Measurement) StructuredMeasurement {
+	return scalarMeasurement{Measurement: measurement}
+}
+
+func (m scalarMeasurement) ExecuteStructured(q pipeline.Query, s stats.StatisticsSource) (pipeline.MeasurementResult, error) {
+	v, err := m.Execute(q, s)
+	if err != nil {
+		return pipeline.MeasurementResult{}, err
+	}
+	return pipeline.MeasurementResult{Values: map[string]float64{m.Name(): v}}, nil
+}
+
+// WalkQuery calls fn for each node of a query, in depth-first order, with the path of the node. The path of the query
+// is `/`, and the path of each child is the path of its parent followed by its index (e.g. `/0/2`). Paths are used to
+// annotate the nodes of queries in the results of structured measurements.
+func WalkQuery(query cqr.CommonQueryRepresentation, fn func(path string, node cqr.CommonQueryRepresentation) error) error {
+	return walkQuery("/", query, fn)
+}
+
+func walkQuery(path string, query cqr.CommonQueryRepresentation, fn func(path string, node cqr.CommonQueryRepresentation) error) error {
+	if err := fn(path, query); err != nil {
+		return err
+	}
+	if q, ok := query.(cqr.BooleanQuery); ok {
+		if path == "/" {
+			path = ""
+		}
+		for i, child := range q.Children {
+			if err := walkQuery(path+"/"+strconv.Itoa(i), child, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// structuredHash hashes a query and structured measurement pair ready to be cached. The hashes are distinct from
+// those of measurements (see hash), since the results are encoded differently. Unlike measurements, queries are not
+// hashed in their canonical form (see combinator.CanonicalString): results refer to the nodes of the query as written
+// (see WalkQuery), so equivalent queries with their clauses in a different order have different results.
+func structuredHash(query pipeline.Query, measurement StructuredMeasurement) string {
+	if query.Query == nil {
+		return "0s"
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(query.Query.String()+measurement.Name()+restrictionKey(query)+"/structured")))
+}
+
+// structuredEntry is a cached structured measurement. A result may be empty (e.g. the IDF profile of a query without
+// keywords), so the entry records that it is present to tell it apart from a result that has not been cached.
+type structuredEntry struct {
+	Result  pipeline.MeasurementResult
+	Present bool
+}
+
+// measureStructured computes a structured measurement of a query, or reads it from the cache. Measurements that fail
+// are handled according to the missing value policy of the executor; a missing result is empty.
+func (m MeasurementExecutor) measureStructured(query pipeline.Query, ss stats.StatisticsSource, measurement StructuredMeasurement) (pipeline.MeasurementResult, error) {
+	if scalar, ok := measurement.(scalarMeasurement); ok {
+		v, err := m.measure(query, ss, scalar.Measurement)
+		if err != nil || math.IsNaN(v) {
+			return pipeline.MeasurementResult{}, err
+		}
+		return pipeline.MeasurementResult{Values: map[string]float64{scalar.Name(): v}}, nil
+	}
+
+	qHash := structuredHash(query, measurement)
+	cached := func() (pipeline.MeasurementResult, bool) {
+		var e structuredEntry
+		if v, err := m.cache.Read(qHash); err == nil && len(v) > 0 {
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&e); err == nil && e.Present {
+				return e.Result, true
+			}
+		}
+		return pipeline.MeasurementResult{}, false
+	}
+	if r, ok := cached(); ok {
+		return r, nil
+	}
+
+	r, err := m.flight.do(measurement.Name()+"/"+qHash, func() (interface{}, error) {
+		// The measurement may have been computed since the cache was read.
+		if r, ok := cached(); ok {
+			return r, nil
+		}
+		r, err := measurement.ExecuteStructured(query, ss)
+		if err != nil {
+			return r, err
+		}
+		var buff bytes.Buffer
+		if err := gob.NewEncoder(&buff).Encode(structuredEntry{Result: r, Present: true}); err != nil {
+			return r, err
+		}
+		return r, m.cache.Write(qHash, buff.Bytes())
+	})
+	if err != nil {
+		if m.missingValuePolicy(measurement) == MissingOnError {
+			log.Printf("measurement %s is missing for topic %s: %v", measurement.Name(), query.Topic, err)
+			return pipeline.MeasurementResult{}, nil
+		}
+		return pipeline.MeasurementResult{}, fmt.Errorf("measurement %s for topic %s: %v", measurement.Name(), query.Topic, err)
+	}
+	return r.(pipeline.MeasurementResult), nil
+}
+
+// ExecuteStructured executes the specified structured measurements on the query using the statistics source. The
+// results of measurements created with Scalar are cached as measurements, so they are shared with Execute.
+// Measurements that fail are handled according to the missing value policy of the executor; a missing result is
+// empty.
+func (m MeasurementExecutor) ExecuteStructured(query pipeline.Query, ss stats.StatisticsSource, measurements ...StructuredMeasurement) ([]pipeline.MeasurementResult, error) {
+	results, err := m.ExecuteStructuredQueries([]pipeline.Query{query}, ss, measurements...)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// ExecuteStructuredQueries executes the specified structured measurements on each of the queries using the statistics
+// source (see ExecuteQueries and ExecuteStructured).
+func (m MeasurementExecutor) ExecuteStructuredQueries(queries []pipeline.Query, ss stats.StatisticsSource, measurements ...StructuredMeasurement) ([][]pipeline.MeasurementResult, error) {
+	results := make([][]pipeline.MeasurementResult, len(queries))
+	sources := sharedRetrievals(queries, ss, len(measurements))
+	for i := range queries {
+		results[i] = make([]pipeline.MeasurementResult, len(measurements))
+	}
+	err := m.run(len(queries)*len(measurements), func(i int) (err error) {
+		q, j := i/len(measurements), i%len(measurements)
+		defer release(sources[q])
+		results[q][j], err = m.measureStructured(queries[q], sources[q], measurements[j])
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
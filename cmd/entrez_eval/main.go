@@ -14,7 +14,6 @@ import (
 	"github.com/hscells/trecresults"
 	"gonum.org/v1/gonum/stat"
 	"log"
-	"net/rpc"
 	"os"
 	"path"
 	"strings"
@@ -33,9 +32,9 @@ type args struct {
 	RunOutput        string   `help:"Name of processed run file" arg:"-o"`
 	EvaluationOutput string   `help:"Name of results file" arg:"-q"`
 	Summary          bool     `help:"Only output summary information" arg:"-s"`
-	Topic            string   `help:"Topic to evaluate (only when loading qrels using RPC)" arg:"-t"`
+	Topic            string   `help:"Topic to evaluate (only when evaluating using RPC)" arg:"-t"`
 	EstimateN        float64  `help:"Estimate number of documents" arg:"-n"`
-	QrelsFile        string   `help:"Path to qrels file" arg:"required,positional"`
+	QrelsFile        string   `help:"Path to qrels file, or rpc://host:port[/set] to evaluate with a qrel_server" arg:"required,positional"`
 	RunFile          string   `help:"Path to run file" arg:"required,positional"`
 }
 
@@ -57,6 +56,22 @@ type config struct {
 	} `toml:"entrez"`
 }
 
+// remoteScheme is the prefix of the address of a qrel_server that evaluates runs remotely.
+const remoteScheme = "rpc://"
+
+// parseRemote parses the address of a qrel_server of the form rpc://host:port[/set]. Any other argument is the path
+// to a qrels file.
+func parseRemote(qrels string) (address, set string, remote bool) {
+	if !strings.HasPrefix(qrels, remoteScheme) {
+		return "", "", false
+	}
+	address = strings.TrimPrefix(qrels, remoteScheme)
+	if i := strings.Index(address, "/"); i >= 0 {
+		address, set = address[:i], address[i+1:]
+	}
+	return address, set, true
+}
+
 func main() {
 	var args args
 	arg.MustParse(&args)
@@ -83,7 +98,6 @@ func main() {
 	}
 
 	resultsHandlers := make(map[string]retrieval.ResultsHandler)
-	evaluationMeasures := make(map[string]eval.Evaluator)
 
 	var N float64
 	if args.EstimateN == 0 {
@@ -109,37 +123,7 @@ func main() {
 		N = args.EstimateN
 	}
 
-	evaluationMeasures["precision"] = eval.Precision
-	evaluationMeasures["precision_res"] = eval.NewResidualEvaluator(eval.Precision)
-	evaluationMeasures["precision_mle"] = eval.NewMaximumLikelihoodEvaluator(eval.Precision)
-	evaluationMeasures["recall"] = eval.Recall
-	evaluationMeasures["recall_res"] = eval.NewResidualEvaluator(eval.Recall)
-	evaluationMeasures["recall_mle"] = eval.NewMaximumLikelihoodEvaluator(eval.Recall)
-	evaluationMeasures["f1"] = eval.F1Measure
-	evaluationMeasures["f1_res"] = eval.NewResidualEvaluator(eval.F1Measure)
-	evaluationMeasures["f1_mle"] = eval.NewMaximumLikelihoodEvaluator(eval.F1Measure)
-	evaluationMeasures["f0.5"] = eval.F05Measure
-	evaluationMeasures["f0.5_res"] = eval.NewResidualEvaluator(eval.F05Measure)
-	evaluationMeasures["f0.5_mle"] = eval.NewMaximumLikelihoodEvaluator(eval.F05Measure)
-	evaluationMeasures["f3"] = eval.F3Measure
-	evaluationMeasures["f3_res"] = eval.NewResidualEvaluator(eval.F3Measure)
-	evaluationMeasures["f3_mle"] = eval.NewMaximumLikelihoodEvaluator(eval.F3Measure)
-	evaluationMeasures["nnr"] = eval.NNR
-	evaluationMeasures["wss"] = eval.NewWSSEvaluator(N)
-	evaluationMeasures["wss_res"] = eval.NewResidualEvaluator(eval.NewWSSEvaluator(N))
-	evaluationMeasures["wss_mle"] = eval.NewMaximumLikelihoodEvaluator(eval.NewWSSEvaluator(N))
-	evaluationMeasures["num_ret"] = eval.NumRet
-	evaluationMeasures["num_rel"] = eval.NumRel
-	evaluationMeasures["num_rel_ret"] = eval.NumRelRet
-	evaluationMeasures["ap"] = eval.AP
-	evaluationMeasures["p@10"] = eval.PrecisionAtK{K: 10}
-	evaluationMeasures["p@1000"] = eval.PrecisionAtK{K: 1000}
-	evaluationMeasures["ndcg"] = eval.NDCG{}
-	evaluationMeasures["ndcg@5"] = eval.NDCG{K: 5}
-	evaluationMeasures["ndcg@10"] = eval.NDCG{K: 10}
-	evaluationMeasures["ndcg@100"] = eval.NDCG{K: 100}
-	evaluationMeasures["ndcg@200"] = eval.NDCG{K: 200}
-	evaluationMeasures["ndcg@500"] = eval.NDCG{K: 500}
+	evaluationMeasures := eval.NamedEvaluators(N)
 
 	eval.RelevanceGrade = args.RelevanceGrade
 
@@ -184,19 +168,11 @@ func main() {
 		}
 	}
 
+	// When the qrels are hosted by a qrel_server, the run is evaluated remotely so the qrels never leave the server.
+	address, set, remote := parseRemote(args.QrelsFile)
+
 	var qrels trecresults.QrelsFile
-	if strings.Contains(args.QrelsFile, ":8004") {
-		client, err := rpc.Dial("tcp", args.QrelsFile)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		q := new(qrelrpc.Response)
-		err = client.Call("QrelsRPC.GetQrels", args.Topic, &q)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		qrels = q.Qrels
-	} else {
+	if !remote {
 		q, err := os.OpenFile(args.QrelsFile, os.O_RDONLY, 0664)
 		if err != nil {
 			log.Fatalln(err)
@@ -221,6 +197,9 @@ func main() {
 				results.Results[k] = v
 			}
 		}
+		if remote {
+			continue
+		}
 		// Then move on to perform the evaluation.
 		evaluation[k] = make(map[string]float64)
 		for _, ev := range args.Evaluation {
@@ -231,6 +210,39 @@ func main() {
 		}
 	}
 
+	if remote {
+		client, err := qrelrpc.Dial(address)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		run := results.Results
+		if len(args.Topic) > 0 {
+			run = map[string]trecresults.ResultList{args.Topic: results.Results[args.Topic]}
+		}
+		var measures []string
+		for _, ev := range args.Evaluation {
+			if _, ok := evaluationMeasures[ev]; ok {
+				measures = append(measures, ev)
+			}
+		}
+		req := qrelrpc.EvaluateRequest{
+			Set:            set,
+			Evaluators:     measures,
+			CollectionSize: N,
+			Results:        run,
+		}
+		// The grade is always set, so that remote and local evaluation consider the same documents relevant.
+		req.SetRelevanceGrade(args.RelevanceGrade)
+		evaluation, err = client.Evaluate(req)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = client.Close()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	if size > 0 {
 		t, err := os.OpenFile(args.RunOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
 		if err != nil {
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/alexflint/go-arg"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis/lint"
+	"github.com/hscells/groove/query"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/meshexp"
+	"github.com/hscells/transmute"
+	"os"
+	"strings"
+)
+
+var (
+	name    = "groove"
+	version = "19.Oct.2026"
+	author  = "Harry Scells"
+)
+
+// OvidSyntax is the syntax of line-numbered Ovid search strategies.
+const OvidSyntax = "ovid"
+
+type lintCmd struct {
+	Syntax        string   `help:"syntax of the queries (pubmed/medline/ovid), detected from each query by default" arg:"-s"`
+	Fields        []string `help:"fields that can be searched (PubMed fields by default)" arg:"-f,separate"`
+	AnyField      bool     `help:"do not check the fields of queries" arg:"--any-field"`
+	MeSH          bool     `help:"check that MeSH headings exist in the MeSH tree" arg:"-m"`
+	MinTruncation int      `help:"minimum number of characters before a wildcard" arg:"-t"`
+	JSON          bool     `help:"output issues as JSON" arg:"-j"`
+	Queries       []string `help:"queries to check (files, directories, archives, globs, or - for stdin)" arg:"required,positional"`
+}
+
+type args struct {
+	Lint *lintCmd `arg:"subcommand:lint" help:"check queries for issues before running them"`
+}
+
+func (args) Version() string {
+	return version
+}
+
+func (args) Description() string {
+	return fmt.Sprintf(`%s
+@ %s
+# %s`, name, author, version)
+}
+
+// parse parses a query in a syntax. Since the parsers may panic on malformed input, any panic is recovered and
+// returned as an error.
+func parse(text, syntax string) (q cqr.CommonQueryRepresentation, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("could not parse %s query: %v", syntax, r)
+		}
+	}()
+	if len(syntax) == 0 {
+		syntax = query.DetectSyntax(text)
+	}
+	switch strings.ToLower(syntax) {
+	case OvidSyntax:
+		return query.ParseOvid(text)
+	case query.PubMedSyntax:
+		return transmute.CompilePubmed2Cqr(text)
+	case query.OvidMedlineSyntax:
+		return transmute.CompileMedline2Cqr(text)
+	}
+	return nil, fmt.Errorf("unknown query syntax %s", syntax)
+}
+
+// lintResult is the issues identified in a single query.
+type lintResult struct {
+	File   string      `json:"file"`
+	Issues lint.Issues `json:"issues"`
+}
+
+// runLint checks every query and returns the number of errors.
+func runLint(cmd *lintCmd) (int, error) {
+	var options []func(*lint.Linter)
+	switch {
+	case cmd.AnyField:
+	case len(cmd.Fields) > 0:
+		options = append(options, lint.Fields(cmd.Fields...))
+	default:
+		options = append(options, lint.Fields(stats.PubMedFields...))
+	}
+	if cmd.MeSH {
+		tree, err := meshexp.Default()
+		if err != nil {
+			return 0, err
+		}
+		options = append(options, lint.MeSHTree(tree))
+	}
+	if cmd.MinTruncation > 0 {
+		options = append(options, lint.MinTruncation(cmd.MinTruncation))
+	}
+	linter := lint.NewLinter(options...)
+
+	var (
+		results []lintResult
+		errors  int
+	)
+	for _, location := range cmd.Queries {
+		docs, err := query.ReadLocation(location)
+		// Files that cannot be read are reported as errors, and the remaining files are still linted.
+		if errs, ok := err.(query.TopicErrors); ok {
+			for _, e := range errs {
+				errors++
+				results = append(results, lintResult{File: e.File, Issues: lint.Issues{{Rule: "read", Severity: lint.Error, Message: e.Err.Error()}}})
+			}
+		} else if err != nil {
+			return 0, err
+		}
+		for _, doc := range docs {
+			text := string(doc.Source)
+			var issues lint.Issues
+			q, err := parse(text, cmd.Syntax)
+			if err != nil {
+				issues = lint.Issues{{Rule: "syntax", Severity: lint.Error, Message: err.Error()}}
+				if e, ok := err.(query.OvidSyntaxError); ok {
+					issues[0].Position = lint.Position{Line: e.Line, Column: e.Column}
+				}
+			} else {
+				issues = linter.Lint(q, text)
+			}
+			errors += issues.Errors()
+			results = append(results, lintResult{File: doc.Name, Issues: issues})
+		}
+	}
+
+	if cmd.JSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "    ")
+		return errors, e.Encode(results)
+	}
+	for _, r := range results {
+		for _, issue := range r.Issues {
+			fmt.Printf("%s:%s\n", r.File, issue)
+		}
+	}
+	return errors, nil
+}
+
+func main() {
+	var args args
+	p := arg.MustParse(&args)
+
+	switch {
+	case args.Lint != nil:
+		errors, err := runLint(args.Lint)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if errors > 0 {
+			os.Exit(1)
+		}
+	default:
+		p.Fail("a command is required")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/alexflint/go-arg"
 	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis/diff"
 	"github.com/hscells/transmute"
 	"github.com/hscells/transmute/fields"
 	"io/ioutil"
@@ -21,6 +22,7 @@ var (
 type args struct {
 	Query  string `help:"query to load" arg:"-q"`
 	Format string `help:"format of the query (pubmed/medline)" arg:"-f"`
+	Diff   bool   `help:"output the changes made to the query" arg:"-d"`
 }
 
 func (args) Version() string {
@@ -74,9 +76,28 @@ func main() {
 			panic(err)
 		}
 	}
+
+	if args.Diff {
+		original, err := compile(q, args.Format)
+		if err != nil {
+			panic(err)
+		}
+		_, err = os.Stdout.WriteString(diff.Queries(original, m).String())
+		if err != nil {
+			panic(err)
+		}
+	}
 }
 
 func RemoveMeSH(query string, format string) (cqr.CommonQueryRepresentation, []cqr.Keyword, error) {
+	q, err := compile(query, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return removeMeSH(q)
+}
+
+func compile(query string, format string) (cqr.CommonQueryRepresentation, error) {
 	var q cqr.CommonQueryRepresentation
 	var err error
 	switch format {
@@ -87,10 +108,7 @@ func RemoveMeSH(query string, format string) (cqr.CommonQueryRepresentation, []c
 	default:
 		err = errors.New("unrecognised format")
 	}
-	if err != nil {
-		return nil, nil, err
-	}
-	return removeMeSH(q)
+	return q, err
 }
 
 func removeMeSH(query cqr.CommonQueryRepresentation) (cqr.CommonQueryRepresentation, []cqr.Keyword, error) {
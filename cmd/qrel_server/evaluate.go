@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/groove/cmd/qrel_server/qrelrpc"
+	"github.com/hscells/groove/eval"
+	"github.com/hscells/trecresults"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// resolveEvaluators resolves the names of evaluators in a request.
+func resolveEvaluators(req qrelrpc.EvaluateRequest) ([]eval.Evaluator, error) {
+	if len(req.Evaluators) == 0 {
+		return nil, fmt.Errorf("no evaluators were requested")
+	}
+	named := eval.NamedEvaluators(req.CollectionSize)
+	e := make([]eval.Evaluator, len(req.Evaluators))
+	for i, name := range req.Evaluators {
+		evaluator, ok := named[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown evaluator %s", name)
+		}
+		if strings.HasPrefix(name, "wss") && req.CollectionSize <= 0 {
+			return nil, fmt.Errorf("evaluator %s requires the collection size", name)
+		}
+		e[i] = eval.NewThresholdEvaluator(evaluator, req.Grade())
+	}
+	return e, nil
+}
+
+// Evaluate evaluates a run against a set of qrels, so that the qrels never need to leave the server.
+func (e *QrelsRPC) Evaluate(req qrelrpc.EvaluateRequest, resp *qrelrpc.EvaluateResponse) error {
+	qrels, err := e.store.get(req.Set)
+	if err != nil {
+		return err
+	}
+	evaluators, err := resolveEvaluators(req)
+	if err != nil {
+		return err
+	}
+	resp.Evaluation = make(map[string]map[string]float64, len(req.Results))
+	for topic, results := range req.Results {
+		resp.Evaluation[topic] = eval.Evaluate(evaluators, &results, qrels, topic)
+	}
+	return nil
+}
+
+// parseEvaluateRequest parses an evaluation request over HTTP. A request is either a JSON encoded
+// qrelrpc.EvaluateRequest, or a TREC run in the body with the remainder of the request in the query:
+//
+//	POST /evaluate?set=<set>&measure=<measure>&measure=<measure>&grade=<grade>&n=<collection size>
+//
+// When the grade is omitted, eval.RelevanceGrade is used.
+func parseEvaluateRequest(r *http.Request) (qrelrpc.EvaluateRequest, error) {
+	var req qrelrpc.EvaluateRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		// A grade in the body is set, even when it is zero.
+		var body struct {
+			qrelrpc.EvaluateRequest
+			RelevanceGrade *int64
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		req = body.EvaluateRequest
+		if body.RelevanceGrade != nil {
+			req.SetRelevanceGrade(*body.RelevanceGrade)
+		}
+		return req, err
+	}
+
+	params := r.URL.Query()
+	req.Set = params.Get("set")
+	for _, measure := range params["measure"] {
+		req.Evaluators = append(req.Evaluators, strings.Split(measure, ",")...)
+	}
+	var err error
+	if g := params.Get("grade"); len(g) > 0 {
+		grade, err := strconv.ParseInt(g, 10, 64)
+		if err != nil {
+			return req, err
+		}
+		req.SetRelevanceGrade(grade)
+	}
+	if n := params.Get("n"); len(n) > 0 {
+		req.CollectionSize, err = strconv.ParseFloat(n, 64)
+		if err != nil {
+			return req, err
+		}
+	}
+
+	run, err := trecresults.ResultsFromReader(r.Body)
+	if err != nil {
+		return req, err
+	}
+	req.Results = run.Results
+	return req, nil
+}
+
+// handleEvaluate is the JSON/HTTP interface for evaluating runs.
+func handleEvaluate(q *QrelsRPC) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		req, err := parseEvaluateRequest(r)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		var resp qrelrpc.EvaluateResponse
+		err = q.Evaluate(req, &resp)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, resp)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/hscells/groove/cmd/qrel_server/qrelrpc"
+	"log"
+	"net/http"
+)
+
+// writeJSON writes a value as a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// writeError writes an error as a JSON response with the specified status code.
+func writeError(w http.ResponseWriter, err error, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// newHandler creates the JSON/HTTP interface to the qrels hosted by the server. The same methods as the net/rpc
+// interface are available:
+//
+//	GET  /sets
+//	GET  /topics?set=<set>
+//	GET  /qrels?set=<set>&topic=<topic>
+//	GET  /judgement?set=<set>&topic=<topic>&doc=<doc>
+//	POST /judgements (body: qrelrpc.JudgementsRequest)
+//	POST /evaluate (body: qrelrpc.EvaluateRequest, or a TREC run)
+//
+// When the set is omitted, the default set of qrels is used.
+func newHandler(s *store) http.Handler {
+	q := &QrelsRPC{store: s}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/sets", func(w http.ResponseWriter, r *http.Request) {
+		var resp qrelrpc.SetsResponse
+		_ = q.Sets(struct{}{}, &resp)
+		writeJSON(w, resp)
+	})
+
+	mux.HandleFunc("/topics", func(w http.ResponseWriter, r *http.Request) {
+		var resp qrelrpc.TopicsResponse
+		err := q.Topics(qrelrpc.TopicsRequest{Set: r.URL.Query().Get("set")}, &resp)
+		if err != nil {
+			writeError(w, err, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, resp)
+	})
+
+	mux.HandleFunc("/qrels", func(w http.ResponseWriter, r *http.Request) {
+		var resp qrelrpc.Response
+		err := q.GetSetQrels(qrelrpc.QrelsRequest{
+			Set:   r.URL.Query().Get("set"),
+			Topic: r.URL.Query().Get("topic"),
+		}, &resp)
+		if err != nil {
+			writeError(w, err, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, resp)
+	})
+
+	mux.HandleFunc("/judgement", func(w http.ResponseWriter, r *http.Request) {
+		var resp qrelrpc.JudgementResponse
+		err := q.Judgement(qrelrpc.JudgementRequest{
+			Set: r.URL.Query().Get("set"),
+			Judgement: qrelrpc.Judgement{
+				Topic: r.URL.Query().Get("topic"),
+				DocId: r.URL.Query().Get("doc"),
+			},
+		}, &resp)
+		if err != nil {
+			writeError(w, err, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, resp)
+	})
+
+	mux.HandleFunc("/judgements", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req qrelrpc.JudgementsRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		var resp qrelrpc.JudgementsResponse
+		err = q.Judgements(req, &resp)
+		if err != nil {
+			writeError(w, err, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, resp)
+	})
+
+	mux.HandleFunc("/evaluate", handleEvaluate(q))
+
+	return mux
+}
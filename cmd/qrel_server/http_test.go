@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/hscells/groove/cmd/qrel_server/qrelrpc"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestStore creates a store with a single set of qrels named test. The qrels are loaded into memory, so the file
+// is removed once the store is created.
+func newTestStore(t *testing.T) *store {
+	dir, err := ioutil.TempDir("", "qrel_server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := path.Join(dir, "test.qrels")
+	err = ioutil.WriteFile(p, []byte("1 0 a 2\n1 0 b 1\n1 0 c 0\n2 0 d 1\n"), 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newStore("test=" + p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func getJSON(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(newHandler(newTestStore(t)))
+	defer server.Close()
+
+	var sets qrelrpc.SetsResponse
+	getJSON(t, server.URL+"/sets", &sets)
+	if !reflect.DeepEqual(sets.Sets, []string{"test"}) {
+		t.Errorf("expected the sets [test], got %v", sets.Sets)
+	}
+
+	var topics qrelrpc.TopicsResponse
+	getJSON(t, server.URL+"/topics?set=test", &topics)
+	if !reflect.DeepEqual(topics.Topics, []string{"1", "2"}) {
+		t.Errorf("expected the topics [1 2], got %v", topics.Topics)
+	}
+
+	var judgement qrelrpc.JudgementResponse
+	getJSON(t, server.URL+"/judgement?topic=1&doc=a", &judgement)
+	if !judgement.Found || judgement.Score != 2 {
+		t.Errorf("expected document a to be judged 2, got %v", judgement)
+	}
+
+	var e map[string]string
+	if code := getJSON(t, server.URL+"/topics?set=missing", &e); code != http.StatusNotFound || len(e["error"]) == 0 {
+		t.Errorf("expected an error for a missing set, got %d %v", code, e)
+	}
+
+	// A run in the body is evaluated with the default relevance grade when none is specified.
+	for query, expected := range map[string]float64{"": 1, "&grade=0": 2} {
+		resp, err := http.Post(server.URL+"/evaluate?measure=num_rel_ret"+query, "text/plain", strings.NewReader("1 Q0 a 1 3 run\n1 Q0 b 2 2 run\n1 Q0 c 3 1 run\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var evaluation qrelrpc.EvaluateResponse
+		err = json.NewDecoder(resp.Body).Decode(&evaluation)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := evaluation.Evaluation["1"]["NumRelRet"]; v != expected {
+			t.Errorf("expected %v relevant documents to be retrieved for %q, got %v", expected, query, v)
+		}
+	}
+}
+
+func TestQrelsRPC(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.Register(&QrelsRPC{store: newTestStore(t)}); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+
+	c, err := qrelrpc.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	judgements, err := c.Judgements("", []qrelrpc.Judgement{{Topic: "1", DocId: "b"}, {Topic: "2", DocId: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(judgements, []qrelrpc.JudgementResponse{{Found: true, Score: 1}, {}}) {
+		t.Errorf("unexpected judgements %v", judgements)
+	}
+
+	qrels, err := c.Qrels("test", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(qrels.Qrels["2"]) != 1 {
+		t.Errorf("expected one qrel for topic 2, got %v", qrels.Qrels)
+	}
+}
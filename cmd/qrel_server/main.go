@@ -1,78 +1,173 @@
 package main
 
 import (
+	"context"
 	"github.com/alexflint/go-arg"
 	"github.com/hscells/groove/cmd/qrel_server/qrelrpc"
 	"github.com/hscells/trecresults"
 	"log"
 	"net"
+	"net/http"
 	"net/rpc"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 type args struct {
-	QrelsFile string `arg:"required,positional" help:"path to qrels file to host"`
+	QrelsFiles []string      `arg:"required,positional" help:"qrels files to host, optionally named as name=path (the first is the default)"`
+	Address    string        `arg:"-a" help:"address to host the net/rpc interface on"`
+	HTTP       string        `arg:"--http" help:"address to host the JSON/HTTP interface on (disabled when empty)"`
+	Reload     time.Duration `arg:"-r" help:"how often to check qrels files for changes (disabled when zero)"`
 }
 
 func (args) Version() string {
-	return "qrel_server 17.Jan.2020"
+	return "qrel_server 19.Oct.2026"
 }
 
 func (args) Description() string {
 	return `qrels server for fast access to relevance assessments`
 }
 
+// QrelsRPC is the net/rpc interface to the qrels hosted by the server.
 type QrelsRPC struct {
-	Qrels trecresults.QrelsFile
+	store *store
 }
 
+// GetQrels retrieves the qrels for a topic in the default set of qrels.
 func (e *QrelsRPC) GetQrels(topic string, resp *qrelrpc.Response) error {
+	return e.GetSetQrels(qrelrpc.QrelsRequest{Topic: topic}, resp)
+}
+
+// GetSetQrels retrieves the qrels for a topic in a named set of qrels.
+func (e *QrelsRPC) GetSetQrels(req qrelrpc.QrelsRequest, resp *qrelrpc.Response) error {
+	qrels, err := e.store.get(req.Set)
+	if err != nil {
+		return err
+	}
 	q := make(map[string]trecresults.Qrels)
-	q[topic] = e.Qrels.Qrels[topic]
-	f := trecresults.QrelsFile{
+	q[req.Topic] = qrels.Qrels[req.Topic]
+	resp.Qrels = trecresults.QrelsFile{
 		Qrels: q,
 	}
-	resp.Qrels = f
 	return nil
 }
 
-func main() {
-	var args args
-	arg.MustParse(&args)
+// Sets lists the names of the sets of qrels hosted by the server.
+func (e *QrelsRPC) Sets(_ struct{}, resp *qrelrpc.SetsResponse) error {
+	resp.Sets = e.store.list()
+	return nil
+}
 
-	log.Println("initialising server...")
-	addy, err := net.ResolveTCPAddr("tcp", "0.0.0.0:8004")
+// Topics lists the topics in a set of qrels.
+func (e *QrelsRPC) Topics(req qrelrpc.TopicsRequest, resp *qrelrpc.TopicsResponse) error {
+	topics, err := e.store.topics(req.Set)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	resp.Topics = topics
+	return nil
+}
+
+// judge looks up the judgement of a document.
+func judge(qrels trecresults.QrelsFile, j qrelrpc.Judgement) qrelrpc.JudgementResponse {
+	if qrel, ok := qrels.Qrels[j.Topic][j.DocId]; ok {
+		return qrelrpc.JudgementResponse{Found: true, Score: qrel.Score}
+	}
+	return qrelrpc.JudgementResponse{}
+}
+
+// Judgement retrieves the judgement of a single document.
+func (e *QrelsRPC) Judgement(req qrelrpc.JudgementRequest, resp *qrelrpc.JudgementResponse) error {
+	qrels, err := e.store.get(req.Set)
+	if err != nil {
+		return err
+	}
+	*resp = judge(qrels, req.Judgement)
+	return nil
+}
 
-	inbound, err := net.ListenTCP("tcp", addy)
+// Judgements retrieves the judgements of many documents.
+func (e *QrelsRPC) Judgements(req qrelrpc.JudgementsRequest, resp *qrelrpc.JudgementsResponse) error {
+	qrels, err := e.store.get(req.Set)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	resp.Judgements = make([]qrelrpc.JudgementResponse, len(req.Judgements))
+	for i, j := range req.Judgements {
+		resp.Judgements[i] = judge(qrels, j)
+	}
+	return nil
+}
+
+func main() {
+	args := args{
+		Address: "0.0.0.0:8004",
+	}
+	arg.MustParse(&args)
 
-	q, err := os.OpenFile(args.QrelsFile, os.O_RDONLY, 0664)
+	log.Println("loading qrels...")
+	s, err := newStore(args.QrelsFiles...)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	qrels, err := trecresults.QrelsFromReader(q)
+
+	done := make(chan struct{})
+	if args.Reload > 0 {
+		log.Printf("checking qrels for changes every %s\n", args.Reload)
+		go s.watch(args.Reload, done)
+	}
+
+	log.Println("initialising server...")
+	inbound, err := net.Listen("tcp", args.Address)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	log.Println(len(qrels.Qrels))
 
 	log.Println("registering listener...")
-	listener := new(QrelsRPC)
-	x := QrelsRPC{
-		Qrels: qrels,
+	server := rpc.NewServer()
+	err = server.Register(&QrelsRPC{store: s})
+	if err != nil {
+		log.Fatalln(err)
 	}
+	go server.Accept(inbound)
+	log.Printf("net/rpc listening on %s\n", args.Address)
 
-	listener = &x
-	err = rpc.Register(listener)
-	if err != nil {
-		panic(err)
+	var h *http.Server
+	if len(args.HTTP) > 0 {
+		h = &http.Server{
+			Addr:    args.HTTP,
+			Handler: newHandler(s),
+		}
+		go func() {
+			if err := h.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalln(err)
+			}
+		}()
+		log.Printf("JSON/HTTP listening on %s\n", args.HTTP)
 	}
+
 	log.Println("ready to go!")
-	rpc.Accept(inbound)
 
+	// Wait for a signal to stop, then shut down gracefully.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+
+	log.Println("shutting down...")
+	close(done)
+	err = inbound.Close()
+	if err != nil {
+		log.Println(err)
+	}
+	if h != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = h.Shutdown(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	log.Println("goodbye!")
 }
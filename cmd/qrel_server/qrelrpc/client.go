@@ -1,7 +1,171 @@
+// Package qrelrpc contains the protocol and client for communicating with a qrel_server.
 package qrelrpc
 
-import "github.com/hscells/trecresults"
+import (
+	"github.com/hscells/groove/eval"
+	"github.com/hscells/trecresults"
+	"net/rpc"
+)
 
+// Response contains the qrels for a topic.
 type Response struct {
 	Qrels trecresults.QrelsFile
-}
\ No newline at end of file
+}
+
+// QrelsRequest requests the qrels for a topic from a named set of qrels. When the
+// name of the set is empty, the default (first) set of qrels hosted by the server is used.
+type QrelsRequest struct {
+	Set   string
+	Topic string
+}
+
+// TopicsRequest requests the topics in a named set of qrels.
+type TopicsRequest struct {
+	Set string
+}
+
+// TopicsResponse contains the topics in a set of qrels.
+type TopicsResponse struct {
+	Topics []string
+}
+
+// SetsResponse contains the names of the sets of qrels hosted by the server.
+type SetsResponse struct {
+	Sets []string
+}
+
+// Judgement identifies the judgement of a single document for a topic.
+type Judgement struct {
+	Topic string
+	DocId string
+}
+
+// JudgementRequest requests the judgement of a single document for a topic in a named set of qrels.
+type JudgementRequest struct {
+	Set string
+	Judgement
+}
+
+// JudgementResponse contains the judgement of a document. Found is false when the document is unjudged.
+type JudgementResponse struct {
+	Found bool
+	Score int64
+}
+
+// JudgementsRequest requests the judgements of many documents in a named set of qrels.
+type JudgementsRequest struct {
+	Set        string
+	Judgements []Judgement
+}
+
+// JudgementsResponse contains the judgements of documents, in the same order they were requested.
+type JudgementsResponse struct {
+	Judgements []JudgementResponse
+}
+
+// Client is a client for a qrel_server.
+type Client struct {
+	*rpc.Client
+}
+
+// Dial connects to a qrel_server at the specified address.
+func Dial(address string) (*Client, error) {
+	c, err := rpc.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: c}, nil
+}
+
+// Sets lists the names of the sets of qrels hosted by the server.
+func (c *Client) Sets() ([]string, error) {
+	var resp SetsResponse
+	err := c.Call("QrelsRPC.Sets", struct{}{}, &resp)
+	return resp.Sets, err
+}
+
+// Topics lists the topics in a set of qrels.
+func (c *Client) Topics(set string) ([]string, error) {
+	var resp TopicsResponse
+	err := c.Call("QrelsRPC.Topics", TopicsRequest{Set: set}, &resp)
+	return resp.Topics, err
+}
+
+// Qrels retrieves the qrels for a topic in a set of qrels.
+func (c *Client) Qrels(set, topic string) (trecresults.QrelsFile, error) {
+	var resp Response
+	err := c.Call("QrelsRPC.GetSetQrels", QrelsRequest{Set: set, Topic: topic}, &resp)
+	return resp.Qrels, err
+}
+
+// Judgement retrieves the judgement of a single document for a topic in a set of qrels.
+func (c *Client) Judgement(set, topic, docId string) (JudgementResponse, error) {
+	var resp JudgementResponse
+	err := c.Call("QrelsRPC.Judgement", JudgementRequest{Set: set, Judgement: Judgement{Topic: topic, DocId: docId}}, &resp)
+	return resp, err
+}
+
+// Judgements retrieves the judgements of many documents in a set of qrels in a single request.
+func (c *Client) Judgements(set string, judgements []Judgement) ([]JudgementResponse, error) {
+	var resp JudgementsResponse
+	err := c.Call("QrelsRPC.Judgements", JudgementsRequest{Set: set, Judgements: judgements}, &resp)
+	return resp.Judgements, err
+}
+
+// EvaluateRequest requests that a run is evaluated against a named set of qrels on the server,
+// so that the qrels never need to leave the server. Evaluators are referred to by the names in
+// eval.NamedEvaluators. A document is considered relevant when its judgement is greater than
+// RelevanceGrade, and CollectionSize is used by measures such as work saved over sampling.
+//
+// Since a grade of zero cannot be told apart from an unset grade once encoded, RelevanceGrade is
+// only used when GradeSet is true (see SetRelevanceGrade); otherwise eval.RelevanceGrade is used,
+// exactly as when evaluating locally.
+type EvaluateRequest struct {
+	Set            string
+	Evaluators     []string
+	RelevanceGrade int64
+	GradeSet       bool
+	CollectionSize float64
+	Results        map[string]trecresults.ResultList
+}
+
+// SetRelevanceGrade sets the grade that a judgement must be greater than for a document to be relevant.
+func (r *EvaluateRequest) SetRelevanceGrade(grade int64) {
+	r.RelevanceGrade = grade
+	r.GradeSet = true
+}
+
+// Grade is the grade that a judgement must be greater than for a document to be relevant.
+func (r EvaluateRequest) Grade() int64 {
+	if r.GradeSet {
+		return r.RelevanceGrade
+	}
+	return eval.RelevanceGrade
+}
+
+// EvaluateResponse contains the evaluation of each topic in a run.
+type EvaluateResponse struct {
+	Evaluation map[string]map[string]float64
+}
+
+// Evaluate evaluates a run against a set of qrels on the server.
+func (c *Client) Evaluate(req EvaluateRequest) (map[string]map[string]float64, error) {
+	var resp EvaluateResponse
+	err := c.Call("QrelsRPC.Evaluate", req, &resp)
+	return resp.Evaluation, err
+}
+
+// EvaluateTopic evaluates the results of a single topic against a set of qrels on the server.
+func (c *Client) EvaluateTopic(set, topic string, results trecresults.ResultList, grade int64, evaluators ...string) (map[string]float64, error) {
+	req := EvaluateRequest{
+		Set:        set,
+		Evaluators: evaluators,
+		Results:    map[string]trecresults.ResultList{topic: results},
+	}
+	req.SetRelevanceGrade(grade)
+	e, err := c.Evaluate(req)
+	if err != nil {
+		return nil, err
+	}
+	return e[topic], nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hscells/trecresults"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// qrelsSet is a named qrels file hosted by the server.
+type qrelsSet struct {
+	name    string
+	path    string
+	modTime time.Time
+	qrels   trecresults.QrelsFile
+}
+
+// store contains all of the sets of qrels hosted by the server. The qrels in the store may be replaced when the
+// files they were loaded from change, so all access goes through the lock.
+type store struct {
+	sets  map[string]*qrelsSet
+	names []string
+	mu    sync.RWMutex
+}
+
+// parseSet parses a qrels argument of the form `name=path`. If no name is given, the name of the file is used.
+func parseSet(arg string) (name, p string) {
+	if i := strings.Index(arg, "="); i > 0 {
+		return arg[:i], arg[i+1:]
+	}
+	return path.Base(arg), arg
+}
+
+// loadQrels reads a qrels file from disk.
+func loadQrels(p string) (trecresults.QrelsFile, time.Time, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return trecresults.QrelsFile{}, time.Time{}, err
+	}
+	f, err := os.OpenFile(p, os.O_RDONLY, 0664)
+	if err != nil {
+		return trecresults.QrelsFile{}, time.Time{}, err
+	}
+	defer f.Close()
+	qrels, err := trecresults.QrelsFromReader(f)
+	if err != nil {
+		return trecresults.QrelsFile{}, time.Time{}, err
+	}
+	return qrels, info.ModTime(), nil
+}
+
+// newStore loads each of the qrels files into a new store. The first qrels file is the default set.
+func newStore(args ...string) (*store, error) {
+	s := &store{
+		sets: make(map[string]*qrelsSet),
+	}
+	for _, arg := range args {
+		name, p := parseSet(arg)
+		if _, ok := s.sets[name]; ok {
+			return nil, fmt.Errorf("qrels set %s has been specified more than once", name)
+		}
+		qrels, modTime, err := loadQrels(p)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("loaded %d topics into qrels set %s\n", len(qrels.Qrels), name)
+		s.sets[name] = &qrelsSet{
+			name:    name,
+			path:    p,
+			modTime: modTime,
+			qrels:   qrels,
+		}
+		s.names = append(s.names, name)
+	}
+	return s, nil
+}
+
+// get retrieves a set of qrels by name. An empty name is the default set.
+func (s *store) get(name string) (trecresults.QrelsFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(name) == 0 && len(s.names) > 0 {
+		name = s.names[0]
+	}
+	if set, ok := s.sets[name]; ok {
+		return set.qrels, nil
+	}
+	return trecresults.QrelsFile{}, fmt.Errorf("no qrels set named %s", name)
+}
+
+// list lists the names of the sets of qrels in the store.
+func (s *store) list() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, len(s.names))
+	copy(names, s.names)
+	return names
+}
+
+// topics lists the topics in a set of qrels.
+func (s *store) topics(name string) ([]string, error) {
+	qrels, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+	topics := make([]string, 0, len(qrels.Qrels))
+	for topic := range qrels.Qrels {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// reload reloads any qrels files that have changed on disk since they were last loaded. A qrels file that fails to
+// load is logged and the previously loaded qrels continue to be served.
+func (s *store) reload() {
+	s.mu.RLock()
+	var changed []*qrelsSet
+	for _, set := range s.sets {
+		info, err := os.Stat(set.path)
+		if err != nil {
+			log.Printf("could not check qrels set %s for changes: %v\n", set.name, err)
+			continue
+		}
+		if info.ModTime().After(set.modTime) {
+			changed = append(changed, set)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, set := range changed {
+		qrels, modTime, err := loadQrels(set.path)
+		if err != nil {
+			log.Printf("could not reload qrels set %s: %v\n", set.name, err)
+			continue
+		}
+		s.mu.Lock()
+		set.qrels = qrels
+		set.modTime = modTime
+		s.mu.Unlock()
+		log.Printf("reloaded %d topics into qrels set %s\n", len(qrels.Qrels), set.name)
+	}
+}
+
+// watch periodically reloads the qrels files that have changed until done is closed.
+func (s *store) watch(interval time.Duration, done chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.reload()
+		case <-done:
+			return
+		}
+	}
+}
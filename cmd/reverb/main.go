@@ -88,6 +88,8 @@ func main() {
 	gob.Register(trecresults.Result{})
 	gob.Register(pipeline.SupplementalData{})
 	gob.Register(pipeline.Data{})
+	gob.Register(pipeline.Query{})
+	gob.Register(pipeline.QueryResult{})
 
 	fmt.Print(args.Description())
 
@@ -0,0 +1,169 @@
+package combinator
+
+import (
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/transmute/fields"
+	"sort"
+	"strings"
+)
+
+// fieldAliases are fields that search the same thing as another field.
+var fieldAliases = map[string]string{
+	fields.MeSHTerms: fields.MeshHeadings,
+}
+
+// canonicalFields normalises the fields of a keyword: fields are trimmed, aliases are replaced, duplicates are
+// removed, a title field together with an abstract field becomes the title/abstract field, and the fields are
+// sorted.
+func canonicalFields(f []string) []string {
+	seen := make(map[string]bool)
+	for _, field := range f {
+		field = strings.TrimSpace(field)
+		if alias, ok := fieldAliases[field]; ok {
+			field = alias
+		}
+		if len(field) > 0 {
+			seen[field] = true
+		}
+	}
+	if seen[fields.Title] && seen[fields.Abstract] {
+		delete(seen, fields.Title)
+		delete(seen, fields.Abstract)
+		seen[fields.TitleAbstract] = true
+	}
+	c := make([]string, 0, len(seen))
+	for field := range seen {
+		c = append(c, field)
+	}
+	sort.Strings(c)
+	return c
+}
+
+// canonicalOptions copies the options of a query. Options set to false are kept, since an option that is explicitly
+// false is not always the same as one that is unset (e.g. a MeSH heading that is explicitly not exploded).
+func canonicalOptions(options map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		c[k] = v
+	}
+	return c
+}
+
+// isCommutative determines if the order of the children of an operator does not matter.
+func isCommutative(operator string) bool {
+	return operator == cqr.AND || operator == cqr.OR
+}
+
+// Canonical rewrites a query into a canonical form, so that queries that are logically the same have the same
+// canonical form. In the canonical form:
+//
+//   - query strings are lowercase with whitespace collapsed, and operators are lowercase;
+//   - fields are normalised (see canonicalFields);
+//   - and/or clauses nested in a clause with the same operator are flattened into it;
+//   - and/or clauses with a single child are replaced by the child;
+//   - duplicate children of and/or clauses are removed, and the children are sorted.
+//
+// The order of the children of not and adjacency clauses is significant, so they are not sorted.
+func Canonical(query cqr.CommonQueryRepresentation) cqr.CommonQueryRepresentation {
+	switch q := query.(type) {
+	case cqr.Keyword:
+		return cqr.Keyword{
+			QueryString: strings.Join(strings.Fields(strings.ToLower(q.QueryString)), " "),
+			Fields:      canonicalFields(q.Fields),
+			Options:     canonicalOptions(q.Options),
+		}
+	case cqr.BooleanQuery:
+		operator := strings.ToLower(strings.TrimSpace(q.Operator))
+		var children []cqr.CommonQueryRepresentation
+		for _, child := range q.Children {
+			c := Canonical(child)
+			if b, ok := c.(cqr.BooleanQuery); ok && isCommutative(operator) && b.Operator == operator {
+				children = append(children, b.Children...)
+				continue
+			}
+			children = append(children, c)
+		}
+
+		if isCommutative(operator) {
+			type keyed struct {
+				key   string
+				query cqr.CommonQueryRepresentation
+			}
+			seen := make(map[string]bool)
+			var unique []keyed
+			for _, child := range children {
+				k := canonicalString(child)
+				if !seen[k] {
+					seen[k] = true
+					unique = append(unique, keyed{key: k, query: child})
+				}
+			}
+			sort.Slice(unique, func(i, j int) bool {
+				return unique[i].key < unique[j].key
+			})
+			if len(unique) == 1 {
+				return unique[0].query
+			}
+			children = make([]cqr.CommonQueryRepresentation, len(unique))
+			for i, u := range unique {
+				children[i] = u.query
+			}
+		}
+		return cqr.BooleanQuery{
+			Operator: operator,
+			Children: children,
+			Options:  canonicalOptions(q.Options),
+		}
+	}
+	return query
+}
+
+// canonicalString formats a query that is already in canonical form. Unlike the String method of queries, the
+// format does not depend on the order of options.
+func canonicalString(query cqr.CommonQueryRepresentation) string {
+	var options map[string]interface{}
+	var s string
+	switch q := query.(type) {
+	case cqr.Keyword:
+		s = fmt.Sprintf("%q[%s]", q.QueryString, strings.Join(q.Fields, ","))
+		options = q.Options
+	case cqr.BooleanQuery:
+		children := make([]string, len(q.Children))
+		for i, child := range q.Children {
+			children[i] = canonicalString(child)
+		}
+		s = fmt.Sprintf("%s(%s)", q.Operator, strings.Join(children, " "))
+		options = q.Options
+	default:
+		return ""
+	}
+
+	if len(options) > 0 {
+		keys := make([]string, 0, len(options))
+		for k := range options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		o := make([]string, len(keys))
+		for i, k := range keys {
+			o[i] = fmt.Sprintf("%s=%v", k, options[k])
+		}
+		s += "{" + strings.Join(o, ",") + "}"
+	}
+	return s
+}
+
+// CanonicalString is a string representation of a query that is the same for queries that are logically the same
+// (see Canonical).
+func CanonicalString(query cqr.CommonQueryRepresentation) string {
+	if query == nil {
+		return ""
+	}
+	return canonicalString(Canonical(query))
+}
+
+// Equivalent determines if two queries are logically the same (see Canonical).
+func Equivalent(a, b cqr.CommonQueryRepresentation) bool {
+	return CanonicalString(a) == CanonicalString(b)
+}
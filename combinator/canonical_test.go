@@ -0,0 +1,55 @@
+package combinator_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/combinator"
+	"github.com/hscells/transmute/fields"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	a := cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("Breast  Cancer", fields.Title, fields.Abstract),
+		cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("neoplasms", fields.MeSHTerms).SetOption(cqr.ExplodedString, true),
+			cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+				cqr.NewKeyword("tumour", fields.TitleAbstract),
+			}),
+		}),
+		cqr.NewBooleanQuery(cqr.NOT, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("rat", fields.TitleAbstract),
+			cqr.NewKeyword("mouse", fields.TitleAbstract),
+		}),
+	})
+	b := cqr.NewBooleanQuery("OR", []cqr.CommonQueryRepresentation{
+		cqr.NewBooleanQuery(cqr.NOT, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("rat", fields.TitleAbstract),
+			cqr.NewKeyword("mouse", fields.TitleAbstract),
+		}),
+		cqr.NewKeyword("Tumour", fields.TitleAbstract),
+		cqr.NewKeyword("neoplasms", fields.MeshHeadings).SetOption(cqr.ExplodedString, true),
+		cqr.NewKeyword("breast cancer", fields.TitleAbstract),
+		cqr.NewKeyword("tumour", fields.TitleAbstract),
+	})
+
+	if !combinator.Equivalent(a, b) {
+		t.Errorf("expected %s and %s to be equivalent", combinator.CanonicalString(a), combinator.CanonicalString(b))
+	}
+	if combinator.HashCQR(a) != combinator.HashCQR(b) {
+		t.Error("expected equivalent queries to have the same hash")
+	}
+
+	// The order of the children of a not clause is significant.
+	c := cqr.NewBooleanQuery(cqr.NOT, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("mouse", fields.TitleAbstract),
+		cqr.NewKeyword("rat", fields.TitleAbstract),
+	})
+	if combinator.Equivalent(c, a.Children[2]) {
+		t.Error("expected not clauses with reordered children to differ")
+	}
+
+	// An option that is explicitly false is not the same as one that is unset.
+	if combinator.Equivalent(cqr.NewKeyword("neoplasms", fields.MeshHeadings).SetOption(cqr.ExplodedString, false), cqr.NewKeyword("neoplasms", fields.MeshHeadings)) {
+		t.Error("expected a heading that is explicitly not exploded to differ from one without the option")
+	}
+}
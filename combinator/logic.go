@@ -366,12 +366,12 @@ func NewCombinator(query cqr.BooleanQuery, operator Operator, clauses ...Logical
 	}
 }
 
-// HashCQR creates a hash of the query.
+// HashCQR creates a hash of the query. Queries that are logically the same (see Canonical) have the same hash.
 func HashCQR(representation cqr.CommonQueryRepresentation) uint64 {
 	if representation == nil {
 		return 0
 	}
-	return crc64.Checksum([]byte(representation.String()), crc64.MakeTable(crc64.ISO))
+	return crc64.Checksum([]byte(CanonicalString(representation)), crc64.MakeTable(crc64.ISO))
 	//h := fnv.New64a()
 	//h.Write([]byte(representation.String()))
 	//return h.Sum64()
@@ -479,7 +479,7 @@ func constructTree(query pipeline.Query, ss stats.StatisticsSource, seen QueryCa
 			go func(idx int, c cqr.CommonQueryRepresentation) {
 				defer wg.Done()
 				var err error
-				clauses[idx], seen, err = constructTree(pipeline.NewQuery(query.Name, query.Topic, c), ss, seen)
+				clauses[idx], seen, err = constructTree(query.WithQuery(c), ss, seen)
 				if err != nil {
 					once.Do(func() {
 						errOnce = err
@@ -0,0 +1,40 @@
+package eval
+
+// NamedEvaluators creates the evaluation measures that can be referred to by name, for
+// instance from the command line or over RPC. The collection size is required by measures
+// such as work saved over sampling.
+func NamedEvaluators(collectionSize float64) map[string]Evaluator {
+	return map[string]Evaluator{
+		"precision":     Precision,
+		"precision_res": NewResidualEvaluator(Precision),
+		"precision_mle": NewMaximumLikelihoodEvaluator(Precision),
+		"recall":        Recall,
+		"recall_res":    NewResidualEvaluator(Recall),
+		"recall_mle":    NewMaximumLikelihoodEvaluator(Recall),
+		"f1":            F1Measure,
+		"f1_res":        NewResidualEvaluator(F1Measure),
+		"f1_mle":        NewMaximumLikelihoodEvaluator(F1Measure),
+		"f0.5":          F05Measure,
+		"f0.5_res":      NewResidualEvaluator(F05Measure),
+		"f0.5_mle":      NewMaximumLikelihoodEvaluator(F05Measure),
+		"f3":            F3Measure,
+		"f3_res":        NewResidualEvaluator(F3Measure),
+		"f3_mle":        NewMaximumLikelihoodEvaluator(F3Measure),
+		"nnr":           NNR,
+		"wss":           NewWSSEvaluator(collectionSize),
+		"wss_res":       NewResidualEvaluator(NewWSSEvaluator(collectionSize)),
+		"wss_mle":       NewMaximumLikelihoodEvaluator(NewWSSEvaluator(collectionSize)),
+		"num_ret":       NumRet,
+		"num_rel":       NumRel,
+		"num_rel_ret":   NumRelRet,
+		"ap":            AP,
+		"p@10":          PrecisionAtK{K: 10},
+		"p@1000":        PrecisionAtK{K: 1000},
+		"ndcg":          NDCG{},
+		"ndcg@5":        NDCG{K: 5},
+		"ndcg@10":       NDCG{K: 10},
+		"ndcg@100":      NDCG{K: 100},
+		"ndcg@200":      NDCG{K: 200},
+		"ndcg@500":      NDCG{K: 500},
+	}
+}
@@ -0,0 +1,96 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/hscells/trecresults"
+	"os"
+)
+
+// ThresholdEvaluator wraps an existing evaluator so that it scores results using a relevance
+// threshold particular to one set of qrels, rather than the package-level RelevanceGrade.
+// A document is considered relevant when its qrel score is strictly greater than Grade.
+type ThresholdEvaluator struct {
+	Evaluator
+	Grade int64
+}
+
+// Threshold shifts the scores of qrels so that any document scored above grade is considered relevant
+// under the package-level RelevanceGrade. The relative difference between scores is preserved, so
+// graded measures (e.g. nDCG) are only affected by a constant offset.
+func Threshold(qrels trecresults.Qrels, grade int64) trecresults.Qrels {
+	if grade == RelevanceGrade {
+		return qrels
+	}
+	shifted := make(trecresults.Qrels, len(qrels))
+	for k, v := range qrels {
+		q := *v
+		q.Score = v.Score - grade + RelevanceGrade
+		shifted[k] = &q
+	}
+	return shifted
+}
+
+// Score scores the results against the qrels using the threshold of the evaluator.
+func (t ThresholdEvaluator) Score(results *trecresults.ResultList, qrels trecresults.Qrels) float64 {
+	return t.Evaluator.Score(results, Threshold(qrels, t.Grade))
+}
+
+// NewThresholdEvaluator creates a new evaluator which wraps an existing evaluator with a relevance threshold.
+func NewThresholdEvaluator(evaluator Evaluator, grade int64) ThresholdEvaluator {
+	return ThresholdEvaluator{
+		Evaluator: evaluator,
+		Grade:     grade,
+	}
+}
+
+// Stage is a single level of relevance assessment for a collection. Systematic review collections,
+// for instance, are often assessed at an abstract level and then again at a content level.
+type Stage struct {
+	Name           string
+	Qrels          trecresults.QrelsFile
+	RelevanceGrade int64
+}
+
+// NewStage creates a new stage of assessment by loading the qrels file at the specified path.
+func NewStage(name, qrels string, grade int64) (Stage, error) {
+	f, err := os.OpenFile(qrels, os.O_RDONLY, 0664)
+	if err != nil {
+		return Stage{}, err
+	}
+	defer f.Close()
+	q, err := trecresults.QrelsFromReader(f)
+	if err != nil {
+		return Stage{}, err
+	}
+	return Stage{
+		Name:           name,
+		Qrels:          q,
+		RelevanceGrade: grade,
+	}, nil
+}
+
+// Evaluate scores documents for a topic at this stage of assessment. The names of the
+// evaluation measures are the same as the names of the evaluators.
+func (s Stage) Evaluate(evaluators []Evaluator, results *trecresults.ResultList, topic string) map[string]float64 {
+	e := make([]Evaluator, len(evaluators))
+	for i, evaluator := range evaluators {
+		e[i] = NewThresholdEvaluator(evaluator, s.RelevanceGrade)
+	}
+	return Evaluate(e, results, s.Qrels, topic)
+}
+
+// EvaluateStages scores documents for a topic at each stage of assessment. Each measure in the
+// result is qualified by the name of the stage, so that, for example, abstract and content level
+// recall can be reported side by side as `abstract.Recall` and `content.Recall`.
+func EvaluateStages(evaluators []Evaluator, results *trecresults.ResultList, stages []Stage, topic string) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, stage := range stages {
+		// Some evaluators modify the results list, so each stage is given its own copy.
+		r := make(trecresults.ResultList, len(*results))
+		copy(r, *results)
+		for measure, score := range stage.Evaluate(evaluators, &r, topic) {
+			scores[fmt.Sprintf("%s.%s", stage.Name, measure)] = score
+		}
+	}
+	return scores
+}
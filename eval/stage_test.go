@@ -0,0 +1,52 @@
+package eval_test
+
+import (
+	"github.com/hscells/groove/eval"
+	"github.com/hscells/trecresults"
+	"testing"
+)
+
+func TestEvaluateStages(t *testing.T) {
+	abstract := trecresults.QrelsFile{Qrels: map[string]trecresults.Qrels{
+		"1": {
+			"1": &trecresults.Qrel{Topic: "1", DocId: "1", Score: 1},
+			"2": &trecresults.Qrel{Topic: "1", DocId: "2", Score: 1},
+			"3": &trecresults.Qrel{Topic: "1", DocId: "3", Score: 0},
+		},
+	}}
+	content := trecresults.QrelsFile{Qrels: map[string]trecresults.Qrels{
+		"1": {
+			"1": &trecresults.Qrel{Topic: "1", DocId: "1", Score: 1},
+			"2": &trecresults.Qrel{Topic: "1", DocId: "2", Score: 0},
+			"3": &trecresults.Qrel{Topic: "1", DocId: "3", Score: 0},
+		},
+	}}
+
+	results := &trecresults.ResultList{
+		&trecresults.Result{Topic: "1", DocId: "2"},
+		&trecresults.Result{Topic: "1", DocId: "4"},
+	}
+
+	stages := []eval.Stage{
+		{Name: "abstract", Qrels: abstract, RelevanceGrade: 0},
+		{Name: "content", Qrels: content, RelevanceGrade: 0},
+	}
+
+	grade := eval.RelevanceGrade
+	scores := eval.EvaluateStages([]eval.Evaluator{eval.Recall, eval.NumRel}, results, stages, "1")
+	if eval.RelevanceGrade != grade {
+		t.Fatalf("package-level relevance grade was modified: %d", eval.RelevanceGrade)
+	}
+
+	expected := map[string]float64{
+		"abstract.Recall": 0.5,
+		"abstract.NumRel": 2,
+		"content.Recall":  0,
+		"content.NumRel":  1,
+	}
+	for measure, score := range expected {
+		if scores[measure] != score {
+			t.Errorf("expected %s to be %f, got %f", measure, score, scores[measure])
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/hscells/cqr"
 	"github.com/hscells/groove/eval"
 	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/preprocess"
 	"github.com/hscells/groove/stats"
 	"github.com/hscells/guru"
 	"github.com/hscells/trecresults"
@@ -41,6 +42,7 @@ type ObjectiveFormulator struct {
 	MeSHK                                  []int
 	DevK, PopK                             []float64
 	minDocs                                int
+	pubdates                               preprocess.TopicDateRestrictions
 
 	population     BackgroundCollection
 	splitter       Splitter
@@ -105,7 +107,7 @@ func ObjectiveQuery(query pipeline.Query) ObjectiveOption {
 	}
 }
 
-func NewObjectiveFormulator(s stats.EntrezStatisticsSource, qrels trecresults.Qrels, population BackgroundCollection, folder, pubdates, semTypes, metamapURL string, optimisation eval.Evaluator, options ...ObjectiveOption) *ObjectiveFormulator {
+func NewObjectiveFormulator(s stats.EntrezStatisticsSource, qrels trecresults.Qrels, population BackgroundCollection, folder, pubdates, semTypes, metamapURL string, optimisation eval.Evaluator, options ...ObjectiveOption) (*ObjectiveFormulator, error) {
 	o := &ObjectiveFormulator{
 		s:            s,
 		qrels:        qrels,
@@ -130,7 +132,15 @@ func NewObjectiveFormulator(s stats.EntrezStatisticsSource, qrels trecresults.Qr
 		option(o)
 	}
 
-	return o
+	if len(pubdates) > 0 {
+		var err error
+		o.pubdates, err = preprocess.LoadDateRestrictions(pubdates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
 }
 
 func (o ObjectiveFormulator) Derive() (cqr.CommonQueryRepresentation, cqr.CommonQueryRepresentation, []guru.MedlineDocument, []guru.MedlineDocument, []guru.MedlineDocument, error) {
@@ -200,12 +210,16 @@ func (o ObjectiveFormulator) Formulate(query pipeline.Query) ([]cqr.CommonQueryR
 		return nil, nil, err
 	}
 
-	resNoMesh, err := o.s.Execute(pipeline.NewQuery("objective_nomesh", o.Topic(), q1), o.s.SearchOptions())
+	noMesh := query.WithQuery(q1)
+	noMesh.Name = "objective_nomesh"
+	resNoMesh, err := o.s.Execute(noMesh, o.s.SearchOptions())
 	if err != nil {
 		return nil, nil, err
 	}
 
-	resMesh, err := o.s.Execute(pipeline.NewQuery("objective_mesh", o.Topic(), q2), o.s.SearchOptions())
+	mesh := query.WithQuery(q2)
+	mesh.Name = "objective_mesh"
+	resMesh, err := o.s.Execute(mesh, o.s.SearchOptions())
 	if err != nil {
 		return nil, nil, err
 	}
@@ -9,7 +9,6 @@ import (
 	"github.com/hscells/groove/combinator"
 	"github.com/hscells/groove/eval"
 	"github.com/hscells/groove/pipeline"
-	"github.com/hscells/groove/preprocess"
 	"github.com/hscells/groove/stats"
 	"github.com/hscells/guru"
 	"github.com/hscells/meshexp"
@@ -967,6 +966,22 @@ func rankTerms(t TermStatistics, dev []guru.MedlineDocument, topic, folder strin
 	return terms
 }
 
+// restrictDates restricts the publication dates of a query. The date restriction in the metadata of the query
+// being formulated is preferred over the date restriction in the pubdates file.
+func (o ObjectiveFormulator) restrictDates(q cqr.CommonQueryRepresentation) (cqr.CommonQueryRepresentation, error) {
+	d, err := o.query.DateRestriction()
+	if err != nil {
+		return nil, err
+	}
+	if d != nil {
+		return d.Restrict(q), nil
+	}
+	if o.pubdates == nil {
+		return q, nil
+	}
+	return o.pubdates.Restrict(q, o.query.Topic), nil
+}
+
 // derive actually performs the objective derivation for the objective method.
 func (o ObjectiveFormulator) derive(devDF TermStatistics, dev, val []guru.MedlineDocument, population BackgroundCollection, m eval.Evaluator) (cqr.CommonQueryRepresentation, cqr.CommonQueryRepresentation, error) {
 	var (
@@ -1034,7 +1049,10 @@ func (o ObjectiveFormulator) derive(devDF TermStatistics, dev, val []guru.Medlin
 			// Create the query from the three categories.
 			q := constructQuery(conditionsKeywords, treatmentsKeywords, studyTypesKeywords)
 			fmt.Println(q)
-			q = preprocess.DateRestrictions(o.Pubdates)(q, o.query.Topic)()
+			q, err = o.restrictDates(q)
+			if err != nil {
+				return nil, nil, err
+			}
 			fmt.Println(q)
 
 			fmt.Println("evaluating final query")
@@ -1065,7 +1083,10 @@ func (o ObjectiveFormulator) derive(devDF TermStatistics, dev, val []guru.Medlin
 			return nil, nil, err
 		}
 		qWithMeSH := constructQuery(conditionsKeywordsWithMeSH, treatmentsKeywordsWithMeSH, studyTypesKeywordsWithMeSH)
-		qWithMeSH = preprocess.DateRestrictions(o.Pubdates)(qWithMeSH, o.query.Topic)()
+		qWithMeSH, err = o.restrictDates(qWithMeSH)
+		if err != nil {
+			return nil, nil, err
+		}
 
 		ev, err := evaluate(qWithMeSH, o.s, dev, val, nil, o.Topic())
 		if err != nil {
@@ -72,7 +72,9 @@ func (qc *QueryChain) Generate() error {
 	for _, cq := range qc.Queries {
 		c := make(chan GenerationResult)
 
-		go qc.GenerationExplorer.Traverse(NewCandidateQuery(cq.Query, cq.Topic, nil), c)
+		candidate := NewCandidateQuery(cq.Query, cq.Topic, nil)
+		candidate.Metadata = cq.Metadata
+		go qc.GenerationExplorer.Traverse(candidate, c)
 
 		for result := range c {
 
@@ -224,6 +226,7 @@ func (qc *QueryChain) Execute(q pipeline.Query) (CandidateQuery, error) {
 		stop bool
 	)
 	cq := NewCandidateQuery(q.Query, q.Topic, nil)
+	cq.Metadata = q.Metadata
 	sel := qc.CandidateSelector
 	stop = sel.StoppingCriteria()
 	d := 0
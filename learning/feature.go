@@ -6,6 +6,7 @@ import (
 	"github.com/go-errors/errors"
 	"github.com/hscells/cqr"
 	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/analysis/diff"
 	"github.com/hscells/groove/analysis/preqpp"
 	"github.com/hscells/groove/pipeline"
 	"github.com/hscells/groove/stats"
@@ -63,6 +64,10 @@ const (
 	// Protocol Query Type (when generated automatically from a protocol).
 	ProtocolQueryTypeFeature
 
+	// Spelling variant expansion.
+	SpellingVariantFeature
+	SpellingNumVariantsFeature
+
 	// Chain of transformations !!THIS MUST BE THE LAST FEATURE IN THE LIST!!
 	chainFeatures
 )
@@ -132,6 +137,7 @@ type CandidateQuery struct {
 	Topic            string
 	Query            cqr.CommonQueryRepresentation
 	Chain            []CandidateQuery
+	Metadata         map[string]string
 	Features
 }
 
@@ -388,6 +394,8 @@ func transformationFeature(transformer Transformer) Feature {
 		transformationType.Score = Cui2vecExpansionTransformation
 	case meshParent:
 		transformationType.Score = MeshParentTransformation
+	case spellingVariants:
+		transformationType.Score = SpellingVariantTransformation
 	}
 	return transformationType
 }
@@ -473,18 +481,36 @@ func NewCandidateQuery(query cqr.CommonQueryRepresentation, topic string, ff Fea
 	}
 }
 
+// PipelineQuery creates a pipeline query from the candidate query. The metadata of the query the candidate was
+// derived from (e.g., the date restriction) is kept.
+func (c CandidateQuery) PipelineQuery() pipeline.Query {
+	return pipeline.Query{Name: c.Topic, Topic: c.Topic, Query: c.Query, Metadata: c.Metadata}
+}
+
 // SetTransformationID sets the transformation id to the candidate query.
 func (c CandidateQuery) SetTransformationID(id int) CandidateQuery {
 	c.TransformationID = id
 	return c
 }
 
+// Diff reports the changes made by the transformation that produced the candidate query, i.e. the changes from the
+// previous query in the chain.
+func (c CandidateQuery) Diff() diff.Diff {
+	if len(c.Chain) == 0 {
+		return diff.Queries(c.Query, c.Query)
+	}
+	return diff.Queries(c.Chain[len(c.Chain)-1].Query, c.Query)
+}
+
 // Append adds the previous query to the chain of transformations so far so we can keep track of which transformations
 // have been applied up until this point, and for Features about the query.
 func (c CandidateQuery) Append(query CandidateQuery) CandidateQuery {
 
 	query.Chain = append(query.Chain, query)
 	c.Chain = append(c.Chain, query.Chain...)
+	if c.Metadata == nil {
+		c.Metadata = query.Metadata
+	}
 
 	prevID := ChainFeatures
 	var features Features
@@ -111,7 +111,7 @@ func (qr QuickRankQueryCandidateSelector) Select(query CandidateQuery, transform
 	f.Truncate(0)
 	f.Seek(0, 0)
 
-	ret, err := qr.s.RetrievalSize(query.Query)
+	ret, err := stats.RetrievalSize(qr.s, query.PipelineQuery())
 	if err != nil {
 		return CandidateQuery{}, nil, err
 	}
@@ -127,7 +127,7 @@ func (u NearestNeighbourQueryCandidateSelector) Select(query CandidateQuery, tra
 		log.Printf("best: %f, worst: %f\n", queries[0].divergence, queries[len(queries)-1].divergence)
 	}
 
-	ret, err := u.s.RetrievalSize(queries[0].query.Query)
+	ret, err := stats.RetrievalSize(u.s, queries[0].query.PipelineQuery())
 	if err != nil {
 		return CandidateQuery{}, nil, err
 	}
@@ -125,7 +125,7 @@ func (oc OracleQueryChainCandidateSelector) Select(query CandidateQuery, candida
 		nq := pipeline.NewQuery(query.Topic, query.Topic, applied.Query)
 
 		// Test if the query actually is executable.
-		_, err := oc.ss.RetrievalSize(applied.Query)
+		_, err := stats.RetrievalSize(oc.ss, applied.PipelineQuery())
 		if err != nil {
 			continue
 		}
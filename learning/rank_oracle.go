@@ -47,7 +47,7 @@ func (r RankOracleCandidateSelector) Select(query CandidateQuery, transformation
 		r.depth = r.maxDepth
 	}
 
-	ret, err := r.ss.RetrievalSize(ranked[0].query.Query)
+	ret, err := stats.RetrievalSize(r.ss, ranked[0].query.PipelineQuery())
 	if err != nil {
 		return CandidateQuery{}, nil, err
 	}
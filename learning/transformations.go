@@ -7,6 +7,8 @@ import (
 	"github.com/hscells/groove/analysis"
 	"github.com/hscells/groove/combinator"
 	"github.com/hscells/groove/formulation"
+	"github.com/hscells/groove/preprocess"
+	"github.com/hscells/groove/preprocess/analyser"
 	"github.com/hscells/groove/stats"
 	"github.com/hscells/quickumlsrest"
 	"github.com/hscells/transmute/fields"
@@ -27,6 +29,7 @@ const (
 	ClauseRemovalTransformation
 	Cui2vecExpansionTransformation
 	MeshParentTransformation
+	SpellingVariantTransformation
 )
 
 // Transformer is applied to a query to generate a set of query candidates.
@@ -75,6 +78,10 @@ type cui2vecExpansion struct {
 
 type meshParent struct{}
 
+type spellingVariants struct {
+	variants analyser.SpellingVariants
+}
+
 // NewLogicalOperatorTransformer creates a logical operator transformation.
 func NewLogicalOperatorTransformer() Transformation {
 	t := Transformation{ID: LogicalOperatorTransformation, Transformer: logicalOperatorReplacement{}, BooleanTransformer: logicalOperatorReplacement{}}
@@ -130,6 +137,16 @@ func NewMeshParentTransformer() Transformation {
 	return Transformation{ID: MeshParentTransformation, Transformer: meshParent{}}
 }
 
+// NewSpellingVariantTransformer creates a transformer that expands keywords with their other spellings (e.g.
+// tumour and tumor). When no variants are specified, analyser.DefaultSpellingVariants are used.
+func NewSpellingVariantTransformer(variants ...analyser.SpellingVariants) Transformation {
+	v := analyser.DefaultSpellingVariants
+	if len(variants) > 0 {
+		v = variants[0]
+	}
+	return Transformation{ID: SpellingVariantTransformation, Transformer: spellingVariants{variants: v}}
+}
+
 var ComputeFeatures = true
 
 // variations creates the variations of an input candidate query in the transformation chain using the specified
@@ -742,3 +759,34 @@ func (meshParent) Features(query cqr.CommonQueryRepresentation, context Transfor
 func (meshParent) Name() string {
 	return "MeshParent"
 }
+
+func (s spellingVariants) Apply(query cqr.CommonQueryRepresentation) (queries []cqr.CommonQueryRepresentation, err error) {
+	switch q := query.(type) {
+	case cqr.Keyword:
+		if expanded, ok := preprocess.ExpandSpelling(q, s.variants).(cqr.BooleanQuery); ok {
+			queries = append(queries, expanded)
+		}
+	}
+	return
+}
+
+func (spellingVariants) BooleanApplicable() bool {
+	return false
+}
+
+func (spellingVariants) Features(query cqr.CommonQueryRepresentation, context TransformationContext) Features {
+	var features Features
+	switch q := query.(type) {
+	case cqr.BooleanQuery:
+		features = booleanFeatures(q)
+	case cqr.Keyword:
+		features = keywordFeatures(q)
+	}
+	// The expanded query is the original keyword and its variants.
+	variants := len(analysis.QueryKeywords(query)) - 1
+	return append(features, NewFeature(SpellingVariantFeature, 1), NewFeature(SpellingNumVariantsFeature, float64(variants)))
+}
+
+func (spellingVariants) Name() string {
+	return "SpellingVariants"
+}
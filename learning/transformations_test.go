@@ -10,6 +10,7 @@ import (
 	"github.com/hscells/groove/stats"
 	"github.com/hscells/quickumlsrest"
 	"github.com/hscells/transmute/backend"
+	"github.com/hscells/transmute/fields"
 	"github.com/hscells/transmute/lexer"
 	"github.com/hscells/transmute/parser"
 	"github.com/hscells/transmute/pipeline"
@@ -110,3 +111,54 @@ func TestLogicalOperatorReplacement_Apply(t *testing.T) {
 	}
 
 }
+
+func TestSpellingVariantTransformer(t *testing.T) {
+	transformation := learning.NewSpellingVariantTransformer()
+	if transformation.ID != learning.SpellingVariantTransformation {
+		t.Errorf("expected the spelling variant transformation, got %d", transformation.ID)
+	}
+	if transformation.BooleanApplicable() {
+		t.Error("expected the transformer to only apply to keywords")
+	}
+
+	queries, err := transformation.Apply(cqr.NewKeyword("tumour", fields.TitleAbstract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 {
+		t.Fatalf("expected one expanded query, got %v", queries)
+	}
+	expanded, ok := queries[0].(cqr.BooleanQuery)
+	if !ok || expanded.Operator != cqr.OR || len(expanded.Children) != 2 {
+		t.Fatalf("expected the keyword to be expanded with its variant, got %v", queries[0])
+	}
+	if k := expanded.Children[1].(cqr.Keyword); k.QueryString != "tumor" || len(k.Fields) != 1 || k.Fields[0] != fields.TitleAbstract {
+		t.Errorf("expected the variant tumor in the same field, got %v", k)
+	}
+
+	// Keywords without variants, controlled vocabulary, and Boolean queries are not transformed.
+	for _, query := range []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("cancer", fields.TitleAbstract),
+		cqr.NewKeyword("tumour", fields.MeshHeadings),
+		cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{cqr.NewKeyword("tumour", fields.TitleAbstract)}),
+	} {
+		queries, err := transformation.Apply(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queries) != 0 {
+			t.Errorf("expected %v not to be transformed, got %v", query, queries)
+		}
+	}
+
+	scores := make(map[int]float64)
+	for _, feature := range transformation.Features(expanded, learning.TransformationContext{}) {
+		scores[feature.ID] = feature.Score
+	}
+	if scores[learning.SpellingVariantFeature] != 1 {
+		t.Errorf("expected the spelling variant feature to be set, got %v", scores)
+	}
+	if scores[learning.SpellingNumVariantsFeature] != 1 {
+		t.Errorf("expected one variant, got %v", scores[learning.SpellingNumVariantsFeature])
+	}
+}
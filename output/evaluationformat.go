@@ -0,0 +1,612 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EvaluationOptions are the optional components of an evaluation formatter.
+type EvaluationOptions struct {
+	// RunName is the name of the run being formatted (used in tables).
+	RunName string
+	// Confidence is the confidence level of intervals around the mean (e.g. 0.95). Zero disables intervals.
+	Confidence float64
+	// Baseline is the evaluation of a baseline run that per-topic deltas are computed against.
+	Baseline map[string]map[string]float64
+	// BaselineName is the name of the baseline run (used in tables).
+	BaselineName string
+	// PerTopic includes a row for each topic in tables.
+	PerTopic bool
+	// OmitMean omits the mean of each measure, e.g. when the rows are not topics.
+	OmitMean bool
+	// Precision is the number of decimal places values are formatted to.
+	Precision int
+	// LowerIsBetter determines if lower values of a measure are better (e.g. losses and errors), which decides the
+	// value that is bolded in tables.
+	LowerIsBetter func(measure string) bool
+}
+
+// RunEvaluation is the evaluation of a single run, i.e. measures for each topic.
+type RunEvaluation struct {
+	Name       string
+	Evaluation map[string]map[string]float64
+}
+
+// EvaluationRunName sets the name of the run being formatted.
+func EvaluationRunName(name string) func(*EvaluationOptions) {
+	return func(o *EvaluationOptions) {
+		o.RunName = name
+	}
+}
+
+// EvaluationConfidenceInterval includes confidence intervals around the mean of each measure at the specified level.
+func EvaluationConfidenceInterval(level float64) func(*EvaluationOptions) {
+	return func(o *EvaluationOptions) {
+		o.Confidence = level
+	}
+}
+
+// EvaluationBaseline includes per-topic deltas against the evaluation of a baseline run.
+func EvaluationBaseline(name string, baseline map[string]map[string]float64) func(*EvaluationOptions) {
+	return func(o *EvaluationOptions) {
+		o.BaselineName = name
+		o.Baseline = baseline
+	}
+}
+
+// EvaluationPerTopic includes the per-topic values in tables.
+func EvaluationPerTopic(perTopic bool) func(*EvaluationOptions) {
+	return func(o *EvaluationOptions) {
+		o.PerTopic = perTopic
+	}
+}
+
+// EvaluationOmitMean omits the mean (`all`) of each measure, and its confidence interval and delta. The mean is
+// meaningless when the rows are not topics, e.g. the correlations of query performance predictors (which are keyed
+// by predictor). Tables then include the row for each topic, since the row of a run is the mean.
+func EvaluationOmitMean(omit bool) func(*EvaluationOptions) {
+	return func(o *EvaluationOptions) {
+		o.OmitMean = omit
+	}
+}
+
+// EvaluationPrecision sets the number of decimal places values are formatted to.
+func EvaluationPrecision(precision int) func(*EvaluationOptions) {
+	return func(o *EvaluationOptions) {
+		o.Precision = precision
+	}
+}
+
+// EvaluationLowerIsBetter marks measures for which lower values are better, in addition to those that are by
+// default (see LowerIsBetter).
+func EvaluationLowerIsBetter(measures ...string) func(*EvaluationOptions) {
+	return func(o *EvaluationOptions) {
+		lower := o.LowerIsBetter
+		m := make(map[string]bool)
+		for _, measure := range measures {
+			m[measure] = true
+		}
+		o.LowerIsBetter = func(measure string) bool {
+			return m[measure] || lower(measure)
+		}
+	}
+}
+
+// LowerIsBetter determines if lower values of a measure are better. By default, these are the number needed to read
+// (NNR), losses (e.g. WSS-loss), and errors (e.g. the sMARE of query performance predictors).
+func LowerIsBetter(measure string) bool {
+	m := strings.ToLower(measure)
+	return strings.HasPrefix(m, "nnr") || strings.Contains(m, "loss") || strings.Contains(m, "smare")
+}
+
+func newEvaluationOptions(options ...func(*EvaluationOptions)) EvaluationOptions {
+	o := EvaluationOptions{
+		RunName:       "run",
+		BaselineName:  "baseline",
+		Precision:     4,
+		LowerIsBetter: LowerIsBetter,
+	}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+// evaluationMeasures extracts the sorted set of measure names from an evaluation.
+func evaluationMeasures(results ...map[string]map[string]float64) []string {
+	seen := make(map[string]bool)
+	var measures []string
+	for _, r := range results {
+		for _, topic := range r {
+			for measure := range topic {
+				if !seen[measure] {
+					seen[measure] = true
+					measures = append(measures, measure)
+				}
+			}
+		}
+	}
+	sort.Strings(measures)
+	return measures
+}
+
+// evaluationTopics extracts the sorted topics from an evaluation.
+func evaluationTopics(results map[string]map[string]float64) []string {
+	topics := make([]string, 0, len(results))
+	for topic := range results {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// evaluationSummary is the mean and confidence interval of a measure over topics.
+type evaluationSummary struct {
+	Mean float64
+	Low  float64
+	High float64
+	N    int
+}
+
+// summarise computes the mean of a measure over all topics that it was computed for. If a confidence level is
+// specified, the bounds of the interval are computed using Student's t-distribution. The bounds are NaN when there is
+// no interval, i.e. without a confidence level or when the measure was computed for a single topic.
+func summarise(results map[string]map[string]float64, measure string, confidence float64) evaluationSummary {
+	var values []float64
+	for _, topic := range results {
+		if v, ok := topic[measure]; ok {
+			values = append(values, v)
+		}
+	}
+	s := evaluationSummary{N: len(values), Mean: math.NaN(), Low: math.NaN(), High: math.NaN()}
+	if len(values) == 0 {
+		return s
+	}
+	s.Mean = stat.Mean(values, nil)
+	if confidence > 0 && len(values) > 1 {
+		t := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: float64(len(values) - 1)}.Quantile(1 - (1-confidence)/2)
+		h := t * stat.StdErr(stat.StdDev(values, nil), float64(len(values)))
+		s.Low, s.High = s.Mean-h, s.Mean+h
+	}
+	return s
+}
+
+// meanDelta computes the mean difference of a measure from the baseline over the topics that it was computed for in
+// both, so that it is the mean of the per-topic deltas. It is NaN if there are no such topics.
+func meanDelta(results, baseline map[string]map[string]float64, measure string) float64 {
+	var deltas []float64
+	for topic := range results {
+		if d, ok := delta(results, baseline, topic, measure); ok {
+			deltas = append(deltas, d)
+		}
+	}
+	if len(deltas) == 0 {
+		return math.NaN()
+	}
+	return stat.Mean(deltas, nil)
+}
+
+// delta computes the difference of a measure for a topic from the baseline.
+func delta(results, baseline map[string]map[string]float64, topic, measure string) (float64, bool) {
+	v, ok := results[topic][measure]
+	if !ok {
+		return 0, false
+	}
+	b, ok := baseline[topic][measure]
+	if !ok {
+		return 0, false
+	}
+	return v - b, true
+}
+
+func formatValue(v float64, precision int) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return strconv.FormatFloat(v, 'f', precision, 64)
+}
+
+// NewTrecEvaluationFormatter creates a formatter that outputs results in the same format as trec_eval -q. That is,
+// each line contains the measure, topic, and value separated by tabs, and the mean of each measure is output with
+// the topic `all`. Confidence intervals are output as `<measure>_ci_low` and `<measure>_ci_high`, and deltas
+// against a baseline are output as `<measure>_delta`.
+func NewTrecEvaluationFormatter(options ...func(*EvaluationOptions)) EvaluationFormatter {
+	o := newEvaluationOptions(options...)
+	return func(results map[string]map[string]float64) (string, error) {
+		b := bytes.NewBufferString("")
+		measures := evaluationMeasures(results)
+		topics := evaluationTopics(results)
+		line := func(measure, topic string, v float64) {
+			b.WriteString(fmt.Sprintf("%-22s\t%s\t%s\n", measure, topic, formatValue(v, o.Precision)))
+		}
+		for _, measure := range measures {
+			for _, topic := range topics {
+				if v, ok := results[topic][measure]; ok {
+					line(measure, topic, v)
+				}
+				if o.Baseline != nil {
+					if d, ok := delta(results, o.Baseline, topic, measure); ok {
+						line(measure+"_delta", topic, d)
+					}
+				}
+			}
+		}
+		if !o.OmitMean {
+			for _, measure := range measures {
+				s := summarise(results, measure, o.Confidence)
+				line(measure, "all", s.Mean)
+				if o.Confidence > 0 {
+					line(measure+"_ci_low", "all", s.Low)
+					line(measure+"_ci_high", "all", s.High)
+				}
+				if o.Baseline != nil {
+					line(measure+"_delta", "all", meanDelta(results, o.Baseline, measure))
+				}
+			}
+		}
+		return b.String(), nil
+	}
+}
+
+// separatedEvaluationFormatter outputs a row for each topic, and a row for the mean (`all`) using the separator.
+func separatedEvaluationFormatter(separator rune, o EvaluationOptions) EvaluationFormatter {
+	return func(results map[string]map[string]float64) (string, error) {
+		b := bytes.NewBufferString("")
+		w := csv.NewWriter(b)
+		w.Comma = separator
+
+		measures := evaluationMeasures(results)
+		header := []string{"Topic"}
+		for _, measure := range measures {
+			header = append(header, measure)
+			if o.Baseline != nil {
+				header = append(header, measure+"_delta")
+			}
+		}
+		if err := w.Write(header); err != nil {
+			return "", err
+		}
+
+		for _, topic := range evaluationTopics(results) {
+			record := []string{topic}
+			for _, measure := range measures {
+				v, ok := results[topic][measure]
+				if !ok {
+					v = math.NaN()
+				}
+				record = append(record, formatValue(v, o.Precision))
+				if o.Baseline != nil {
+					d, ok := delta(results, o.Baseline, topic, measure)
+					if !ok {
+						d = math.NaN()
+					}
+					record = append(record, formatValue(d, o.Precision))
+				}
+			}
+			if err := w.Write(record); err != nil {
+				return "", err
+			}
+		}
+
+		if o.OmitMean {
+			w.Flush()
+			return b.String(), w.Error()
+		}
+
+		summaries := make([]evaluationSummary, len(measures))
+		mean := []string{"all"}
+		for i, measure := range measures {
+			summaries[i] = summarise(results, measure, o.Confidence)
+			mean = append(mean, formatValue(summaries[i].Mean, o.Precision))
+			if o.Baseline != nil {
+				mean = append(mean, formatValue(meanDelta(results, o.Baseline, measure), o.Precision))
+			}
+		}
+		if err := w.Write(mean); err != nil {
+			return "", err
+		}
+
+		if o.Confidence > 0 {
+			low, high := []string{"ci_low"}, []string{"ci_high"}
+			for _, s := range summaries {
+				low = append(low, formatValue(s.Low, o.Precision))
+				high = append(high, formatValue(s.High, o.Precision))
+				if o.Baseline != nil {
+					low = append(low, "")
+					high = append(high, "")
+				}
+			}
+			if err := w.Write(low); err != nil {
+				return "", err
+			}
+			if err := w.Write(high); err != nil {
+				return "", err
+			}
+		}
+
+		w.Flush()
+		return b.String(), w.Error()
+	}
+}
+
+// NewCsvEvaluationFormatter creates a formatter that outputs a CSV row for each topic and a final row for the mean.
+func NewCsvEvaluationFormatter(options ...func(*EvaluationOptions)) EvaluationFormatter {
+	return separatedEvaluationFormatter(',', newEvaluationOptions(options...))
+}
+
+// NewTsvEvaluationFormatter creates a formatter that outputs a TSV row for each topic and a final row for the mean.
+func NewTsvEvaluationFormatter(options ...func(*EvaluationOptions)) EvaluationFormatter {
+	return separatedEvaluationFormatter('\t', newEvaluationOptions(options...))
+}
+
+// jsonFloat is a number that can always be encoded as JSON: NaN (e.g. a value that could not be computed) is
+// encoded as null, and infinities as the strings "+Inf" and "-Inf".
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	switch {
+	case math.IsNaN(v):
+		return []byte("null"), nil
+	case math.IsInf(v, 0):
+		return json.Marshal(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return json.Marshal(v)
+}
+
+// jsonFloats converts the values of a map to jsonFloats.
+func jsonFloats(m map[string]float64) map[string]jsonFloat {
+	j := make(map[string]jsonFloat, len(m))
+	for k, v := range m {
+		j[k] = jsonFloat(v)
+	}
+	return j
+}
+
+// evaluationLine is a single line of JSON Lines output.
+type evaluationLine struct {
+	Topic              string                  `json:"topic"`
+	Measures           map[string]jsonFloat    `json:"measures"`
+	Deltas             map[string]jsonFloat    `json:"deltas,omitempty"`
+	ConfidenceInterval map[string][2]jsonFloat `json:"ci,omitempty"`
+}
+
+// NewJsonLinesEvaluationFormatter creates a formatter that outputs one JSON object per line for each topic, followed
+// by a line for the mean (`all`). Since each line is independent, the output can be streamed and concatenated. Values
+// that could not be computed (NaN, e.g. the bounds of a confidence interval over a single topic) are output as null.
+// The delta of the mean is the mean of the per-topic deltas, over the topics evaluated in both the run and baseline.
+func NewJsonLinesEvaluationFormatter(options ...func(*EvaluationOptions)) EvaluationFormatter {
+	o := newEvaluationOptions(options...)
+	return func(results map[string]map[string]float64) (string, error) {
+		b := bytes.NewBufferString("")
+		enc := json.NewEncoder(b)
+		measures := evaluationMeasures(results)
+		for _, topic := range evaluationTopics(results) {
+			l := evaluationLine{Topic: topic, Measures: jsonFloats(results[topic])}
+			if o.Baseline != nil {
+				l.Deltas = make(map[string]jsonFloat)
+				for _, measure := range measures {
+					if d, ok := delta(results, o.Baseline, topic, measure); ok {
+						l.Deltas[measure] = jsonFloat(d)
+					}
+				}
+			}
+			if err := enc.Encode(l); err != nil {
+				return "", err
+			}
+		}
+
+		if o.OmitMean {
+			return b.String(), nil
+		}
+
+		all := evaluationLine{Topic: "all", Measures: make(map[string]jsonFloat)}
+		if o.Confidence > 0 {
+			all.ConfidenceInterval = make(map[string][2]jsonFloat)
+		}
+		if o.Baseline != nil {
+			all.Deltas = make(map[string]jsonFloat)
+		}
+		for _, measure := range measures {
+			s := summarise(results, measure, o.Confidence)
+			if s.N == 0 {
+				continue
+			}
+			all.Measures[measure] = jsonFloat(s.Mean)
+			if o.Confidence > 0 {
+				all.ConfidenceInterval[measure] = [2]jsonFloat{jsonFloat(s.Low), jsonFloat(s.High)}
+			}
+			if o.Baseline != nil {
+				if d := meanDelta(results, o.Baseline, measure); !math.IsNaN(d) {
+					all.Deltas[measure] = jsonFloat(d)
+				}
+			}
+		}
+		if err := enc.Encode(all); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+}
+
+// tableStyle describes how a table is to be typeset.
+type tableStyle struct {
+	begin     func(columns int) string
+	end       string
+	row       func(cells []string) string
+	rule      func(columns int) string
+	bold      func(s string) string
+	plusMinus string
+	escape    func(s string) string
+}
+
+var (
+	latexTable = tableStyle{
+		begin: func(columns int) string {
+			return fmt.Sprintf("\\begin{tabular}{l%s}\n\\toprule\n", strings.Repeat("r", columns-1))
+		},
+		end: "\\bottomrule\n\\end{tabular}\n",
+		row: func(cells []string) string {
+			return strings.Join(cells, " & ") + " \\\\\n"
+		},
+		rule: func(columns int) string {
+			return "\\midrule\n"
+		},
+		bold: func(s string) string {
+			return fmt.Sprintf("\\textbf{%s}", s)
+		},
+		plusMinus: " $\\pm$ ",
+		escape: strings.NewReplacer(
+			`\`, `\textbackslash{}`, `&`, `\&`, `%`, `\%`, `$`, `\$`,
+			`#`, `\#`, `_`, `\_`, `{`, `\{`, `}`, `\}`).Replace,
+	}
+	markdownTable = tableStyle{
+		begin: func(columns int) string {
+			return ""
+		},
+		end: "",
+		row: func(cells []string) string {
+			return "| " + strings.Join(cells, " | ") + " |\n"
+		},
+		rule: func(columns int) string {
+			cells := make([]string, columns)
+			cells[0] = "---"
+			for i := 1; i < columns; i++ {
+				cells[i] = "---:"
+			}
+			return "| " + strings.Join(cells, " | ") + " |\n"
+		},
+		bold: func(s string) string {
+			return fmt.Sprintf("**%s**", s)
+		},
+		plusMinus: " ± ",
+		escape:    strings.NewReplacer(`|`, `\|`, `*`, `\*`, `_`, `\_`).Replace,
+	}
+)
+
+// evaluationTable typesets a table that has a row for each run and a column for the mean of each measure. The best
+// value in each column (the highest, or the lowest for measures where lower is better) is bolded. When configured, each run is followed by a row for each topic.
+func evaluationTable(runs []RunEvaluation, style tableStyle, o EvaluationOptions) string {
+	var all []map[string]map[string]float64
+	for _, run := range runs {
+		all = append(all, run.Evaluation)
+	}
+	measures := evaluationMeasures(all...)
+
+	// Compute the summaries and the best value of each measure.
+	summaries := make([][]evaluationSummary, len(runs))
+	best := make([]float64, len(measures))
+	for j := range measures {
+		best[j] = math.NaN()
+	}
+	for i, run := range runs {
+		summaries[i] = make([]evaluationSummary, len(measures))
+		for j, measure := range measures {
+			summaries[i][j] = summarise(run.Evaluation, measure, o.Confidence)
+			mean := summaries[i][j].Mean
+			if math.IsNaN(mean) {
+				continue
+			}
+			if math.IsNaN(best[j]) || (o.LowerIsBetter(measure) && mean < best[j]) || (!o.LowerIsBetter(measure) && mean > best[j]) {
+				best[j] = mean
+			}
+		}
+	}
+
+	b := bytes.NewBufferString(style.begin(len(measures) + 1))
+	header := []string{"Run"}
+	for _, measure := range measures {
+		header = append(header, style.escape(measure))
+	}
+	b.WriteString(style.row(header))
+	b.WriteString(style.rule(len(header)))
+
+	for i, run := range runs {
+		row := []string{style.escape(run.Name)}
+		for j, s := range summaries[i] {
+			if o.OmitMean {
+				row = append(row, "")
+				continue
+			}
+			cell := formatValue(s.Mean, o.Precision)
+			if !math.IsNaN(s.High) {
+				cell += style.plusMinus + formatValue(s.High-s.Mean, o.Precision)
+			}
+			if len(runs) > 1 && s.Mean == best[j] {
+				cell = style.bold(cell)
+			}
+			row = append(row, cell)
+		}
+		b.WriteString(style.row(row))
+
+		if o.PerTopic || o.OmitMean {
+			for _, topic := range evaluationTopics(run.Evaluation) {
+				row := []string{style.escape(topic)}
+				for _, measure := range measures {
+					v, ok := run.Evaluation[topic][measure]
+					if !ok {
+						v = math.NaN()
+					}
+					cell := formatValue(v, o.Precision)
+					if o.Baseline != nil && i == 0 {
+						if d, ok := delta(run.Evaluation, o.Baseline, topic, measure); ok {
+							cell += fmt.Sprintf(" (%+.*f)", o.Precision, d)
+						}
+					}
+					row = append(row, cell)
+				}
+				b.WriteString(style.row(row))
+			}
+			if i < len(runs)-1 {
+				b.WriteString(style.rule(len(header)))
+			}
+		}
+	}
+	b.WriteString(style.end)
+	return b.String()
+}
+
+// runsWithBaseline creates the runs that are typeset for a single run, optionally compared to a baseline.
+func runsWithBaseline(results map[string]map[string]float64, o EvaluationOptions) []RunEvaluation {
+	runs := []RunEvaluation{{Name: o.RunName, Evaluation: results}}
+	if o.Baseline != nil {
+		runs = append(runs, RunEvaluation{Name: o.BaselineName, Evaluation: o.Baseline})
+	}
+	return runs
+}
+
+// NewLatexEvaluationFormatter creates a formatter that typesets the mean of each measure as a LaTeX (booktabs)
+// table. When a baseline is specified, it is included as a second row and the best value of each measure is bolded.
+func NewLatexEvaluationFormatter(options ...func(*EvaluationOptions)) EvaluationFormatter {
+	o := newEvaluationOptions(options...)
+	return func(results map[string]map[string]float64) (string, error) {
+		return evaluationTable(runsWithBaseline(results, o), latexTable, o), nil
+	}
+}
+
+// NewMarkdownEvaluationFormatter creates a formatter that typesets the mean of each measure as a Markdown table.
+// When a baseline is specified, it is included as a second row and the best value of each measure is bolded.
+func NewMarkdownEvaluationFormatter(options ...func(*EvaluationOptions)) EvaluationFormatter {
+	o := newEvaluationOptions(options...)
+	return func(results map[string]map[string]float64) (string, error) {
+		return evaluationTable(runsWithBaseline(results, o), markdownTable, o), nil
+	}
+}
+
+// LatexEvaluationTable typesets a LaTeX table comparing several runs, bolding the best value of each measure.
+func LatexEvaluationTable(runs []RunEvaluation, options ...func(*EvaluationOptions)) string {
+	return evaluationTable(runs, latexTable, newEvaluationOptions(options...))
+}
+
+// MarkdownEvaluationTable typesets a Markdown table comparing several runs, bolding the best value of each measure.
+func MarkdownEvaluationTable(runs []RunEvaluation, options ...func(*EvaluationOptions)) string {
+	return evaluationTable(runs, markdownTable, newEvaluationOptions(options...))
+}
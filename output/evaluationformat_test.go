@@ -0,0 +1,103 @@
+package output_test
+
+import (
+	"github.com/hscells/groove/output"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestJsonLinesEvaluationFormatter(t *testing.T) {
+	results := map[string]map[string]float64{
+		"1": {"AP": 0.5, "NNR": math.NaN()},
+	}
+	s, err := output.NewJsonLinesEvaluationFormatter(output.EvaluationConfidenceInterval(0.95))(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line for the topic and for the mean, got %q", s)
+	}
+	if !strings.Contains(lines[0], `"NNR":null`) {
+		t.Errorf("expected NaN to be null, got %s", lines[0])
+	}
+	// The interval of a single topic cannot be computed.
+	if !strings.Contains(lines[1], `"AP":0.5`) || !strings.Contains(lines[1], `"ci":{"AP":[null,null]`) {
+		t.Errorf("expected the mean of AP without an interval, got %s", lines[1])
+	}
+}
+
+func TestEvaluationFormatterDelta(t *testing.T) {
+	results := map[string]map[string]float64{
+		"1": {"AP": 0.5},
+		"2": {"AP": 0.3},
+	}
+	// The baseline is not evaluated on topic 2, so the delta of the mean is only over topic 1.
+	baseline := map[string]map[string]float64{
+		"1": {"AP": 0.25},
+		"3": {"AP": 0.9},
+	}
+	s, err := output.NewJsonLinesEvaluationFormatter(output.EvaluationBaseline("baseline", baseline))(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if !strings.Contains(lines[2], `"deltas":{"AP":0.25}`) {
+		t.Errorf("expected the delta of the mean over the paired topics, got %s", lines[2])
+	}
+
+	s, err = output.NewTrecEvaluationFormatter(output.EvaluationBaseline("baseline", baseline), output.EvaluationPrecision(2))(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(s, "AP_delta              \tall\t0.25\n") {
+		t.Errorf("expected the delta of the mean over the paired topics, got %q", s)
+	}
+}
+
+func TestEvaluationTableBest(t *testing.T) {
+	runs := []output.RunEvaluation{
+		{Name: "a", Evaluation: map[string]map[string]float64{"1": {"AP": 0.5, "WSS_loss": 0.2, "AP_smare": 0.1}}},
+		{Name: "b", Evaluation: map[string]map[string]float64{"1": {"AP": 0.3, "WSS_loss": 0.4, "AP_smare": 0.3}}},
+	}
+	s := output.MarkdownEvaluationTable(runs, output.EvaluationPrecision(1))
+	for _, expected := range []string{
+		`| Run | AP | AP\_smare | WSS\_loss |`,
+		`| a | **0.5** | **0.1** | **0.2** |`,
+		`| b | 0.3 | 0.3 | 0.4 |`,
+	} {
+		if !strings.Contains(s, expected) {
+			t.Errorf("expected %q in %q", expected, s)
+		}
+	}
+
+	s = output.MarkdownEvaluationTable(runs, output.EvaluationPrecision(1), output.EvaluationLowerIsBetter("AP"))
+	if !strings.Contains(s, `| b | **0.3** |`) {
+		t.Errorf("expected the lowest AP to be bolded, got %q", s)
+	}
+}
+
+func TestEvaluationFormatterOmitMean(t *testing.T) {
+	results := map[string]map[string]float64{
+		"A": {"AP_pearson": 0.5},
+		"B": {"AP_pearson": 0.3},
+	}
+	for _, f := range []output.EvaluationFormatter{
+		output.NewTrecEvaluationFormatter(output.EvaluationOmitMean(true)),
+		output.NewCsvEvaluationFormatter(output.EvaluationOmitMean(true)),
+		output.NewJsonLinesEvaluationFormatter(output.EvaluationOmitMean(true)),
+		output.NewMarkdownEvaluationFormatter(output.EvaluationOmitMean(true)),
+	} {
+		s, err := f(results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(s, "all") || strings.Contains(s, "0.4") {
+			t.Errorf("expected no mean, got %q", s)
+		}
+		if !strings.Contains(s, "0.5") || !strings.Contains(s, "0.3") {
+			t.Errorf("expected the value of each row, got %q", s)
+		}
+	}
+}
@@ -5,20 +5,44 @@ import (
 	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"math"
 	"strconv"
 )
 
 // MeasurementFormatter is used in the a groove pipeline to output measurements in various formats. These methods should not be
 // used directly since there are some assumptions made about the inputs; for instance, the length of each argument.
+//
+// Measurements that could not be computed are NaN (see analysis.MissingValuePolicy), and are output as missing values
+// so that they can be distinguished from measurements that were computed.
 type MeasurementFormatter func(topics, headers []string, data [][]float64) (string, error)
 
-// JsonMeasurementFormatter outputs results in a JSON format.
+// MeasurementOptions are the optional components of a measurement formatter.
+type MeasurementOptions struct {
+	// Missing is how missing values are output in delimited formats (by default, an empty field).
+	Missing string
+}
+
+// MeasurementMissingValue sets how missing values are output in delimited formats (e.g. NA).
+func MeasurementMissingValue(missing string) func(*MeasurementOptions) {
+	return func(o *MeasurementOptions) {
+		o.Missing = missing
+	}
+}
+
+// missing determines if a measurement is a missing value. Infinities are values that were computed (e.g. the IDF of a
+// term that does not occur in the collection), so they are not missing.
+func missing(v float64) bool {
+	return math.IsNaN(v)
+}
+
+// JsonMeasurementFormatter outputs results in a JSON format. Missing values are output as null, and infinities as the
+// strings "+Inf" and "-Inf".
 func JsonMeasurementFormatter(topics, headers []string, data [][]float64) (string, error) {
-	m := map[string]map[string]float64{}
+	m := map[string]map[string]jsonFloat{}
 	for j, topic := range topics {
-		m[topic] = map[string]float64{}
+		m[topic] = map[string]jsonFloat{}
 		for i, header := range headers {
-			m[topic][header] = data[i][j]
+			m[topic][header] = jsonFloat(data[i][j])
 		}
 	}
 
@@ -29,21 +53,38 @@ func JsonMeasurementFormatter(topics, headers []string, data [][]float64) (strin
 	return string(v), nil
 }
 
-// CsvMeasurementFormatter outputs results in CSV format.
-func CsvMeasurementFormatter(topics, headers []string, data [][]float64) (string, error) {
-	b := bytes.NewBufferString("")
-	w := csv.NewWriter(b)
-	h := []string{"Topic"}
-	h = append(h, headers...)
-	w.Write(h)
-	for j := range data[0] {
-		record := make([]string, len(data)+1)
-		record[0] = topics[j]
-		for i := range data {
-			record[i+1] = strconv.FormatFloat(data[i][j], 'f', -1, 64)
+// NewCsvMeasurementFormatter creates a formatter that outputs results in CSV format.
+func NewCsvMeasurementFormatter(options ...func(*MeasurementOptions)) MeasurementFormatter {
+	var o MeasurementOptions
+	for _, option := range options {
+		option(&o)
+	}
+	return func(topics, headers []string, data [][]float64) (string, error) {
+		b := bytes.NewBufferString("")
+		w := csv.NewWriter(b)
+		h := []string{"Topic"}
+		h = append(h, headers...)
+		if err := w.Write(h); err != nil {
+			return "", err
 		}
-		w.Write(record)
+		for j := range data[0] {
+			record := make([]string, len(data)+1)
+			record[0] = topics[j]
+			for i := range data {
+				if missing(data[i][j]) {
+					record[i+1] = o.Missing
+				} else {
+					record[i+1] = strconv.FormatFloat(data[i][j], 'f', -1, 64)
+				}
+			}
+			if err := w.Write(record); err != nil {
+				return "", err
+			}
+		}
+		w.Flush()
+		return b.String(), w.Error()
 	}
-	w.Flush()
-	return b.String(), nil
 }
+
+// CsvMeasurementFormatter outputs results in CSV format. Missing values are output as empty fields.
+var CsvMeasurementFormatter = NewCsvMeasurementFormatter()
@@ -0,0 +1,63 @@
+package output_test
+
+import (
+	"github.com/hscells/groove/output"
+	"github.com/hscells/groove/pipeline"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMeasurementFormatterMissingValues(t *testing.T) {
+	topics := []string{"1", "2"}
+	headers := []string{"ClarityScore", "MaxIDF"}
+	data := [][]float64{{0.5, math.NaN()}, {math.Inf(1), 1}}
+
+	s, err := output.JsonMeasurementFormatter(topics, headers, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(s, `"ClarityScore": null`) || !strings.Contains(s, `"ClarityScore": 0.5`) {
+		t.Errorf("expected the missing value to be null, got %s", s)
+	}
+	// Infinities are not missing.
+	if !strings.Contains(s, `"MaxIDF": "+Inf"`) {
+		t.Errorf("expected the infinity to be output, got %s", s)
+	}
+
+	s, err = output.NewCsvMeasurementFormatter(output.MeasurementMissingValue("NA"))(topics, headers, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Topic,ClarityScore,MaxIDF\n1,0.5,+Inf\n2,NA,1\n"; s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}
+
+func TestCsvStructuredMeasurementFormatter(t *testing.T) {
+	var r pipeline.MeasurementResult
+	r.SetValue("max", 2)
+	r.SetVector("idf", []float64{1, 2})
+	r.SetMap("idf", "cancer", 1)
+	r.Annotate("/0", "idf", 1)
+
+	s, err := output.CsvStructuredMeasurementFormatter([]string{"1", "2"}, []string{"IDFProfile"}, [][]pipeline.MeasurementResult{{r, {}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Topic,Measurement,Component,Name,Key,Value
+1,IDFProfile,value,max,,2
+1,IDFProfile,vector,idf,0,1
+1,IDFProfile,vector,idf,1,2
+1,IDFProfile,map,idf,cancer,1
+1,IDFProfile,annotation,idf,/0,1
+2,IDFProfile,,,,
+`
+	if s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+
+	if _, err := output.JsonStructuredMeasurementFormatter([]string{"1"}, []string{"IDFProfile"}, [][]pipeline.MeasurementResult{{r}}); err != nil {
+		t.Fatal(err)
+	}
+}
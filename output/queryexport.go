@@ -0,0 +1,353 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/transmute"
+	"github.com/hscells/transmute/backend"
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/lexer"
+	"github.com/hscells/transmute/parser"
+	tpipeline "github.com/hscells/transmute/pipeline"
+	"sort"
+	"strings"
+)
+
+// Loss describes a construct in a query that cannot be represented exactly in the syntax of a search engine.
+type Loss struct {
+	// Construct is the clause or keyword that was lossy.
+	Construct string
+	// Reason describes how the construct was approximated.
+	Reason string
+}
+
+func (l Loss) String() string {
+	return fmt.Sprintf("%s: %s", l.Construct, l.Reason)
+}
+
+// QueryExporter exports queries into the syntax of a search engine. Any constructs that could not be represented
+// exactly in the syntax are reported as losses alongside the exported query.
+type QueryExporter interface {
+	Export(query cqr.CommonQueryRepresentation) (string, []Loss, error)
+	// Name is the name of the syntax, which is also used as the extension of exported files.
+	Name() string
+}
+
+// PubMedExporter exports queries as PubMed queries.
+type PubMedExporter struct{}
+
+// MedlineExporter exports queries as Ovid MEDLINE queries.
+type MedlineExporter struct{}
+
+// ElasticsearchExporter exports queries as Elasticsearch query DSL (JSON).
+type ElasticsearchExporter struct{}
+
+// CQRExporter exports queries as CQR (JSON). The CQR is the representation used internally, so it is never lossy.
+type CQRExporter struct{}
+
+// SolrExporter exports queries in the Solr (Lucene) standard query syntax. Fields is a mapping of fields in the
+// query to fields in the Solr index, and keywords with fields that are not mapped are searched in DefaultField.
+type SolrExporter struct {
+	Fields       map[string][]string
+	DefaultField string
+}
+
+// DefaultSolrFields is a default mapping of fields to a Solr index of PubMed.
+var DefaultSolrFields = map[string][]string{
+	fields.Title:                {"title"},
+	fields.Abstract:             {"abstract"},
+	fields.TitleAbstract:        {"title", "abstract"},
+	fields.TextWord:             {"title", "abstract"},
+	fields.MeshHeadings:         {"mesh_headings"},
+	fields.MeSHTerms:            {"mesh_headings"},
+	fields.MeSHMajorTopic:       {"mesh_headings"},
+	fields.FloatingMeshHeadings: {"mesh_headings"},
+	fields.PublicationType:      {"publication_types"},
+}
+
+// NewSolrExporter creates a new Solr exporter with the default field mapping.
+func NewSolrExporter() SolrExporter {
+	return SolrExporter{Fields: DefaultSolrFields, DefaultField: "text"}
+}
+
+// NewQueryExporter creates a query exporter by name. The names are pubmed, medline, elasticsearch, solr, and cqr.
+func NewQueryExporter(name string) (QueryExporter, error) {
+	switch strings.ToLower(name) {
+	case "pubmed":
+		return PubMedExporter{}, nil
+	case "medline":
+		return MedlineExporter{}, nil
+	case "elasticsearch":
+		return ElasticsearchExporter{}, nil
+	case "solr":
+		return NewSolrExporter(), nil
+	case "cqr":
+		return CQRExporter{}, nil
+	}
+	return nil, fmt.Errorf("unknown query export format %s", name)
+}
+
+// walk calls fn on every clause and keyword in a query.
+func walk(query cqr.CommonQueryRepresentation, fn func(cqr.CommonQueryRepresentation)) {
+	fn(query)
+	if q, ok := query.(cqr.BooleanQuery); ok {
+		for _, child := range q.Children {
+			walk(child, fn)
+		}
+	}
+}
+
+func isAdjacency(q cqr.BooleanQuery) bool {
+	return strings.HasPrefix(strings.ToLower(q.Operator), "adj")
+}
+
+func isExploded(k cqr.Keyword) bool {
+	exp, ok := k.Options[cqr.ExplodedString].(bool)
+	return ok && exp
+}
+
+func hasField(k cqr.Keyword, field string) bool {
+	for _, f := range k.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// pubmedTruncationLoss describes how the wildcards in a keyword cannot be searched by PubMed, which only supports
+// truncation (*) at the end of a word of at least four characters. The reason is empty when there is no loss.
+func pubmedTruncationLoss(k cqr.Keyword) string {
+	for _, word := range strings.Fields(strings.Trim(k.QueryString, `"`)) {
+		i := strings.IndexAny(word, "*?$")
+		switch {
+		case i < 0:
+			continue
+		case i != len(word)-1 || word[i] != '*':
+			return "wildcards within or at the start of words, and single character wildcards, are not supported by PubMed"
+		case i < 4:
+			return "truncation of words shorter than four characters is not supported by PubMed"
+		}
+	}
+	return ""
+}
+
+func (PubMedExporter) Export(query cqr.CommonQueryRepresentation) (string, []Loss, error) {
+	var losses []Loss
+	walk(query, func(c cqr.CommonQueryRepresentation) {
+		switch q := c.(type) {
+		case cqr.BooleanQuery:
+			if isAdjacency(q) {
+				losses = append(losses, Loss{Construct: q.String(), Reason: "adjacency is not supported by PubMed and is searched as and"})
+			}
+		case cqr.Keyword:
+			if reason := pubmedTruncationLoss(q); len(reason) > 0 {
+				losses = append(losses, Loss{Construct: q.String(), Reason: reason})
+			}
+		}
+	})
+	s, err := transmute.CompileCqr2PubMed(query)
+	return s, losses, err
+}
+
+func (PubMedExporter) Name() string {
+	return "pubmed"
+}
+
+func (MedlineExporter) Export(query cqr.CommonQueryRepresentation) (string, []Loss, error) {
+	var losses []Loss
+	walk(query, func(c cqr.CommonQueryRepresentation) {
+		if k, ok := c.(cqr.Keyword); ok && hasField(k, fields.PublicationDate) {
+			losses = append(losses, Loss{Construct: k.String(), Reason: "publication date restrictions are not supported by Ovid MEDLINE queries"})
+		}
+	})
+	s, err := transmute.CompileCqr2Medline(query)
+	return s, losses, err
+}
+
+func (MedlineExporter) Name() string {
+	return "medline"
+}
+
+func (ElasticsearchExporter) Export(query cqr.CommonQueryRepresentation) (string, []Loss, error) {
+	var losses []Loss
+	walk(query, func(c cqr.CommonQueryRepresentation) {
+		if k, ok := c.(cqr.Keyword); ok && isExploded(k) {
+			losses = append(losses, Loss{Construct: k.String(), Reason: "exploded headings are searched without their narrower headings"})
+		}
+	})
+
+	repr, err := backend.NewCQRQuery(query).StringPretty()
+	if err != nil {
+		return "", nil, err
+	}
+	p := tpipeline.NewPipeline(
+		parser.NewCQRParser(),
+		backend.NewElasticsearchCompiler(),
+		tpipeline.TransmutePipelineOptions{
+			LexOptions: lexer.LexOptions{
+				FormatParenthesis: true,
+			},
+			RequiresLexing: false,
+		})
+	esQuery, err := p.Execute(repr)
+	if err != nil {
+		return "", nil, err
+	}
+	s, err := esQuery.String()
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Indent the query so it is readable when written to a file.
+	var b bytes.Buffer
+	err = json.Indent(&b, []byte(s), "", "    ")
+	if err != nil {
+		return "", nil, err
+	}
+	return b.String(), losses, nil
+}
+
+func (ElasticsearchExporter) Name() string {
+	return "elasticsearch"
+}
+
+func (CQRExporter) Export(query cqr.CommonQueryRepresentation) (string, []Loss, error) {
+	s, err := backend.NewCQRQuery(query).StringPretty()
+	return s, nil, err
+}
+
+func (CQRExporter) Name() string {
+	return "cqr"
+}
+
+// solrEscaper escapes the special characters of the Lucene query syntax. Wildcards (* and ?) are not escaped.
+var solrEscaper = strings.NewReplacer(
+	`\`, `\\`, `+`, `\+`, `-`, `\-`, `&`, `\&`, `|`, `\|`, `!`, `\!`, `(`, `\(`, `)`, `\)`,
+	`{`, `\{`, `}`, `\}`, `[`, `\[`, `]`, `\]`, `^`, `\^`, `~`, `\~`, `:`, `\:`, `/`, `\/`,
+)
+
+// mapFields maps the fields of a keyword to fields in the Solr index.
+func (e SolrExporter) mapFields(k cqr.Keyword, losses *[]Loss) []string {
+	seen := make(map[string]bool)
+	var f []string
+	for _, field := range k.Fields {
+		mapped, ok := e.Fields[field]
+		if !ok {
+			*losses = append(*losses, Loss{Construct: k.String(), Reason: fmt.Sprintf("field %s is not mapped and is searched in %s", field, e.DefaultField)})
+			mapped = []string{e.DefaultField}
+		}
+		for _, m := range mapped {
+			if !seen[m] {
+				seen[m] = true
+				f = append(f, m)
+			}
+		}
+	}
+	if len(f) == 0 {
+		f = []string{e.DefaultField}
+	}
+	sort.Strings(f)
+	return f
+}
+
+// solrTerm formats the query string of a keyword as a Lucene term or phrase.
+func solrTerm(k cqr.Keyword) string {
+	s := strings.Trim(k.QueryString, `"`)
+	if strings.ContainsAny(s, " \t") {
+		return fmt.Sprintf(`"%s"`, strings.Replace(s, `"`, `\"`, -1))
+	}
+	return solrEscaper.Replace(s)
+}
+
+// disjunction searches the same term in several fields.
+func disjunction(f []string, term string) string {
+	clauses := make([]string, len(f))
+	for i, field := range f {
+		clauses[i] = fmt.Sprintf("%s:%s", field, term)
+	}
+	if len(clauses) == 1 {
+		return clauses[0]
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")"
+}
+
+func (e SolrExporter) compile(query cqr.CommonQueryRepresentation, losses *[]Loss) string {
+	switch q := query.(type) {
+	case cqr.Keyword:
+		if isExploded(q) {
+			*losses = append(*losses, Loss{Construct: q.String(), Reason: "exploded headings are searched without their narrower headings"})
+		}
+		return disjunction(e.mapFields(q, losses), solrTerm(q))
+	case cqr.BooleanQuery:
+		if isAdjacency(q) {
+			// Adjacency can only be represented as a proximity phrase when all of the children are single
+			// terms in the same fields; anything else is searched as and.
+			if s, ok := e.proximity(q, losses); ok {
+				return s
+			}
+			*losses = append(*losses, Loss{Construct: q.String(), Reason: "adjacency over clauses or different fields is searched as and"})
+			q.Operator = cqr.AND
+		}
+		var clauses []string
+		for _, child := range q.Children {
+			clauses = append(clauses, e.compile(child, losses))
+		}
+		if len(clauses) == 0 {
+			return ""
+		}
+		if len(clauses) == 1 {
+			return clauses[0]
+		}
+		switch {
+		case strings.EqualFold(q.Operator, cqr.AND):
+			return "(" + strings.Join(clauses, " AND ") + ")"
+		case strings.EqualFold(q.Operator, cqr.NOT):
+			return "(" + clauses[0] + " AND NOT " + strings.Join(clauses[1:], " AND NOT ") + ")"
+		default:
+			return "(" + strings.Join(clauses, " OR ") + ")"
+		}
+	}
+	return ""
+}
+
+// proximity formats an adjacency clause as a Lucene proximity phrase (e.g. title:"breast cancer"~3).
+func (e SolrExporter) proximity(q cqr.BooleanQuery, losses *[]Loss) (string, bool) {
+	var (
+		terms []string
+		f     []string
+	)
+	for i, child := range q.Children {
+		k, ok := child.(cqr.Keyword)
+		if !ok || strings.ContainsAny(k.QueryString, "*?") {
+			return "", false
+		}
+		kf := e.mapFields(k, losses)
+		if i == 0 {
+			f = kf
+		} else if strings.Join(f, ",") != strings.Join(kf, ",") {
+			return "", false
+		}
+		terms = append(terms, strings.Trim(k.QueryString, `"`))
+	}
+	distance := strings.TrimPrefix(strings.ToLower(q.Operator), "adj")
+	if len(distance) == 0 {
+		distance = "1"
+	}
+	return disjunction(f, fmt.Sprintf(`"%s"~%s`, strings.Join(terms, " "), distance)), true
+}
+
+func (e SolrExporter) Export(query cqr.CommonQueryRepresentation) (string, []Loss, error) {
+	var losses []Loss
+	s := e.compile(query, &losses)
+	if len(s) == 0 {
+		return "", nil, fmt.Errorf("query is empty")
+	}
+	return s, losses, nil
+}
+
+func (SolrExporter) Name() string {
+	return "solr"
+}
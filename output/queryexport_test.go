@@ -0,0 +1,68 @@
+package output_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/output"
+	"github.com/hscells/transmute/fields"
+	"testing"
+)
+
+func TestSolrExporter(t *testing.T) {
+	q := cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("Neoplasms", fields.MeshHeadings).SetOption(cqr.ExplodedString, true),
+		cqr.NewBooleanQuery("adj3", []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("breast", fields.TitleAbstract),
+			cqr.NewKeyword("cancer", fields.TitleAbstract),
+		}),
+		cqr.NewBooleanQuery(cqr.NOT, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("tumo?r*", fields.Title),
+			cqr.NewKeyword("rat-model", fields.PublicationDate),
+		}),
+	})
+
+	s, losses, err := output.NewSolrExporter().Export(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `(mesh_headings:Neoplasms OR (abstract:"breast cancer"~3 OR title:"breast cancer"~3) OR (title:tumo?r* AND NOT text:rat\-model))`
+	if s != expected {
+		t.Errorf("expected %s, got %s", expected, s)
+	}
+
+	// The exploded heading and the unmapped field are lossy.
+	if len(losses) != 2 {
+		t.Errorf("expected 2 losses, got %v", losses)
+	}
+}
+
+func TestQueryExporterLosses(t *testing.T) {
+	q := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewBooleanQuery("adj2", []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("breast", fields.TitleAbstract),
+			cqr.NewKeyword("cancer", fields.TitleAbstract),
+		}),
+		cqr.NewKeyword("tumo?r", fields.TitleAbstract),
+		cqr.NewKeyword("rat*", fields.Title),
+		cqr.NewKeyword("neoplas*", fields.Title),
+		cqr.NewKeyword("2000/01:2010/12", fields.PublicationDate),
+	})
+
+	for _, test := range []struct {
+		exporter output.QueryExporter
+		losses   int
+	}{
+		// Adjacency, the single character wildcard, and the short truncation.
+		{output.PubMedExporter{}, 3},
+		// The publication date restriction.
+		{output.MedlineExporter{}, 1},
+	} {
+		_, losses, err := test.exporter.Export(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(losses) != test.losses {
+			t.Errorf("expected %d losses exporting to %s, got %v", test.losses, test.exporter.Name(), losses)
+		}
+	}
+}
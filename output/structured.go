@@ -0,0 +1,163 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/hscells/groove/pipeline"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// StructuredMeasurementFormatter is used in a groove pipeline to output structured measurements (see
+// analysis.StructuredMeasurement), where data contains the result of each measurement (the headers) for each topic.
+// Measurements that could not be computed have empty results, and are output as missing values.
+type StructuredMeasurementFormatter func(topics, headers []string, data [][]pipeline.MeasurementResult) (string, error)
+
+// jsonMeasurementResult is a structured measurement result that can be encoded as JSON (see jsonFloat).
+type jsonMeasurementResult struct {
+	Values      map[string]jsonFloat            `json:"values,omitempty"`
+	Vectors     map[string][]jsonFloat          `json:"vectors,omitempty"`
+	Maps        map[string]map[string]jsonFloat `json:"maps,omitempty"`
+	Annotations map[string]map[string]jsonFloat `json:"annotations,omitempty"`
+}
+
+func newJsonMeasurementResult(r pipeline.MeasurementResult) *jsonMeasurementResult {
+	if r.Empty() {
+		return nil
+	}
+	j := &jsonMeasurementResult{Values: jsonFloats(r.Values)}
+	if len(r.Vectors) > 0 {
+		j.Vectors = make(map[string][]jsonFloat, len(r.Vectors))
+		for name, vector := range r.Vectors {
+			j.Vectors[name] = make([]jsonFloat, len(vector))
+			for i, v := range vector {
+				j.Vectors[name][i] = jsonFloat(v)
+			}
+		}
+	}
+	if len(r.Maps) > 0 {
+		j.Maps = make(map[string]map[string]jsonFloat, len(r.Maps))
+		for name, m := range r.Maps {
+			j.Maps[name] = jsonFloats(m)
+		}
+	}
+	if len(r.Annotations) > 0 {
+		j.Annotations = make(map[string]map[string]jsonFloat, len(r.Annotations))
+		for path, m := range r.Annotations {
+			j.Annotations[path] = jsonFloats(m)
+		}
+	}
+	return j
+}
+
+// JsonStructuredMeasurementFormatter outputs results in a JSON format, keyed by topic and measurement. Missing results
+// and values are output as null, and infinities as the strings "+Inf" and "-Inf".
+func JsonStructuredMeasurementFormatter(topics, headers []string, data [][]pipeline.MeasurementResult) (string, error) {
+	m := map[string]map[string]*jsonMeasurementResult{}
+	for j, topic := range topics {
+		m[topic] = map[string]*jsonMeasurementResult{}
+		for i, header := range headers {
+			m[topic][header] = newJsonMeasurementResult(data[i][j])
+		}
+	}
+
+	v, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NewCsvStructuredMeasurementFormatter creates a formatter that outputs results in a long CSV format, with a row for
+// each value of each result: the topic, the measurement, the component of the result the value is in (value,
+// vector, map, or annotation), the name of the component, the key of the value in the component (the index of a
+// vector, the key of a map, or the path of an annotated node), and the value. Missing results are output as a single
+// row with a missing value.
+func NewCsvStructuredMeasurementFormatter(options ...func(*MeasurementOptions)) StructuredMeasurementFormatter {
+	var o MeasurementOptions
+	for _, option := range options {
+		option(&o)
+	}
+	return func(topics, headers []string, data [][]pipeline.MeasurementResult) (string, error) {
+		b := bytes.NewBufferString("")
+		w := csv.NewWriter(b)
+		if err := w.Write([]string{"Topic", "Measurement", "Component", "Name", "Key", "Value"}); err != nil {
+			return "", err
+		}
+
+		var err error
+		write := func(topic, measurement, component, name, key string, v float64) {
+			if err != nil {
+				return
+			}
+			value := o.Missing
+			if !missing(v) {
+				value = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+			err = w.Write([]string{topic, measurement, component, name, key, value})
+		}
+
+		for j, topic := range topics {
+			for i, header := range headers {
+				r := data[i][j]
+				if r.Empty() {
+					write(topic, header, "", "", "", math.NaN())
+					continue
+				}
+				for _, name := range sortedKeys(r.Values) {
+					write(topic, header, "value", name, "", r.Values[name])
+				}
+				vectors := make([]string, 0, len(r.Vectors))
+				for name := range r.Vectors {
+					vectors = append(vectors, name)
+				}
+				sort.Strings(vectors)
+				for _, name := range vectors {
+					for k, v := range r.Vectors[name] {
+						write(topic, header, "vector", name, strconv.Itoa(k), v)
+					}
+				}
+				maps := make([]string, 0, len(r.Maps))
+				for name := range r.Maps {
+					maps = append(maps, name)
+				}
+				sort.Strings(maps)
+				for _, name := range maps {
+					for _, key := range sortedKeys(r.Maps[name]) {
+						write(topic, header, "map", name, key, r.Maps[name][key])
+					}
+				}
+				paths := make([]string, 0, len(r.Annotations))
+				for path := range r.Annotations {
+					paths = append(paths, path)
+				}
+				sort.Strings(paths)
+				for _, path := range paths {
+					for _, name := range sortedKeys(r.Annotations[path]) {
+						write(topic, header, "annotation", name, path, r.Annotations[path][name])
+					}
+				}
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		w.Flush()
+		return b.String(), w.Error()
+	}
+}
+
+// CsvStructuredMeasurementFormatter outputs results in a long CSV format (see NewCsvStructuredMeasurementFormatter).
+// Missing values are output as empty fields.
+var CsvStructuredMeasurementFormatter = NewCsvStructuredMeasurementFormatter()
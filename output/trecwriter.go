@@ -0,0 +1,433 @@
+package output
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/trecresults"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrTopicWritten indicates that the results for a topic have already been written by a run writer.
+	ErrTopicWritten = errors.New("results for topic have already been written")
+)
+
+// TrecWriter streams results to a TREC run file as each topic is completed. Before the results of a topic are
+// written, they are validated and normalised: document ids must be unique, the run tag must be consistent across
+// all topics, and results are sorted by descending score (ties are broken the same way trec_eval breaks them) and
+// renumbered from rank one.
+//
+// A TrecWriter may be used concurrently.
+type TrecWriter struct {
+	Path     string
+	RunName  string
+	Append   bool
+	Gzip     bool
+	PerTopic bool
+
+	retag     bool
+	completed map[string]bool
+	manifest  map[string]ManifestTopic
+	w         io.Writer
+	f         *os.File
+	gz        *gzip.Writer
+	mu        sync.Mutex
+}
+
+// RunManifest describes a run: its run tag, and the publication date restriction the results of each topic were
+// retrieved with.
+type RunManifest struct {
+	RunName string          `json:"run_name"`
+	Topics  []ManifestTopic `json:"topics"`
+}
+
+// ManifestTopic describes how the results of a topic were retrieved. The dates are empty when the topic has no date
+// restriction.
+type ManifestTopic struct {
+	Topic     string `json:"topic"`
+	DateStart string `json:"date_start,omitempty"`
+	DateEnd   string `json:"date_end,omitempty"`
+}
+
+// TrecRunName replaces the run tag of every result written. When not set, the run tag of the first result written
+// is used, and every subsequent result must have the same run tag.
+func TrecRunName(name string) func(*TrecWriter) {
+	return func(w *TrecWriter) {
+		w.RunName = name
+		w.retag = true
+	}
+}
+
+// TrecAppend appends results to an existing run, for instance when resuming a run that did not complete. Topics that
+// have already been written to the run are recorded so that they can be skipped.
+func TrecAppend(resume bool) func(*TrecWriter) {
+	return func(w *TrecWriter) {
+		w.Append = resume
+	}
+}
+
+// TrecGzip compresses the results written with gzip. Paths that end in `.gz` are always compressed.
+func TrecGzip(compress bool) func(*TrecWriter) {
+	return func(w *TrecWriter) {
+		w.Gzip = compress
+	}
+}
+
+// TrecPerTopic writes the results for each topic to its own file. The path of the writer is then a directory and each
+// file is named after the topic.
+func TrecPerTopic(perTopic bool) func(*TrecWriter) {
+	return func(w *TrecWriter) {
+		w.PerTopic = perTopic
+	}
+}
+
+// NewTrecWriter creates a new run writer that writes to the specified path.
+func NewTrecWriter(p string, options ...func(*TrecWriter)) (*TrecWriter, error) {
+	w := &TrecWriter{
+		Path:      p,
+		completed: make(map[string]bool),
+		manifest:  make(map[string]ManifestTopic),
+	}
+	for _, option := range options {
+		option(w)
+	}
+	if strings.HasSuffix(p, ".gz") {
+		w.Gzip = true
+	}
+	if w.Append {
+		err := w.readManifest()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if w.PerTopic {
+		err := os.MkdirAll(p, 0777)
+		if err != nil {
+			return nil, err
+		}
+		if w.Append {
+			files, err := ioutil.ReadDir(p)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				if f.IsDir() {
+					continue
+				}
+				w.completed[strings.TrimSuffix(f.Name(), ".gz")] = true
+			}
+		}
+		return w, nil
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if w.Append {
+		if _, err := os.Stat(p); err == nil {
+			err := w.readCompleted(p)
+			if err != nil {
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(p, flags, 0664)
+	if err != nil {
+		return nil, err
+	}
+	w.f = f
+	w.w = f
+	if w.Gzip {
+		// Appending to a gzip file adds a new member to the stream, which is read transparently.
+		w.gz = gzip.NewWriter(f)
+		w.w = w.gz
+	}
+	return w, nil
+}
+
+// readCompleted reads the topics and run tag of an existing run so that it may be resumed.
+func (w *TrecWriter) readCompleted(p string) error {
+	f, err := os.OpenFile(p, os.O_RDONLY, 0664)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if w.Gzip {
+		gz, err := gzip.NewReader(f)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	results, err := trecresults.ResultsFromReader(r)
+	if err != nil {
+		return err
+	}
+	for topic, list := range results.Results {
+		w.completed[topic] = true
+		if len(w.RunName) == 0 && len(list) > 0 {
+			w.RunName = list[0].RunName
+		}
+	}
+	return nil
+}
+
+// ManifestPath is the path the manifest of the run is written to, next to the run.
+func (w *TrecWriter) ManifestPath() string {
+	return strings.TrimSuffix(w.Path, "/") + ".manifest.json"
+}
+
+// readManifest reads the manifest of an existing run so that it may be resumed.
+func (w *TrecWriter) readManifest() error {
+	b, err := ioutil.ReadFile(w.ManifestPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var m RunManifest
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return fmt.Errorf("%s: %v", w.ManifestPath(), err)
+	}
+	for _, t := range m.Topics {
+		w.manifest[t.Topic] = t
+	}
+	return nil
+}
+
+// Describe records the date restriction of the query that the results of a topic are retrieved with. The manifest of
+// the run is written to ManifestPath when the run is closed, if any topic has been described.
+func (w *TrecWriter) Describe(q pipeline.Query) error {
+	d, err := q.DateRestriction()
+	if err != nil {
+		return err
+	}
+	t := ManifestTopic{Topic: q.Topic}
+	if d != nil {
+		t.DateStart = d.Start.Format("2006-01-02")
+		t.DateEnd = d.End.Format("2006-01-02")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.manifest[q.Topic] = t
+	return nil
+}
+
+// writeManifest writes the manifest of the run, with the topics in order.
+func (w *TrecWriter) writeManifest() error {
+	m := RunManifest{RunName: w.RunName, Topics: make([]ManifestTopic, 0, len(w.manifest))}
+	for _, t := range w.manifest {
+		m.Topics = append(m.Topics, t)
+	}
+	sort.Slice(m.Topics, func(i, j int) bool {
+		return m.Topics[i].Topic < m.Topics[j].Topic
+	})
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(w.ManifestPath(), b, 0664)
+}
+
+// Completed reports if the results for a topic have already been written.
+func (w *TrecWriter) Completed(topic string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.completed[topic]
+}
+
+// Validate checks that the results for a single topic can be written to a TREC run, and returns a normalised copy
+// of the results. Topics, document ids and run tags must not be empty or contain whitespace. The results are sorted by descending score, ties are broken by descending document id (as in
+// trec_eval), and the results are renumbered from rank one. Every result must have the same run tag as runName; if
+// runName is empty, the run tag of the first result is used instead. Results without a run tag are given runName.
+func Validate(list trecresults.ResultList, runName string) (trecresults.ResultList, error) {
+	if len(list) == 0 {
+		return trecresults.ResultList{}, nil
+	}
+
+	topic := list[0].Topic
+	if len(topic) == 0 || strings.ContainsAny(topic, " \t\n") {
+		return nil, fmt.Errorf("invalid topic %q", topic)
+	}
+	if len(runName) == 0 {
+		runName = list[0].RunName
+	}
+	if len(runName) == 0 {
+		return nil, fmt.Errorf("topic %s: results have no run tag", topic)
+	}
+	if strings.ContainsAny(runName, " \t\n") {
+		return nil, fmt.Errorf("topic %s: run tag %q contains whitespace", topic, runName)
+	}
+
+	seen := make(map[string]bool, len(list))
+	normalised := make(trecresults.ResultList, len(list))
+	for i, result := range list {
+		if result.Topic != topic {
+			return nil, fmt.Errorf("topic %s: result for document %s has topic %s", topic, result.DocId, result.Topic)
+		}
+		if len(result.DocId) == 0 || strings.ContainsAny(result.DocId, " \t\n") {
+			return nil, fmt.Errorf("topic %s: invalid document id %q", topic, result.DocId)
+		}
+		if seen[result.DocId] {
+			return nil, fmt.Errorf("topic %s: document %s is retrieved more than once", topic, result.DocId)
+		}
+		seen[result.DocId] = true
+		if len(result.RunName) > 0 && result.RunName != runName {
+			return nil, fmt.Errorf("topic %s: run tag %s is inconsistent with run tag %s", topic, result.RunName, runName)
+		}
+
+		r := *result
+		r.RunName = runName
+		if len(r.Iteration) == 0 {
+			r.Iteration = "Q0"
+		}
+		normalised[i] = &r
+	}
+
+	sort.SliceStable(normalised, func(i, j int) bool {
+		if normalised[i].Score != normalised[j].Score {
+			return normalised[i].Score > normalised[j].Score
+		}
+		return normalised[i].DocId > normalised[j].DocId
+	})
+	for i := range normalised {
+		normalised[i].Rank = int64(i + 1)
+	}
+	return normalised, nil
+}
+
+// formatResults formats results in the six column TREC format. Scores are written with as many digits as are needed
+// to represent them exactly, so that scores which differ only in small amounts do not become ties (which trec_eval
+// breaks by document identifier, rather than by the order that was validated).
+func formatResults(list trecresults.ResultList) string {
+	var b strings.Builder
+	for _, r := range list {
+		b.WriteString(fmt.Sprintf("%s %s %s %d %s %s\n", r.Topic, r.Iteration, r.DocId, r.Rank, strconv.FormatFloat(r.Score, 'g', -1, 64), r.RunName))
+	}
+	return b.String()
+}
+
+// Write validates and writes the results for a single topic. A topic may only be written once per run.
+func (w *TrecWriter) Write(list trecresults.ResultList) error {
+	if len(list) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	topic := list[0].Topic
+	if w.completed[topic] {
+		return ErrTopicWritten
+	}
+
+	if w.retag {
+		retagged := make(trecresults.ResultList, len(list))
+		for i, result := range list {
+			r := *result
+			r.RunName = w.RunName
+			retagged[i] = &r
+		}
+		list = retagged
+	}
+
+	normalised, err := Validate(list, w.RunName)
+	if err != nil {
+		return err
+	}
+	// The first topic written determines the run tag when one has not been specified.
+	if len(w.RunName) == 0 {
+		w.RunName = normalised[0].RunName
+	}
+
+	if w.PerTopic {
+		err = w.writeTopic(topic, normalised)
+	} else {
+		_, err = io.WriteString(w.w, formatResults(normalised))
+		if err == nil && w.gz != nil {
+			err = w.gz.Flush()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	w.completed[topic] = true
+	return nil
+}
+
+// writeTopic writes the results for a topic to its own file. Topics that are not valid file names (e.g. that contain
+// a path separator) are rejected, so that results are never written outside the directory of the run.
+func (w *TrecWriter) writeTopic(topic string, list trecresults.ResultList) error {
+	if topic == "." || topic == ".." || strings.ContainsAny(topic, "/\\") {
+		return fmt.Errorf("topic %q cannot be written to its own file", topic)
+	}
+	name := path.Join(w.Path, topic)
+	if w.Gzip {
+		name += ".gz"
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if w.Gzip {
+		gz := gzip.NewWriter(f)
+		_, err = io.WriteString(gz, formatResults(list))
+		if err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+	_, err = io.WriteString(f, formatResults(list))
+	return err
+}
+
+// Close flushes any buffered results, closes the run, and writes the manifest of the run.
+func (w *TrecWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.manifest) > 0 {
+		err := w.writeManifest()
+		if err != nil {
+			return err
+		}
+	}
+	if w.gz != nil {
+		err := w.gz.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if w.f != nil {
+		return w.f.Close()
+	}
+	return nil
+}
+
+// Writer creates a run writer for the path of the trec results output.
+func (t TrecResults) Writer(options ...func(*TrecWriter)) (*TrecWriter, error) {
+	return NewTrecWriter(t.Path, options...)
+}
@@ -0,0 +1,210 @@
+package output_test
+
+import (
+	"encoding/json"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/output"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/trecresults"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	list := trecresults.ResultList{
+		&trecresults.Result{Topic: "1", DocId: "10", Score: 1, RunName: "run"},
+		&trecresults.Result{Topic: "1", DocId: "12", Score: 1, RunName: "run"},
+		&trecresults.Result{Topic: "1", DocId: "11", Score: 2, RunName: "run"},
+	}
+
+	v, err := output.Validate(list, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"11", "12", "10"}
+	for i, r := range v {
+		if r.DocId != expected[i] {
+			t.Errorf("expected document %s at rank %d, got %s", expected[i], i+1, r.DocId)
+		}
+		if r.Rank != int64(i+1) {
+			t.Errorf("expected rank %d, got %d", i+1, r.Rank)
+		}
+	}
+
+	_, err = output.Validate(append(list, &trecresults.Result{Topic: "1", DocId: "10", RunName: "run"}), "")
+	if err == nil {
+		t.Error("expected an error for a duplicate document")
+	}
+
+	_, err = output.Validate(list, "other")
+	if err == nil {
+		t.Error("expected an error for an inconsistent run tag")
+	}
+
+	for _, r := range []*trecresults.Result{
+		{Topic: "1 2", DocId: "10", RunName: "run"},
+		{Topic: "", DocId: "10", RunName: "run"},
+		{Topic: "1", DocId: "10 11", RunName: "run"},
+		{Topic: "1", DocId: "", RunName: "run"},
+	} {
+		if _, err := output.Validate(trecresults.ResultList{r}, ""); err == nil {
+			t.Errorf("expected an error for topic %q and document %q", r.Topic, r.DocId)
+		}
+	}
+}
+
+func TestTrecWriterPerTopic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trecwriter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := path.Join(dir, "run")
+	w, err := output.NewTrecWriter(p, output.TrecPerTopic(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"../x", "a/b", ".."} {
+		err = w.Write(trecresults.ResultList{&trecresults.Result{Topic: topic, DocId: "1", RunName: "run"}})
+		if err == nil {
+			t.Errorf("expected an error for topic %q", topic)
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "x")); !os.IsNotExist(err) {
+		t.Error("expected no results to be written outside the run")
+	}
+	err = w.Write(trecresults.ResultList{&trecresults.Result{Topic: "1", DocId: "1", RunName: "run"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(p, "1")); err != nil {
+		t.Errorf("expected the results of topic 1 to be written to its own file, got %v", err)
+	}
+}
+
+func TestTrecWriterAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trecwriter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := path.Join(dir, "run.res.gz")
+
+	w, err := output.NewTrecWriter(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Write(trecresults.ResultList{&trecresults.Result{Topic: "1", DocId: "1", RunName: "run"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = output.NewTrecWriter(p, output.TrecAppend(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Completed("1") {
+		t.Fatal("expected topic 1 to be completed")
+	}
+	err = w.Write(trecresults.ResultList{&trecresults.Result{Topic: "1", DocId: "1", RunName: "run"}})
+	if err != output.ErrTopicWritten {
+		t.Fatalf("expected topic to already be written, got %v", err)
+	}
+	err = w.Write(trecresults.ResultList{&trecresults.Result{Topic: "2", DocId: "1", RunName: "run"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrecWriterScores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trecwriter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := path.Join(dir, "run.res")
+	w, err := output.NewTrecWriter(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Write(trecresults.ResultList{
+		&trecresults.Result{Topic: "1", DocId: "1", Score: 0.10000002, RunName: "run"},
+		&trecresults.Result{Topic: "1", DocId: "2", Score: 0.10000001, RunName: "run"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "1 Q0 1 1 0.10000002 run\n1 Q0 2 2 0.10000001 run\n"; string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, string(b))
+	}
+}
+
+func TestTrecWriterManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trecwriter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := pipeline.ParseDateRestriction("1990", "2000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := path.Join(dir, "run.res")
+	w, err := output.NewTrecWriter(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := pipeline.NewQuery("1", "1", cqr.NewKeyword("cancer", "ti"))
+	for _, query := range []pipeline.Query{q.SetDateRestriction(d), pipeline.NewQuery("2", "2", q.Query)} {
+		if err := w.Describe(query); err != nil {
+			t.Fatal(err)
+		}
+		err = w.Write(trecresults.ResultList{&trecresults.Result{Topic: query.Topic, DocId: "1", RunName: "run"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(w.ManifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m output.RunManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	expected := []output.ManifestTopic{{Topic: "1", DateStart: "1990-01-01", DateEnd: "2000-12-31"}, {Topic: "2"}}
+	if m.RunName != "run" || !reflect.DeepEqual(m.Topics, expected) {
+		t.Errorf("expected the date restrictions of the topics in the manifest, got %+v", m)
+	}
+}
@@ -3,8 +3,10 @@ package groove
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/hscells/cqr"
 	"github.com/hscells/groove/analysis"
 	"github.com/hscells/groove/combinator"
 	"github.com/hscells/groove/eval"
@@ -25,27 +27,34 @@ import (
 	"path"
 	"runtime"
 	"sort"
+	"strings"
+	"unicode"
 )
 
 // Pipeline contains all the information for executing a pipeline for query analysis.
 type Pipeline struct {
-	QueryPath             string
-	PubDatesFile          string
-	QueriesSource         query.QueriesSource
-	StatisticsSource      stats.StatisticsSource
-	Preprocess            []preprocess.QueryProcessor
-	Transformations       preprocess.QueryTransformations
-	Measurements          []analysis.Measurement
-	MeasurementFormatters []output.MeasurementFormatter
-	MeasurementExecutor   analysis.MeasurementExecutor
-	Evaluations           []eval.Evaluator
-	EvaluationFormatters  EvaluationOutputFormat
-	OutputTrec            output.TrecResults
-	QueryCache            combinator.QueryCacher
-	Model                 learning.Model
-	ModelConfiguration    ModelConfiguration
-	QueryFormulator       formulation.Formulator
-	Headway               *headway.Client
+	QueryPath                       string
+	PubDatesFile                    string
+	QueriesSource                   query.QueriesSource
+	StatisticsSource                stats.StatisticsSource
+	Preprocess                      []preprocess.QueryProcessor
+	Transformations                 preprocess.QueryTransformations
+	Measurements                    []analysis.Measurement
+	MeasurementFormatters           []output.MeasurementFormatter
+	StructuredMeasurements          []analysis.StructuredMeasurement
+	StructuredMeasurementFormatters []output.StructuredMeasurementFormatter
+	MeasurementExecutor             analysis.MeasurementExecutor
+	MeasurementWorkers              int
+	MeasurementOptions              []func(*analysis.MeasurementExecutor)
+	Evaluations                     []eval.Evaluator
+	EvaluationFormatters            EvaluationOutputFormat
+	OutputTrec                      output.TrecResults
+	QueryCache                      combinator.QueryCacher
+	Model                           learning.Model
+	ModelConfiguration              ModelConfiguration
+	QueryFormulator                 formulation.Formulator
+	QueryExport                     QueryExportFormat
+	Headway                         *headway.Client
 
 	CLF rank.CLFOptions
 }
@@ -58,9 +67,109 @@ type ModelConfiguration struct {
 }
 
 // EvaluationOutputFormat specifies out evaluation output should be formatted.
+// When stages of assessment are specified, results are evaluated against the qrels of each stage
+// instead of EvaluationQrels.
 type EvaluationOutputFormat struct {
 	EvaluationFormatters []output.EvaluationFormatter
 	EvaluationQrels      trecresults.QrelsFile
+	Stages               []eval.Stage
+}
+
+// Evaluate scores the results of a topic using either the qrels or each of the stages of assessment.
+func (e EvaluationOutputFormat) Evaluate(evaluators []eval.Evaluator, results *trecresults.ResultList, topic string) map[string]float64 {
+	if len(e.Stages) > 0 {
+		return eval.EvaluateStages(evaluators, results, e.Stages, topic)
+	}
+	return eval.Evaluate(evaluators, results, e.EvaluationQrels, topic)
+}
+
+// QueryExportFormat specifies how transformed and formulated queries are exported. When Path is set,
+// each exported query is also written to a file in that directory.
+type QueryExportFormat struct {
+	Path     string
+	Exporter output.QueryExporter
+}
+
+// export exports a query, writing it to a file when a path is specified. Any losses are logged.
+func (e QueryExportFormat) export(name string, q cqr.CommonQueryRepresentation) (string, []string, error) {
+	s, losses, err := e.Exporter.Export(q)
+	if err != nil {
+		return "", nil, err
+	}
+	l := make([]string, len(losses))
+	for i, loss := range losses {
+		l[i] = loss.String()
+		log.Printf("%s (%s): %s\n", name, e.Exporter.Name(), l[i])
+	}
+	if len(e.Path) > 0 {
+		err = ioutil.WriteFile(path.Join(e.Path, name+"."+e.Exporter.Name()), []byte(s), 0644)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return s, l, nil
+}
+
+// exportName is the name a query is exported as: the topic, followed by the name of the query when it differs from
+// the topic (e.g. CD008122_original), so that the queries of a topic do not overwrite each other's files.
+func exportName(q pipeline.Query) string {
+	name := q.Topic
+	if len(q.Name) > 0 && q.Name != q.Topic {
+		name += "_" + q.Name
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// QueryResult creates the result of a transformation, exporting the query when an exporter is specified.
+func (e QueryExportFormat) QueryResult(q pipeline.Query) (pipeline.QueryResult, error) {
+	r := pipeline.NewQueryResult(q)
+	if e.Exporter == nil {
+		return r, nil
+	}
+	var err error
+	r.Exported, r.Losses, err = e.export(exportName(q), q.Query)
+	return r, err
+}
+
+// FormulationResult creates the result of a formulation, exporting the queries when an exporter is specified.
+func (e QueryExportFormat) FormulationResult(q pipeline.Query, method string, queries []cqr.CommonQueryRepresentation, sup []pipeline.SupplementalData) (pipeline.FormulationResut, error) {
+	r := pipeline.FormulationResut{
+		Queries:  queries,
+		Sup:      sup,
+		Metadata: q.Metadata,
+	}
+	if e.Exporter == nil {
+		return r, nil
+	}
+	r.Exported = make([]string, len(queries))
+	for i, formulated := range queries {
+		name := fmt.Sprintf("%s.%s.%d", exportName(q), method, i)
+		s, losses, err := e.export(name, formulated)
+		if err != nil {
+			return r, err
+		}
+		r.Exported[i] = s
+		for _, loss := range losses {
+			r.Losses = append(r.Losses, fmt.Sprintf("%d: %s", i, loss))
+		}
+	}
+	return r, nil
+}
+
+// QueryExportOutput exports transformed and formulated queries using an exporter (see output.NewQueryExporter).
+// When path is not empty, each exported query is written to a file in that directory.
+func QueryExportOutput(path string, exporter output.QueryExporter) func() interface{} {
+	return func() interface{} {
+		return QueryExportFormat{
+			Path:     path,
+			Exporter: exporter,
+		}
+	}
 }
 
 // Preprocess adds preprocessors to the pipeline.
@@ -91,6 +200,20 @@ func MeasurementOutput(formatter ...output.MeasurementFormatter) func() interfac
 	}
 }
 
+// MeasurementExecutorOptions configures the executor of measurements (e.g. analysis.MeasurementMissingValues).
+func MeasurementExecutorOptions(options ...func(*analysis.MeasurementExecutor)) func() interface{} {
+	return func() interface{} {
+		return options
+	}
+}
+
+// StructuredMeasurementOutput adds outputs of structured measurements to the pipeline.
+func StructuredMeasurementOutput(formatter ...output.StructuredMeasurementFormatter) func() interface{} {
+	return func() interface{} {
+		return formatter
+	}
+}
+
 // TrecOutput configures trec output.
 func TrecOutput(path string) func() interface{} {
 	return func() interface{} {
@@ -118,9 +241,21 @@ func EvaluationOutput(qrels string, formatters ...output.EvaluationFormatter) fu
 	}
 }
 
+// StagedEvaluationOutput configures evaluation output for multiple stages of assessment (e.g. abstract and
+// content level qrels). Each stage is loaded from its own qrels file and has its own relevance threshold.
+func StagedEvaluationOutput(stages []eval.Stage, formatters ...output.EvaluationFormatter) func() interface{} {
+	return func() interface{} {
+		return EvaluationOutputFormat{
+			Stages:               stages,
+			EvaluationFormatters: formatters,
+		}
+	}
+}
+
 // NewGroovePipeline creates a new groove pipeline. The query source and statistics source are required. Additional
-// components are provided via the optional functional arguments.
-func NewGroovePipeline(qs query.QueriesSource, ss stats.StatisticsSource, components ...func() interface{}) Pipeline {
+// components are provided via the optional functional arguments. An error is returned if the pipeline is not valid
+// (see Validate).
+func NewGroovePipeline(qs query.QueriesSource, ss stats.StatisticsSource, components ...func() interface{}) (Pipeline, error) {
 	gp := Pipeline{
 		QueriesSource:    qs,
 		StatisticsSource: ss,
@@ -135,20 +270,50 @@ func NewGroovePipeline(qs query.QueriesSource, ss stats.StatisticsSource, compon
 			gp.Measurements = v
 		case []output.MeasurementFormatter:
 			gp.MeasurementFormatters = v
+		case []func(*analysis.MeasurementExecutor):
+			gp.MeasurementOptions = v
+		case []analysis.StructuredMeasurement:
+			gp.StructuredMeasurements = v
+		case []output.StructuredMeasurementFormatter:
+			gp.StructuredMeasurementFormatters = v
 		case preprocess.QueryTransformations:
 			gp.Transformations = v
+		case EvaluationOutputFormat:
+			gp.EvaluationFormatters = v
+		case QueryExportFormat:
+			gp.QueryExport = v
 		}
 	}
 
-	return gp
+	return gp, gp.Validate()
+}
+
+// Validate checks that the components of the pipeline can be used together, e.g. that each transformation can be
+// applied with the statistics source of the pipeline.
+func (p Pipeline) Validate() error {
+	return p.Transformations.Validate(p.StatisticsSource)
 }
 
 // Execute runs a groove pipeline for a particular directory of queries.
-//noinspection GoNilness
 func (p Pipeline) Execute(c chan pipeline.Result) {
+	p.ExecuteContext(context.Background(), c)
+}
+
+// ExecuteContext runs a groove pipeline for a particular directory of queries. Transformations stop when the
+// context is cancelled. The pipeline is validated (see Validate) before any queries are loaded.
+//noinspection GoNilness
+func (p Pipeline) ExecuteContext(ctx context.Context, c chan pipeline.Result) {
 	defer close(c)
 	log.Println("starting groove pipeline...")
 
+	if err := p.Validate(); err != nil {
+		c <- pipeline.Result{
+			Error: err,
+			Type:  pipeline.Error,
+		}
+		return
+	}
+
 	p.CLF.Headway = p.Headway
 
 	// TODO this method needs some serious refactoring done to it.
@@ -174,13 +339,21 @@ func (p Pipeline) Execute(c chan pipeline.Result) {
 		p.QueryCache = combinator.NewFileQueryCache(path.Join(cacheDir, "groove", "file_cache"))
 	}
 
-	p.MeasurementExecutor = analysis.NewDiskMeasurementExecutor(statisticsCache)
+	options := append([]func(*analysis.MeasurementExecutor){analysis.MeasurementWorkers(p.MeasurementWorkers)}, p.MeasurementOptions...)
+	p.MeasurementExecutor = analysis.NewDiskMeasurementExecutor(statisticsCache, options...)
 
 	// Only perform this section if there are some queries.
 	if len(p.QueryPath) > 0 {
 		log.Println("loading queries...")
 		// Load and process the queries.
 		queries, err := p.QueriesSource.Load(p.QueryPath)
+		// Topics that could not be loaded are skipped, so that one bad topic does not prevent the others from running.
+		if errs, ok := err.(query.TopicErrors); ok && len(queries) > 0 {
+			for _, e := range errs {
+				log.Printf("skipping %v\n", e)
+			}
+			err = nil
+		}
 		if err != nil {
 			c <- pipeline.Result{
 				Error: err,
@@ -189,6 +362,21 @@ func (p Pipeline) Execute(c chan pipeline.Result) {
 			return
 		}
 
+		// Restrict the publication dates of queries; the statistics source applies the restriction when the
+		// queries are executed.
+		if len(p.PubDatesFile) > 0 {
+			log.Println("adding date restrictions to queries...")
+			restrictions, err := preprocess.LoadDateRestrictions(p.PubDatesFile)
+			if err != nil {
+				c <- pipeline.Result{
+					Error: err,
+					Type:  pipeline.Error,
+				}
+				return
+			}
+			queries = restrictions.Apply(queries)
+		}
+
 		// Here we need to configure how the queries are loaded into each learning model.
 		if p.Model != nil {
 			switch m := p.Model.(type) {
@@ -199,15 +387,6 @@ func (p Pipeline) Execute(c chan pipeline.Result) {
 			}
 		}
 
-		//if len(p.PubDatesFile) > 0 {
-		//	log.Println("adding date restrictions to queries...")
-		//	for i, cq := range queries {
-		//		log.Println(cq.Topic)
-		//		q := preprocess.DateRestrictions(p.PubDatesFile)(cq.Query, cq.Topic)()
-		//		queries[i].Query = q
-		//	}
-		//}
-
 		log.Println("sorting queries by complexity...")
 
 		// Sort the transformed queries by size.
@@ -222,6 +401,7 @@ func (p Pipeline) Execute(c chan pipeline.Result) {
 
 		// This means preprocessing the query.
 		measurementQueries := make([]pipeline.Query, len(queries))
+		transformations := make([]pipeline.QueryResult, len(queries))
 		topics := make([]string, len(queries))
 		for i, q := range queries {
 			topics[i] = q.Topic
@@ -229,39 +409,48 @@ func (p Pipeline) Execute(c chan pipeline.Result) {
 
 			// And apply the processing if there is any.
 			for _, p := range p.Preprocess {
-				q = pipeline.NewQuery(q.Name, q.Topic, preprocess.ProcessQuery(q.Query, p))
+				q = q.WithQuery(preprocess.ProcessQuery(q.Query, p))
 			}
 
 			// Apply any transformations.
-			for i, t := range p.Transformations.BooleanTransformations {
-				fmt.Println(q.Topic, i)
-				q = pipeline.NewQuery(q.Name, q.Topic, t(q.Query, q.Topic)())
-			}
-			for _, t := range p.Transformations.ElasticsearchTransformations {
-				if s, ok := p.StatisticsSource.(*stats.ElasticsearchStatisticsSource); ok {
-					q = pipeline.NewQuery(q.Name, q.Topic, t(q.Query, s)())
-				} else {
-					log.Fatal("Elasticsearch transformations only work with an Elasticsearch statistics source.")
+			tq, err := p.Transformations.Apply(ctx, q.Query, q.Topic, p.StatisticsSource)
+			if err != nil {
+				c <- pipeline.Result{
+					Topic: q.Topic,
+					Error: err,
+					Type:  pipeline.Error,
 				}
+				return
 			}
+			q = q.WithQuery(tq)
 			measurementQueries[i] = q
+
+			transformations[i], err = p.QueryExport.QueryResult(q)
+			if err != nil {
+				c <- pipeline.Result{
+					Topic: q.Topic,
+					Error: err,
+					Type:  pipeline.Error,
+				}
+				return
+			}
 		}
 
 		// Compute measurements for each of the queries.
-		// The measurements are computed in parallel.
+		// The measurements are computed in parallel (up to the number of measurement workers).
 		// Only perform the measurements if there are some measurement formatters to output them to.
 		if len(p.MeasurementFormatters) > 0 {
-			for _, m := range measurementQueries {
-				data := make(map[string]float64)
-				measurements, err := p.MeasurementExecutor.Execute(m, p.StatisticsSource, p.Measurements...)
-				if err != nil {
-					c <- pipeline.Result{
-						Error: err,
-						Type:  pipeline.Error,
-					}
-					return
+			measurements, err := p.MeasurementExecutor.ExecuteQueries(measurementQueries, p.StatisticsSource, p.Measurements...)
+			if err != nil {
+				c <- pipeline.Result{
+					Error: err,
+					Type:  pipeline.Error,
 				}
-				for i, measurement := range measurements {
+				return
+			}
+			for j, m := range measurementQueries {
+				data := make(map[string]float64)
+				for i, measurement := range measurements[j] {
 					data[p.Measurements[i].Name()] = measurement
 				}
 				c <- pipeline.Result{
@@ -272,6 +461,29 @@ func (p Pipeline) Execute(c chan pipeline.Result) {
 			}
 		}
 
+		// Compute the structured measurements for each of the queries, if there are formatters to output them to.
+		if len(p.StructuredMeasurementFormatters) > 0 {
+			results, err := p.MeasurementExecutor.ExecuteStructuredQueries(measurementQueries, p.StatisticsSource, p.StructuredMeasurements...)
+			if err != nil {
+				c <- pipeline.Result{
+					Error: err,
+					Type:  pipeline.Error,
+				}
+				return
+			}
+			for j, m := range measurementQueries {
+				data := make(map[string]pipeline.MeasurementResult)
+				for i, result := range results[j] {
+					data[p.StructuredMeasurements[i].Name()] = result
+				}
+				c <- pipeline.Result{
+					Topic:                  m.Topic,
+					StructuredMeasurements: data,
+					Type:                   pipeline.Measurement,
+				}
+			}
+		}
+
 		loghw := !(p.Headway == nil)
 		hwName := fmt.Sprintf("groove (%s)", uuid.New().String())
 
@@ -321,22 +533,23 @@ func (p Pipeline) Execute(c chan pipeline.Result) {
 				}
 				// Set the evaluation results.
 				if len(p.Evaluations) > 0 {
-					measurements[q.Topic] = eval.Evaluate(p.Evaluations, &results, p.EvaluationFormatters.EvaluationQrels, q.Topic)
+					measurements[q.Topic] = p.EvaluationFormatters.Evaluate(p.Evaluations, &results, q.Topic)
 				}
 
 				// MeasurementOutput the trec results.
 				if len(p.OutputTrec.Path) > 0 {
 					c <- pipeline.Result{
-						Topic:       q.Topic,
-						TrecResults: &results,
-						Type:        pipeline.TrecResult,
+						Topic:          q.Topic,
+						TrecResults:    &results,
+						Transformation: transformations[i],
+						Type:           pipeline.TrecResult,
 					}
 				}
 
 				// Send the transformation through the channel.
 				c <- pipeline.Result{
 					Topic:          q.Topic,
-					Transformation: pipeline.QueryResult{Name: q.Name, Topic: q.Topic, Transformation: q.Query},
+					Transformation: transformations[i],
 					Type:           pipeline.Transformation,
 				}
 
@@ -429,7 +642,7 @@ func (p Pipeline) Execute(c chan pipeline.Result) {
 					if len(p.Evaluations) > 0 {
 						c <- pipeline.Result{
 							Topic:       query.Topic,
-							Evaluations: eval.Evaluate(p.Evaluations, &trecResults, p.EvaluationFormatters.EvaluationQrels, query.Topic),
+							Evaluations: p.EvaluationFormatters.Evaluate(p.Evaluations, &trecResults, query.Topic),
 							Type:        pipeline.Evaluation,
 						}
 					}
@@ -437,16 +650,17 @@ func (p Pipeline) Execute(c chan pipeline.Result) {
 					// MeasurementOutput the trec results.
 					if len(p.OutputTrec.Path) > 0 {
 						c <- pipeline.Result{
-							Topic:       query.Topic,
-							TrecResults: &trecResults,
-							Type:        pipeline.TrecResult,
+							Topic:          query.Topic,
+							TrecResults:    &trecResults,
+							Transformation: transformations[idx],
+							Type:           pipeline.TrecResult,
 						}
 					}
 
 					// Send the transformation through the channel.
 					c <- pipeline.Result{
 						Topic:          q.Topic,
-						Transformation: pipeline.QueryResult{Name: query.Name, Topic: query.Topic, Transformation: query.Query},
+						Transformation: transformations[idx],
 						Type:           pipeline.Transformation,
 					}
 
@@ -476,13 +690,19 @@ func (p Pipeline) Execute(c chan pipeline.Result) {
 					return
 				}
 
+				fr, err := p.QueryExport.FormulationResult(measurementQuery, p.QueryFormulator.Method(), queries, sup)
+				if err != nil {
+					c <- pipeline.Result{
+						Error: err,
+						Type:  pipeline.Error,
+					}
+					return
+				}
+
 				c <- pipeline.Result{
-					Topic: measurementQuery.Topic,
-					Formulation: pipeline.FormulationResut{
-						Queries: queries,
-						Sup:     sup,
-					},
-					Type: pipeline.Formulation,
+					Topic:       measurementQuery.Topic,
+					Formulation: fr,
+					Type:        pipeline.Formulation,
 				}
 			}
 		}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/transmute/fields"
+	"strings"
+	"time"
+)
+
+// dateFormats are the formats dates in date restrictions may be written in.
+var dateFormats = []string{"20060102", "2006-01-02", "2006/01/02", "2006-01", "2006/01", "2006"}
+
+// DateRestriction restricts a query to documents published between two dates (inclusive).
+type DateRestriction struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ParseDate parses a date in one of the formats YYYYMMDD, YYYY-MM-DD, YYYY/MM/DD, YYYY-MM, YYYY/MM, or YYYY.
+func ParseDate(date string) (time.Time, error) {
+	date = strings.TrimSpace(date)
+	for _, layout := range dateFormats {
+		if len(layout) != len(date) {
+			continue
+		}
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a valid date", date)
+}
+
+// NewDateRestriction creates a date restriction, which is invalid if it ends before it starts.
+func NewDateRestriction(start, end time.Time) (DateRestriction, error) {
+	if start.IsZero() || end.IsZero() {
+		return DateRestriction{}, fmt.Errorf("date restriction must have a start and end date")
+	}
+	if end.Before(start) {
+		return DateRestriction{}, fmt.Errorf("date restriction ends (%s) before it starts (%s)", end.Format(metadataDateFormat), start.Format(metadataDateFormat))
+	}
+	return DateRestriction{Start: start, End: end}, nil
+}
+
+// ParseDateRestriction parses the start and end dates of a date restriction (see ParseDate). An end date without a
+// day or month is the last day of that month or year, so that the restriction includes all of it.
+func ParseDateRestriction(start, end string) (DateRestriction, error) {
+	s, err := ParseDate(start)
+	if err != nil {
+		return DateRestriction{}, err
+	}
+	e, err := ParseDate(end)
+	if err != nil {
+		return DateRestriction{}, err
+	}
+	switch len(strings.TrimSpace(end)) {
+	case len("2006"):
+		e = e.AddDate(1, 0, -1)
+	case len("2006-01"):
+		e = e.AddDate(0, 1, -1)
+	}
+	return NewDateRestriction(s, e)
+}
+
+func (d DateRestriction) String() string {
+	return fmt.Sprintf("%s-%s", d.Start.Format(metadataDateFormat), d.End.Format(metadataDateFormat))
+}
+
+// Keyword is a publication date keyword that retrieves documents published within the date restriction.
+func (d DateRestriction) Keyword() cqr.Keyword {
+	return cqr.NewKeyword(fmt.Sprintf("%s:%s", d.Start.Format("2006/01"), d.End.Format("2006/01")), fields.PublicationDate)
+}
+
+// Restrict restricts a query to documents published within the date restriction.
+func (d DateRestriction) Restrict(query cqr.CommonQueryRepresentation) cqr.CommonQueryRepresentation {
+	return cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		query,
+		d.Keyword(),
+	})
+}
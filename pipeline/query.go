@@ -1,19 +1,125 @@
 package pipeline
 
 import (
+	"fmt"
 	"github.com/hscells/cqr"
 )
 
+const (
+	// TitleMetadata is the title of the topic a query was written for.
+	TitleMetadata = "title"
+	// ObjectiveMetadata is the objective of the systematic review a query was written for.
+	ObjectiveMetadata = "objective"
+	// OriginalQueryMetadata is the query string as it was written, before it was parsed.
+	OriginalQueryMetadata = "original_query"
+	// DateStartMetadata is the earliest publication date (YYYYMMDD) of documents the query should retrieve.
+	DateStartMetadata = "date_start"
+	// DateEndMetadata is the latest publication date (YYYYMMDD) of documents the query should retrieve.
+	DateEndMetadata = "date_end"
+
+	// metadataDateFormat is the format dates are stored in the metadata of a query.
+	metadataDateFormat = "20060102"
+	// protocolMetadataPrefix prefixes the sections of a protocol stored in the metadata of a query.
+	protocolMetadataPrefix = "protocol."
+)
+
 // Query stores information about a query before it is measured, analysed, or executed.
 // In most circumstances, the `transformed` query should be used, as it is the preprocessed,
 // transformed, and rewritten query.
+//
+// Metadata contains additional information about the query (e.g. the title of the topic),
+// which is carried through preprocessing, transformation, and formulation.
 type Query struct {
-	Topic string
-	Name  string
-	Query cqr.CommonQueryRepresentation
+	Topic    string
+	Name     string
+	Query    cqr.CommonQueryRepresentation
+	Metadata map[string]string
 }
 
 // NewQuery creates a new groove pipeline query.
 func NewQuery(name string, topic string, query cqr.CommonQueryRepresentation) Query {
 	return Query{Name: name, Topic: topic, Query: query}
 }
+
+// WithQuery creates a copy of the query with a different cqr query, keeping the name, topic, and metadata.
+// This should be used instead of NewQuery whenever a query is derived from another.
+func (q Query) WithQuery(query cqr.CommonQueryRepresentation) Query {
+	q.Query = query
+	return q
+}
+
+// SetMetadata sets a metadata value for the query. Since queries are passed by value, the
+// metadata is copied first so that the metadata of the original query is not modified.
+func (q Query) SetMetadata(key, value string) Query {
+	m := make(map[string]string, len(q.Metadata)+1)
+	for k, v := range q.Metadata {
+		m[k] = v
+	}
+	m[key] = value
+	q.Metadata = m
+	return q
+}
+
+// GetMetadata retrieves a metadata value for the query.
+func (q Query) GetMetadata(key string) (string, bool) {
+	v, ok := q.Metadata[key]
+	return v, ok
+}
+
+// Title is the title of the topic the query was written for.
+func (q Query) Title() string {
+	return q.Metadata[TitleMetadata]
+}
+
+// Objective is the objective of the systematic review the query was written for.
+func (q Query) Objective() string {
+	return q.Metadata[ObjectiveMetadata]
+}
+
+// OriginalQuery is the query string as it was written, before it was parsed.
+func (q Query) OriginalQuery() string {
+	return q.Metadata[OriginalQueryMetadata]
+}
+
+// ProtocolMetadata is the metadata key for a section of a protocol (e.g. "participants").
+func ProtocolMetadata(section string) string {
+	return protocolMetadataPrefix + section
+}
+
+// Protocol is a section of the protocol of the systematic review the query was written for.
+func (q Query) Protocol(section string) string {
+	return q.Metadata[ProtocolMetadata(section)]
+}
+
+// SetDateRestriction sets the range of publication dates of documents the query should retrieve.
+func (q Query) SetDateRestriction(d DateRestriction) Query {
+	return q.SetMetadata(DateStartMetadata, d.Start.Format(metadataDateFormat)).
+		SetMetadata(DateEndMetadata, d.End.Format(metadataDateFormat))
+}
+
+// DateRestriction is the range of publication dates of documents the query should retrieve, or nil if the
+// query has no date restriction. An error is returned if the date restriction in the metadata is invalid.
+func (q Query) DateRestriction() (*DateRestriction, error) {
+	s, ok1 := q.Metadata[DateStartMetadata]
+	e, ok2 := q.Metadata[DateEndMetadata]
+	if !ok1 && !ok2 {
+		return nil, nil
+	}
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("topic %s has an incomplete date restriction", q.Topic)
+	}
+	d, err := ParseDateRestriction(s, e)
+	if err != nil {
+		return nil, fmt.Errorf("topic %s has an invalid date restriction: %v", q.Topic, err)
+	}
+	return &d, nil
+}
+
+// Restricted is the query with its date restriction (if it has one) applied.
+func (q Query) Restricted() (cqr.CommonQueryRepresentation, error) {
+	d, err := q.DateRestriction()
+	if err != nil || d == nil {
+		return q.Query, err
+	}
+	return d.Restrict(q.Query), nil
+}
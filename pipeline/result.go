@@ -5,11 +5,25 @@ import (
 	"github.com/hscells/trecresults"
 )
 
-// QueryResult is the result of a transformation.
+// QueryResult is the result of a transformation. When queries are exported, Exported contains
+// the exported query and Losses describes any constructs that could not be exported exactly.
 type QueryResult struct {
 	Topic          string
 	Name           string
 	Transformation cqr.CommonQueryRepresentation
+	Metadata       map[string]string
+	Exported       string
+	Losses         []string
+}
+
+// NewQueryResult creates the result of a transformation from a pipeline query.
+func NewQueryResult(q Query) QueryResult {
+	return QueryResult{
+		Topic:          q.Topic,
+		Name:           q.Name,
+		Transformation: q.Query,
+		Metadata:       q.Metadata,
+	}
 }
 
 // Data contains the actual data saved and how to write it to disk.
@@ -29,9 +43,15 @@ type SupplementalData struct {
 	Data []Data
 }
 
+// FormulationResut contains the queries formulated for a topic, and the metadata of the query they were formulated from.
+// When queries are exported, Exported contains each exported query and Losses describes any constructs that could not
+// be exported exactly.
 type FormulationResut struct {
-	Queries []cqr.CommonQueryRepresentation
-	Sup     []SupplementalData
+	Queries  []cqr.CommonQueryRepresentation
+	Sup      []SupplementalData
+	Metadata map[string]string
+	Exported []string
+	Losses   []string
 }
 
 // ResultType is the type of result being returned through a pipeline channel.
@@ -54,23 +74,79 @@ const (
 	Done
 )
 
-// Result is the output of a groove pipeline.
+// MeasurementResult is the result of a structured measurement (see analysis.StructuredMeasurement). A result
+// contains any number of named values, vectors (e.g. distributions or histograms), maps (e.g. a value for each term
+// of a query), and annotations of the nodes of a query (keyed by the path of the node, see analysis.WalkQuery).
+type MeasurementResult struct {
+	Values      map[string]float64            `json:"values,omitempty"`
+	Vectors     map[string][]float64          `json:"vectors,omitempty"`
+	Maps        map[string]map[string]float64 `json:"maps,omitempty"`
+	Annotations map[string]map[string]float64 `json:"annotations,omitempty"`
+}
+
+// SetValue sets a named value of a result.
+func (r *MeasurementResult) SetValue(name string, v float64) {
+	if r.Values == nil {
+		r.Values = make(map[string]float64)
+	}
+	r.Values[name] = v
+}
+
+// SetVector sets a named vector of a result.
+func (r *MeasurementResult) SetVector(name string, v []float64) {
+	if r.Vectors == nil {
+		r.Vectors = make(map[string][]float64)
+	}
+	r.Vectors[name] = v
+}
+
+// SetMap sets a value of a named map of a result.
+func (r *MeasurementResult) SetMap(name, key string, v float64) {
+	if r.Maps == nil {
+		r.Maps = make(map[string]map[string]float64)
+	}
+	if r.Maps[name] == nil {
+		r.Maps[name] = make(map[string]float64)
+	}
+	r.Maps[name][key] = v
+}
+
+// Annotate sets a named value of a node of a query, identified by its path.
+func (r *MeasurementResult) Annotate(path, name string, v float64) {
+	if r.Annotations == nil {
+		r.Annotations = make(map[string]map[string]float64)
+	}
+	if r.Annotations[path] == nil {
+		r.Annotations[path] = make(map[string]float64)
+	}
+	r.Annotations[path][name] = v
+}
+
+// Empty determines if a result contains nothing, e.g. because the measurement could not be computed.
+func (r MeasurementResult) Empty() bool {
+	return len(r.Values) == 0 && len(r.Vectors) == 0 && len(r.Maps) == 0 && len(r.Annotations) == 0
+}
+
+// Result is the output of a groove pipeline. A TrecResult also contains the transformation of the query the results
+// were retrieved with, so that its date restriction may be reported (see output.TrecWriter).
 type Result struct {
-	Topic          string
-	Measurements   map[string]float64
-	Evaluations    map[string]float64
-	Transformation QueryResult
-	Formulation    FormulationResut
-	TrecResults    *trecresults.ResultList
-	Type           ResultType
-	Error          error
+	Topic                  string
+	Measurements           map[string]float64
+	StructuredMeasurements map[string]MeasurementResult
+	Evaluations            map[string]float64
+	Transformation         QueryResult
+	Formulation            FormulationResut
+	TrecResults            *trecresults.ResultList
+	Type                   ResultType
+	Error                  error
 }
 
 // ToGroovePipelineQuery converts a QueryResult into a pipeline query.
 func (qr QueryResult) ToGroovePipelineQuery() Query {
 	return Query{
-		Topic: qr.Topic,
-		Name:  qr.Name,
-		Query: qr.Transformation,
+		Topic:    qr.Topic,
+		Name:     qr.Name,
+		Query:    qr.Transformation,
+		Metadata: qr.Metadata,
 	}
 }
@@ -0,0 +1,214 @@
+// Package analyser provides text analysis for the keywords of queries and for the documents of local indexes:
+// tokenisation, stopword removal, stemming, and spelling normalisation. Analysis targets the free-text fields of
+// queries, and never modifies controlled vocabulary (e.g. MeSH headings or publication types).
+package analyser
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/transmute/fields"
+	"strings"
+)
+
+// ControlledVocabularyFields are fields that contain terms from a controlled vocabulary, which must be searched
+// exactly as written.
+var ControlledVocabularyFields = []string{
+	fields.MeshHeadings,
+	fields.MeSHTerms,
+	fields.MeSHSubheading,
+	fields.MeSHMajorTopic,
+	fields.FloatingMeshHeadings,
+	fields.MajorFocusMeshHeading,
+	fields.PublicationType,
+	fields.PublicationDate,
+}
+
+var controlled = func() map[string]bool {
+	m := make(map[string]bool)
+	for _, field := range ControlledVocabularyFields {
+		m[field] = true
+	}
+	return m
+}()
+
+// IsControlledVocabulary determines if the fields of a keyword are all controlled vocabulary fields.
+func IsControlledVocabulary(f []string) bool {
+	if len(f) == 0 {
+		return false
+	}
+	for _, field := range f {
+		if !controlled[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenFilter transforms the tokens of text, e.g. by removing or stemming tokens.
+type TokenFilter func(tokens []string) []string
+
+// isWildcard determines if a token contains a wildcard, in which case it should not be stemmed or normalised.
+func isWildcard(token string) bool {
+	return strings.ContainsAny(token, "*?")
+}
+
+// Lowercase transforms tokens to lowercase.
+func Lowercase(tokens []string) []string {
+	for i, token := range tokens {
+		tokens[i] = strings.ToLower(token)
+	}
+	return tokens
+}
+
+// RemoveStopwords removes stopwords from tokens.
+func RemoveStopwords(stopwords Stopwords) TokenFilter {
+	return func(tokens []string) []string {
+		kept := tokens[:0]
+		for _, token := range tokens {
+			if !stopwords.Contains(token) {
+				kept = append(kept, token)
+			}
+		}
+		return kept
+	}
+}
+
+// Stem stems tokens. Tokens with wildcards are not stemmed.
+func Stem(stemmer Stemmer) TokenFilter {
+	return func(tokens []string) []string {
+		for i, token := range tokens {
+			if !isWildcard(token) {
+				tokens[i] = stemmer.Stem(token)
+			}
+		}
+		return tokens
+	}
+}
+
+// NormaliseSpelling replaces British spellings of tokens with American spellings. Tokens with wildcards are not
+// normalised.
+func NormaliseSpelling(variants SpellingVariants) TokenFilter {
+	return func(tokens []string) []string {
+		for i, token := range tokens {
+			if !isWildcard(token) {
+				tokens[i] = variants.American(token)
+			}
+		}
+		return tokens
+	}
+}
+
+// Process applies a function to each token (e.g. a preprocess.QueryProcessor). Tokens that become empty are
+// removed.
+func Process(processor func(string) string) TokenFilter {
+	return func(tokens []string) []string {
+		kept := tokens[:0]
+		for _, token := range tokens {
+			if token = processor(token); len(token) > 0 {
+				kept = append(kept, token)
+			}
+		}
+		return kept
+	}
+}
+
+// Analyser is a chain of text analysis: text is split into tokens by a tokeniser, and the tokens are then
+// transformed by each token filter in turn. When used to analyse queries, only keywords in the target fields are
+// analysed, and keywords in controlled vocabulary fields never are.
+type Analyser struct {
+	tokeniser Tokeniser
+	filters   []TokenFilter
+	fields    map[string]bool
+}
+
+// WithTokeniser sets the tokeniser of an analyser (by default, a WordTokeniser that splits hyphenated words).
+func WithTokeniser(tokeniser Tokeniser) func(*Analyser) {
+	return func(a *Analyser) {
+		a.tokeniser = tokeniser
+	}
+}
+
+// WithFilters adds token filters to an analyser, which are applied in order.
+func WithFilters(filters ...TokenFilter) func(*Analyser) {
+	return func(a *Analyser) {
+		a.filters = append(a.filters, filters...)
+	}
+}
+
+// Fields restricts the analysis of queries to keywords in the specified fields (by default, every field that is not
+// a controlled vocabulary field).
+func Fields(f ...string) func(*Analyser) {
+	return func(a *Analyser) {
+		for _, field := range f {
+			a.fields[field] = true
+		}
+	}
+}
+
+// NewAnalyser creates a new analyser.
+func NewAnalyser(options ...func(*Analyser)) Analyser {
+	a := Analyser{
+		tokeniser: WordTokeniser{Hyphens: HyphenSplit},
+		fields:    make(map[string]bool),
+	}
+	for _, option := range options {
+		option(&a)
+	}
+	return a
+}
+
+// Analyse splits text into tokens and applies the token filters to them.
+func (a Analyser) Analyse(text string) []string {
+	tokens := a.tokeniser.Tokenise(text)
+	for _, filter := range a.filters {
+		tokens = filter(tokens)
+	}
+	return tokens
+}
+
+// Targets determines if the analyser analyses keywords with the specified fields.
+func (a Analyser) Targets(f []string) bool {
+	if IsControlledVocabulary(f) {
+		return false
+	}
+	if len(a.fields) == 0 {
+		return true
+	}
+	for _, field := range f {
+		if a.fields[field] {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalyseQuery analyses the keywords of a query that the analyser targets (see Targets), leaving the original query
+// unchanged. The tokens of a keyword are joined by spaces; a keyword that has no tokens after analysis (e.g. one
+// that only contains stopwords) is left as it was.
+func (a Analyser) AnalyseQuery(query cqr.CommonQueryRepresentation) cqr.CommonQueryRepresentation {
+	switch q := query.(type) {
+	case cqr.Keyword:
+		if !a.Targets(q.Fields) {
+			return q
+		}
+		tokens := a.Analyse(q.QueryString)
+		if len(tokens) == 0 {
+			return q
+		}
+		return cqr.Keyword{
+			QueryString: strings.Join(tokens, " "),
+			Fields:      q.Fields,
+			Options:     q.Options,
+		}
+	case cqr.BooleanQuery:
+		children := make([]cqr.CommonQueryRepresentation, len(q.Children))
+		for i, child := range q.Children {
+			children[i] = a.AnalyseQuery(child)
+		}
+		return cqr.BooleanQuery{
+			Operator: q.Operator,
+			Children: children,
+			Options:  q.Options,
+		}
+	}
+	return query
+}
@@ -0,0 +1,108 @@
+package analyser_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/preprocess/analyser"
+	"github.com/hscells/transmute/fields"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWordTokeniser(t *testing.T) {
+	text := "Anti-TNF therapy (covid-19) for ran*"
+	for mode, expected := range map[analyser.HyphenMode][]string{
+		analyser.HyphenSplit: {"Anti", "TNF", "therapy", "covid", "19", "for", "ran*"},
+		analyser.HyphenKeep:  {"Anti-TNF", "therapy", "covid-19", "for", "ran*"},
+		analyser.HyphenJoin:  {"AntiTNF", "therapy", "covid19", "for", "ran*"},
+	} {
+		if tokens := (analyser.WordTokeniser{Hyphens: mode}).Tokenise(text); !reflect.DeepEqual(tokens, expected) {
+			t.Errorf("expected %v, got %v", expected, tokens)
+		}
+	}
+}
+
+func TestKrovetzStemmer(t *testing.T) {
+	for word, expected := range map[string]string{
+		"trials":     "trial",
+		"studies":    "study",
+		"randomised": "randomise",
+		"stopped":    "stop",
+		"tried":      "try",
+		"screening":  "screen",
+		"analysis":   "analysis",
+		"patches":    "patch",
+		"proceed":    "proceed",
+		"exceeded":   "exceed",
+		"bleeding":   "bleed",
+		"species":    "species",
+		"series":     "series",
+	} {
+		if stem := analyser.KrovetzStemmer.Stem(word); stem != expected {
+			t.Errorf("expected %s to stem to %s, got %s", word, expected, stem)
+		}
+	}
+}
+
+func TestSpellingVariants(t *testing.T) {
+	for british, american := range map[string]string{
+		"haemorrhage":   "hemorrhage",
+		"oesophageal":   "esophageal",
+		"tumours":       "tumors",
+		"randomised":    "randomized",
+		"randomisation": "randomization",
+		"organism":      "organism",
+		"cancer":        "cancer",
+	} {
+		if s := analyser.DefaultSpellingVariants.American(british); s != american {
+			t.Errorf("expected %s to be spelt %s, got %s", british, american, s)
+		}
+	}
+
+	for text, expected := range map[string][]string{
+		"paediatric tumours":           {"pediatric tumors"},
+		"anemia":                       {"anaemia"},
+		"haem*":                        nil,
+		"cancer":                       nil,
+		`"Tumour Cells", (randomised)`: {`"tumor cells", (randomized)`},
+	} {
+		if v := analyser.DefaultSpellingVariants.Variants(text); !reflect.DeepEqual(v, expected) {
+			t.Errorf("expected %s to have the variants %v, got %v", text, expected, v)
+		}
+	}
+
+	variants, err := analyser.ReadSpellingVariants(strings.NewReader("# comment\nfoetus\tfetus\npaed*\tped*\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := variants.American("paediatrics"); s != "pediatrics" {
+		t.Errorf("expected pediatrics, got %s", s)
+	}
+}
+
+func TestAnalyser_AnalyseQuery(t *testing.T) {
+	a := analyser.NewAnalyser(
+		analyser.WithFilters(
+			analyser.Lowercase,
+			analyser.RemoveStopwords(analyser.PubMedStopwords),
+			analyser.NormaliseSpelling(analyser.DefaultSpellingVariants),
+			analyser.Stem(analyser.KrovetzStemmer),
+		),
+		analyser.Fields(fields.Title, fields.TitleAbstract),
+	)
+	q := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("Tumours of the Breast", fields.TitleAbstract),
+		cqr.NewKeyword("Breast Neoplasms", fields.MeshHeadings),
+		cqr.NewKeyword("Randomised Trials", fields.Abstract),
+		cqr.NewKeyword("screen*", fields.Title),
+	})
+	analysed := a.AnalyseQuery(q).(cqr.BooleanQuery)
+	for i, expected := range []string{"tumor breast", "Breast Neoplasms", "Randomised Trials", "screen*"} {
+		if s := analysed.Children[i].(cqr.Keyword).QueryString; s != expected {
+			t.Errorf("expected %s, got %s", expected, s)
+		}
+	}
+	if s := q.Children[0].(cqr.Keyword).QueryString; s != "Tumours of the Breast" {
+		t.Errorf("expected the original query to be unchanged, got %s", s)
+	}
+}
@@ -0,0 +1,240 @@
+package analyser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SpellingVariants are British spellings of words and their American equivalents. Variants are either whole
+// words (tumour -> tumor), or prefixes that apply to every word that starts with them (haem -> hem, so that
+// haemorrhage -> hemorrhage and haematology -> hematology).
+type SpellingVariants struct {
+	words    map[string]string
+	british  map[string]string
+	prefixes [][2]string
+}
+
+// NewSpellingVariants creates spelling variants from British -> American pairs. A British spelling ending in *
+// is a prefix.
+func NewSpellingVariants(pairs map[string]string) SpellingVariants {
+	s := SpellingVariants{words: make(map[string]string), british: make(map[string]string)}
+	for british, american := range pairs {
+		s.add(british, american)
+	}
+	s.sort()
+	return s
+}
+
+func (s *SpellingVariants) add(british, american string) {
+	british, american = strings.ToLower(british), strings.ToLower(american)
+	if strings.HasSuffix(british, "*") {
+		s.prefixes = append(s.prefixes, [2]string{strings.TrimSuffix(british, "*"), strings.TrimSuffix(american, "*")})
+		return
+	}
+	s.words[british] = american
+	s.british[american] = british
+}
+
+// sort orders the prefixes so that the longest prefix that matches a word is used.
+func (s *SpellingVariants) sort() {
+	sort.Slice(s.prefixes, func(i, j int) bool {
+		if len(s.prefixes[i][0]) != len(s.prefixes[j][0]) {
+			return len(s.prefixes[i][0]) > len(s.prefixes[j][0])
+		}
+		return s.prefixes[i][0] < s.prefixes[j][0]
+	})
+}
+
+// ReadSpellingVariants reads spelling variants with a tab-separated British and American spelling per line, e.g.:
+//
+//	tumour	tumor
+//	haem*	hem*
+//
+// Blank lines and lines starting with # are ignored.
+func ReadSpellingVariants(r io.Reader) (SpellingVariants, error) {
+	s := SpellingVariants{words: make(map[string]string), british: make(map[string]string)}
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		if len(cols) != 2 {
+			return SpellingVariants{}, fmt.Errorf("line %d of spelling variants has %d columns, expected 2", n, len(cols))
+		}
+		s.add(strings.TrimSpace(cols[0]), strings.TrimSpace(cols[1]))
+	}
+	if err := scanner.Err(); err != nil {
+		return SpellingVariants{}, err
+	}
+	s.sort()
+	return s, nil
+}
+
+// LoadSpellingVariants loads spelling variants from a file (see ReadSpellingVariants).
+func LoadSpellingVariants(file string) (SpellingVariants, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return SpellingVariants{}, err
+	}
+	defer f.Close()
+	return ReadSpellingVariants(f)
+}
+
+// American is the American spelling of a (lowercase) word, or the word itself if it has no known British spelling.
+func (s SpellingVariants) American(word string) string {
+	if american, ok := s.words[word]; ok {
+		return american
+	}
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(word, prefix[0]) {
+			return prefix[1] + word[len(prefix[0]):]
+		}
+	}
+	return word
+}
+
+// British is the British spelling of a (lowercase) word, or the word itself if it has no known American spelling.
+// Since prefixes are ambiguous in reverse (hem is also the start of hemisphere), the British spelling of a word
+// that only matches a prefix may not be a word; such a spelling retrieves nothing, so it is harmless as a variant.
+func (s SpellingVariants) British(word string) string {
+	if british, ok := s.british[word]; ok {
+		return british
+	}
+	if _, ok := s.words[word]; ok {
+		return word
+	}
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(word, prefix[0]) {
+			return word
+		}
+	}
+	longest := -1
+	for i, prefix := range s.prefixes {
+		if strings.HasPrefix(word, prefix[1]) && (longest < 0 || len(prefix[1]) > len(s.prefixes[longest][1])) {
+			longest = i
+		}
+	}
+	if longest >= 0 {
+		return s.prefixes[longest][0] + word[len(s.prefixes[longest][1]):]
+	}
+	return word
+}
+
+// Variants are the other spellings of text (e.g. the query string of a keyword): the text with every word spelt
+// the American way, and the text with every word spelt the British way. Words with wildcards are left as they are,
+// since a truncated prefix may match many more words in its other spelling (e.g. haem* and hem*). Words are runs of
+// letters, digits and wildcards; everything between them (e.g. quotes and punctuation) is kept as it is.
+func (s SpellingVariants) Variants(text string) []string {
+	text = strings.ToLower(text)
+	var american, british strings.Builder
+	start := -1
+	spell := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := text[start:end]
+		if isWildcard(word) {
+			american.WriteString(word)
+			british.WriteString(word)
+		} else {
+			american.WriteString(s.American(word))
+			british.WriteString(s.British(word))
+		}
+		start = -1
+	}
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '*' || r == '?' {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		spell(i)
+		american.WriteRune(r)
+		british.WriteRune(r)
+	}
+	spell(len(text))
+
+	var variants []string
+	seen := map[string]bool{text: true}
+	for _, variant := range []string{american.String(), british.String()} {
+		if !seen[variant] {
+			seen[variant] = true
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
+
+// britishAmerican are common British spellings in the medical literature and their American spellings.
+var britishAmerican = map[string]string{
+	"anaem*":     "anem*",
+	"anaesth*":   "anesth*",
+	"apnoea":     "apnea",
+	"behaviour*": "behavior*",
+	"caesarean":  "cesarean",
+	"centre":     "center",
+	"centres":    "centers",
+	"coeliac":    "celiac",
+	"colour*":    "color*",
+	"diarrhoea":  "diarrhea",
+	"dyspnoea":   "dyspnea",
+	"faecal":     "fecal",
+	"faeces":     "feces",
+	"fibre":      "fiber",
+	"fibres":     "fibers",
+	"foet*":      "fet*",
+	"gynaec*":    "gynec*",
+	"haem*":      "hem*",
+	"ischaem*":   "ischem*",
+	"labour":     "labor",
+	"leukaem*":   "leukem*",
+	"litre":      "liter",
+	"litres":     "liters",
+	"manoeuvre":  "maneuver",
+	"manoeuvres": "maneuvers",
+	"oedema":     "edema",
+	"oesophag*":  "esophag*",
+	"oestr*":     "estr*",
+	"orthopaed*": "orthoped*",
+	"paediatr*":  "pediatr*",
+	"programme":  "program",
+	"programmes": "programs",
+	"tumour":     "tumor",
+	"tumours":    "tumors",
+}
+
+// izeStems are the stems of words that are spelt with -ise in British English and -ize in American English
+// (e.g. randomised -> randomized).
+var izeStems = []string{
+	"apolog", "author", "capital", "categor", "character", "computer", "critic", "emphas", "general",
+	"hospital", "immobil", "immun", "individual", "industrial", "institutional", "local", "maxim", "memor",
+	"minim", "mobil", "neutral", "normal", "optim", "organ", "personal", "priorit", "random", "real", "recogn",
+	"sensit", "special", "stabil", "standard", "steril", "summar", "symbol", "util", "visual",
+}
+
+// izeSuffixes are the suffixes that follow -is/-iz.
+var izeSuffixes = []string{"e", "ed", "es", "er", "ers", "ing", "ation", "ations"}
+
+// DefaultSpellingVariants are common British spellings in the medical literature and their American spellings.
+var DefaultSpellingVariants = func() SpellingVariants {
+	pairs := make(map[string]string)
+	for british, american := range britishAmerican {
+		pairs[british] = american
+	}
+	for _, stem := range izeStems {
+		for _, suffix := range izeSuffixes {
+			pairs[stem+"is"+suffix] = stem + "iz" + suffix
+		}
+	}
+	return NewSpellingVariants(pairs)
+}()
@@ -0,0 +1,132 @@
+package analyser
+
+import (
+	"github.com/kljensen/snowball/english"
+	"github.com/reiver/go-porterstemmer"
+	"strings"
+)
+
+// Stemmer reduces a word to its stem.
+type Stemmer interface {
+	Stem(word string) string
+}
+
+// StemmerFunc is a function that can be used as a stemmer.
+type StemmerFunc func(word string) string
+
+// Stem calls the function.
+func (f StemmerFunc) Stem(word string) string {
+	return f(word)
+}
+
+var (
+	// PorterStemmer is the original Porter (1980) stemmer.
+	PorterStemmer = StemmerFunc(porterstemmer.StemString)
+	// SnowballStemmer is the English Snowball (Porter2) stemmer.
+	SnowballStemmer = StemmerFunc(func(word string) string {
+		return english.Stem(word, false)
+	})
+	// KrovetzStemmer is a light, inflectional stemmer in the style of Krovetz (1993). It only removes plural, past
+	// tense and progressive suffixes, so that stems remain words (e.g. trials -> trial, randomised -> randomise).
+	// Unlike the original, it does not consult a dictionary to resolve exceptions.
+	KrovetzStemmer = StemmerFunc(krovetz)
+)
+
+// krovetzExceptions are words that the stemmer would otherwise stem incorrectly, since it does not consult a
+// dictionary. These are singular nouns that end in -ies.
+var krovetzExceptions = map[string]bool{
+	"caries":  true,
+	"facies":  true,
+	"rabies":  true,
+	"scabies": true,
+	"series":  true,
+	"species": true,
+}
+
+// isVowel determines if the byte at position i of a word is a vowel (y is a vowel when it follows a consonant).
+func isVowel(word string, i int) bool {
+	switch word[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return true
+	case 'y':
+		return i > 0 && !isVowel(word, i-1)
+	}
+	return false
+}
+
+// hasVowel determines if a word contains a vowel.
+func hasVowel(word string) bool {
+	for i := range word {
+		if isVowel(word, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// undouble removes a doubled final consonant (e.g. stopp -> stop), except for those that are commonly doubled at
+// the end of words (l, s, and z).
+func undouble(stem string) string {
+	n := len(stem)
+	if n >= 2 && stem[n-1] == stem[n-2] && !isVowel(stem, n-1) {
+		switch stem[n-1] {
+		case 'l', 's', 'z':
+			return stem
+		}
+		return stem[:n-1]
+	}
+	return stem
+}
+
+// krovetzSuffix removes a past tense or progressive suffix from a word.
+func krovetzSuffix(word, suffix string) (string, bool) {
+	if !strings.HasSuffix(word, suffix) {
+		return word, false
+	}
+	stem := word[:len(word)-len(suffix)]
+	// Words that end in -eed are not past tenses of words that end in e (e.g. proceed, exceed, bleed).
+	if suffix == "ed" && strings.HasSuffix(stem, "e") {
+		return word, false
+	}
+	if len(stem) < 3 || !hasVowel(stem) {
+		return word, false
+	}
+	if undoubled := undouble(stem); undoubled != stem {
+		return undoubled, true
+	}
+	// A past tense i was a y (e.g. tried -> try). Stems that end in a vowel followed by s, z, v, c, or g, or that end
+	// in at, bl, or iz usually lost a final e (e.g. randomised -> randomis -> randomise).
+	n := len(stem)
+	switch {
+	case stem[n-1] == 'i' && suffix == "ed":
+		return stem[:n-1] + "y", true
+	case strings.ContainsRune("szvcg", rune(stem[n-1])) && isVowel(stem, n-2):
+		return stem + "e", true
+	case strings.HasSuffix(stem, "at") || strings.HasSuffix(stem, "bl") || strings.HasSuffix(stem, "iz"):
+		return stem + "e", true
+	}
+	return stem, true
+}
+
+func krovetz(word string) string {
+	if len(word) <= 3 || krovetzExceptions[word] {
+		return word
+	}
+	// Plurals.
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"), strings.HasSuffix(word, "zes"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		word = word[:len(word)-1]
+	}
+	// Past tense and progressive forms.
+	if stem, ok := krovetzSuffix(word, "ed"); ok {
+		return stem
+	}
+	if stem, ok := krovetzSuffix(word, "ing"); ok {
+		return stem
+	}
+	return word
+}
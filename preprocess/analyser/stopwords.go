@@ -0,0 +1,63 @@
+package analyser
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// Stopwords is a list of words that are removed from text.
+type Stopwords map[string]bool
+
+// NewStopwords creates a stopword list.
+func NewStopwords(words ...string) Stopwords {
+	s := make(Stopwords)
+	for _, word := range words {
+		s[strings.ToLower(word)] = true
+	}
+	return s
+}
+
+// ReadStopwords reads a stopword list with one word per line. Blank lines and lines starting with # are ignored.
+func ReadStopwords(r io.Reader) (Stopwords, error) {
+	s := make(Stopwords)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if len(word) == 0 || strings.HasPrefix(word, "#") {
+			continue
+		}
+		s[strings.ToLower(word)] = true
+	}
+	return s, scanner.Err()
+}
+
+// LoadStopwords loads a stopword list from a file (see ReadStopwords).
+func LoadStopwords(file string) (Stopwords, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadStopwords(f)
+}
+
+// Contains determines if a word is a stopword.
+func (s Stopwords) Contains(word string) bool {
+	return s[strings.ToLower(word)]
+}
+
+// PubMedStopwords is the stopword list used by PubMed.
+var PubMedStopwords = NewStopwords(
+	"a", "about", "again", "all", "almost", "also", "although", "always", "among", "an", "and", "another", "any",
+	"are", "as", "at", "be", "because", "been", "before", "being", "between", "both", "but", "by", "can", "could",
+	"did", "do", "does", "done", "due", "during", "each", "either", "enough", "especially", "etc", "for", "found",
+	"from", "further", "had", "has", "have", "having", "here", "how", "however", "i", "if", "in", "into", "is", "it",
+	"its", "itself", "just", "kg", "km", "made", "mainly", "make", "may", "mg", "might", "ml", "mm", "most", "mostly",
+	"must", "nearly", "neither", "no", "nor", "obtained", "of", "often", "on", "our", "overall", "perhaps", "pmid",
+	"quite", "rather", "really", "regarding", "seem", "seen", "several", "should", "show", "showed", "shown", "shows",
+	"significantly", "since", "so", "some", "such", "than", "that", "the", "their", "theirs", "them", "then",
+	"there", "therefore", "these", "they", "this", "those", "through", "thus", "to", "upon", "use", "used", "using",
+	"various", "very", "was", "we", "were", "what", "when", "which", "while", "with", "within", "without", "would",
+)
@@ -0,0 +1,79 @@
+package analyser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// HyphenMode is how a tokeniser handles hyphens within words (e.g. covid-19).
+type HyphenMode int
+
+const (
+	// HyphenSplit splits hyphenated words into separate tokens (covid, 19).
+	HyphenSplit HyphenMode = iota
+	// HyphenKeep keeps hyphenated words as a single token (covid-19).
+	HyphenKeep
+	// HyphenJoin removes hyphens, joining the parts of hyphenated words into a single token (covid19).
+	HyphenJoin
+)
+
+// Tokeniser splits text into tokens.
+type Tokeniser interface {
+	Tokenise(text string) []string
+}
+
+// TokeniserFunc is a function that can be used as a tokeniser.
+type TokeniserFunc func(text string) []string
+
+// Tokenise calls the function.
+func (f TokeniserFunc) Tokenise(text string) []string {
+	return f(text)
+}
+
+// WhitespaceTokeniser splits text on whitespace.
+var WhitespaceTokeniser = TokeniserFunc(strings.Fields)
+
+// WordTokeniser splits text into words: runs of letters and digits. The wildcards of query strings (* and ?) are
+// kept as part of words, so truncated terms survive tokenisation. Hyphens within words are handled according to
+// the hyphen mode; hyphens anywhere else separate words.
+type WordTokeniser struct {
+	Hyphens HyphenMode
+}
+
+// isWordRune determines if a rune is part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '*' || r == '?'
+}
+
+// Tokenise splits text into words.
+func (t WordTokeniser) Tokenise(text string) []string {
+	var (
+		tokens []string
+		token  strings.Builder
+	)
+	runes := []rune(text)
+	for i, r := range runes {
+		if isWordRune(r) {
+			token.WriteRune(r)
+			continue
+		}
+		// A hyphen between two word runes is within a word.
+		if r == '-' && token.Len() > 0 && i+1 < len(runes) && isWordRune(runes[i+1]) {
+			switch t.Hyphens {
+			case HyphenKeep:
+				token.WriteRune(r)
+				continue
+			case HyphenJoin:
+				continue
+			}
+		}
+		if token.Len() > 0 {
+			tokens = append(tokens, token.String())
+			token.Reset()
+		}
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
@@ -2,73 +2,181 @@ package preprocess
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/hscells/cqr"
-	"github.com/hscells/transmute/fields"
-	"os"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"io"
+	"io/ioutil"
+	"log"
 	"strings"
+	"sync"
 	"time"
 )
 
-// DateRestrictions loads a file in the format:
+// RestrictDates restricts a query to documents published between the start and end dates.
+func RestrictDates(query cqr.CommonQueryRepresentation, start, end time.Time) cqr.CommonQueryRepresentation {
+	return pipeline.DateRestriction{Start: start, End: end}.Restrict(query)
+}
+
+// TopicDateRestrictions are the date restrictions of each topic.
+type TopicDateRestrictions map[string]pipeline.DateRestriction
+
+// dateRestriction is a date restriction in JSON.
+type dateRestriction struct {
+	Topic string `json:"topic"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// ReadDateRestrictions reads date restrictions in either the tab-separated format:
 //
 //	CD008122	19400101	20100114
-// 	CD008587	19920101	20151130
-// 	CD008759	19460101	20160630
-// 	CD008892	19660101	20160301
-// 	CD009175	19500101	20120626
-// 	CD009263	19400101	20120921
-// 	CD009694	19920101	20120831
-// 	CD010213	19460101	20160719
-// 	CD010296	19460101	20160701
-// 	CD010502	19800101	20130201
-// 	CD010657	19400101	20160331
+//	CD008587	19920101	20151130
 //
-// Where the fist column is the topic of the query, and the other
-// two columns are the start and end dates of the restriction.
-func DateRestrictions(pubDatesFile string) BooleanTransformation {
-	return func(query cqr.CommonQueryRepresentation, topic string) Transformation {
-		return func() cqr.CommonQueryRepresentation {
-			f, err := os.OpenFile(pubDatesFile, os.O_RDONLY, 0644)
-			if err != nil {
-				panic(err)
+// where the first column is the topic of the query, and the other two columns are the start and end dates of
+// the restriction, or in JSON as an object keyed by topic:
+//
+//	{"CD008122": {"start": "19400101", "end": "20100114"}}
+//
+// or as a list:
+//
+//	[{"topic": "CD008122", "start": "19400101", "end": "20100114"}]
+//
+// Dates may be written in any of the formats accepted by pipeline.ParseDate. An error is returned for the first
+// restriction that is invalid, or for a topic with more than one restriction.
+func ReadDateRestrictions(r io.Reader) (TopicDateRestrictions, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var restrictions []dateRestriction
+	switch trimmed := bytes.TrimSpace(b); {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var m map[string]dateRestriction
+		if err := json.Unmarshal(trimmed, &m); err != nil {
+			return nil, err
+		}
+		for topic, d := range m {
+			d.Topic = topic
+			restrictions = append(restrictions, d)
+		}
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := json.Unmarshal(trimmed, &restrictions); err != nil {
+			return nil, err
+		}
+	default:
+		s := bufio.NewScanner(bytes.NewReader(b))
+		n := 0
+		for s.Scan() {
+			n++
+			line := strings.TrimSpace(s.Text())
+			if len(line) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			cols := strings.Fields(line)
+			if len(cols) != 3 {
+				return nil, fmt.Errorf("line %d of date restrictions has %d columns, expected 3", n, len(cols))
 			}
+			restrictions = append(restrictions, dateRestriction{Topic: cols[0], Start: cols[1], End: cols[2]})
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+	}
 
-			type restriction struct {
-				topic string
-				start time.Time
-				end   time.Time
+	t := make(TopicDateRestrictions)
+	for _, r := range restrictions {
+		if len(r.Topic) == 0 {
+			return nil, fmt.Errorf("date restriction has no topic")
+		}
+		if _, ok := t[r.Topic]; ok {
+			return nil, fmt.Errorf("topic %s has more than one date restriction", r.Topic)
+		}
+		d, err := pipeline.ParseDateRestriction(r.Start, r.End)
+		if err != nil {
+			return nil, fmt.Errorf("topic %s: %v", r.Topic, err)
+		}
+		t[r.Topic] = d
+	}
+	return t, nil
+}
+
+// LoadDateRestrictions loads date restrictions from a file (see ReadDateRestrictions).
+func LoadDateRestrictions(file string) (TopicDateRestrictions, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ReadDateRestrictions(bytes.NewReader(b))
+}
+
+// Apply sets the date restriction of each query that has one. Date restrictions already set on a query (e.g. from
+// its topic file) take precedence.
+func (t TopicDateRestrictions) Apply(queries []pipeline.Query) []pipeline.Query {
+	restricted := make([]pipeline.Query, len(queries))
+	for i, q := range queries {
+		if d, ok := t[q.Topic]; ok {
+			if _, set := q.Metadata[pipeline.DateStartMetadata]; !set {
+				q = q.SetDateRestriction(d)
 			}
-			var restrictions []restriction
+		}
+		restricted[i] = q
+	}
+	return restricted
+}
 
-			s := bufio.NewScanner(f)
-			for s.Scan() {
-				line := strings.Split(s.Text(), "\t")
-				topic, start, end := line[0], line[1], line[2]
-				s, err := time.Parse("20060102", start)
-				if err != nil {
-					panic(err)
-				}
-				e, err := time.Parse("20060102", end)
+// Restrict restricts a query to the date restriction of a topic, if the topic has one.
+func (t TopicDateRestrictions) Restrict(query cqr.CommonQueryRepresentation, topic string) cqr.CommonQueryRepresentation {
+	if d, ok := t[topic]; ok {
+		return d.Restrict(query)
+	}
+	return query
+}
+
+// DateRestrictionsTransformation restricts queries to the date restrictions in a file (see ReadDateRestrictions).
+// The file is loaded when the transformation is created, so an invalid file is reported before any query is
+// transformed.
+func DateRestrictionsTransformation(file string) (QueryTransformation, error) {
+	t, err := LoadDateRestrictions(file)
+	if err != nil {
+		return QueryTransformation{}, err
+	}
+	return NewQueryTransformation("date_restrictions", func(ctx context.Context, query cqr.CommonQueryRepresentation, topic string, ss stats.StatisticsSource) (cqr.CommonQueryRepresentation, error) {
+		return t.Restrict(query, topic), nil
+	}), nil
+}
+
+var (
+	dateRestrictionsMu    sync.Mutex
+	dateRestrictionsFiles = make(map[string]TopicDateRestrictions)
+)
+
+// DateRestrictions restricts queries to the date restrictions in a file (see ReadDateRestrictions). The file is
+// only read once.
+//
+// Deprecated: a BooleanTransformation cannot report an invalid file, so it is logged and queries are not
+// restricted. Use LoadDateRestrictions and set the date restriction of each query with TopicDateRestrictions.Apply,
+// so that statistics sources apply it when queries are executed, or use DateRestrictionsTransformation.
+func DateRestrictions(pubDatesFile string) BooleanTransformation {
+	return func(query cqr.CommonQueryRepresentation, topic string) Transformation {
+		return func() cqr.CommonQueryRepresentation {
+			dateRestrictionsMu.Lock()
+			t, ok := dateRestrictionsFiles[pubDatesFile]
+			if !ok {
+				var err error
+				t, err = LoadDateRestrictions(pubDatesFile)
 				if err != nil {
-					panic(err)
-				}
-				restrictions = append(restrictions, restriction{
-					topic: topic,
-					start: s,
-					end:   e,
-				})
-			}
-			for _, r := range restrictions {
-				if r.topic == topic {
-					bq := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
-						query,
-						cqr.NewKeyword(fmt.Sprintf("%s:%s", r.start.Format("2006/01"), r.end.Format("2006/01")), fields.PublicationDate),
-					})
-					return bq
+					log.Printf("could not load date restrictions from %s: %v", pubDatesFile, err)
 				}
+				dateRestrictionsFiles[pubDatesFile] = t
 			}
-			return query
+			dateRestrictionsMu.Unlock()
+			return t.Restrict(query, topic)
 		}
 	}
 }
@@ -0,0 +1,78 @@
+package preprocess_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/preprocess"
+	"strings"
+	"testing"
+)
+
+func TestReadDateRestrictions(t *testing.T) {
+	for _, source := range []string{
+		"CD008122\t19400101\t20100114\nCD008587\t1992-01-01\t2015-11-30\n",
+		`{"CD008122": {"start": "19400101", "end": "20100114"}, "CD008587": {"start": "1992-01-01", "end": "2015-11-30"}}`,
+		`[{"topic": "CD008122", "start": "19400101", "end": "20100114"}, {"topic": "CD008587", "start": "1992/01/01", "end": "2015/11/30"}]`,
+	} {
+		restrictions, err := preprocess.ReadDateRestrictions(strings.NewReader(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(restrictions) != 2 {
+			t.Fatalf("expected 2 date restrictions, got %d", len(restrictions))
+		}
+		if d := restrictions["CD008587"].String(); d != "19920101-20151130" {
+			t.Errorf("expected 19920101-20151130, got %s", d)
+		}
+	}
+
+	for _, source := range []string{
+		"CD008122\t19400101\n",
+		"CD008122\t20100114\t19400101\n",
+		"CD008122\t19400101\t2010-13-01\n",
+		"CD008122\t19400101\t20100114\nCD008122\t19400101\t20100114\n",
+	} {
+		if _, err := preprocess.ReadDateRestrictions(strings.NewReader(source)); err == nil {
+			t.Errorf("expected an error for %q", source)
+		}
+	}
+
+	restrictions, err := preprocess.ReadDateRestrictions(strings.NewReader("CD008122\t19400101\t20100114\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := restrictions.Apply([]pipeline.Query{
+		pipeline.NewQuery("CD008122", "CD008122", cqr.NewKeyword("cancer")),
+		pipeline.NewQuery("CD008587", "CD008587", cqr.NewKeyword("cancer")),
+	})
+	if d, err := queries[0].DateRestriction(); err != nil || d == nil || d.String() != "19400101-20100114" {
+		t.Errorf("expected CD008122 to be restricted to 19400101-20100114, got %v (%v)", d, err)
+	}
+	if d, err := queries[1].DateRestriction(); err != nil || d != nil {
+		t.Errorf("expected CD008587 to have no date restriction, got %v (%v)", d, err)
+	}
+}
+
+func TestParseDateRestriction(t *testing.T) {
+	// An end date without a day or month includes all of that month or year.
+	for _, c := range []struct {
+		start, end string
+		expected   string
+		keyword    string
+	}{
+		{"1990", "2000", "19900101-20001231", "1990/01:2000/12"},
+		{"1990-02", "2000-02", "19900201-20000229", "1990/02:2000/02"},
+		{"1990/02/03", "2000/02/03", "19900203-20000203", "1990/02:2000/02"},
+	} {
+		d, err := pipeline.ParseDateRestriction(c.start, c.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.String() != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, d.String())
+		}
+		if k := d.Keyword().QueryString; k != c.keyword {
+			t.Errorf("expected the keyword %s, got %s", c.keyword, k)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package preprocess
 
 import (
+	"context"
 	"fmt"
 	"github.com/hscells/cqr"
 	"github.com/hscells/groove/analysis"
@@ -11,27 +12,63 @@ import (
 // ElasticsearchTransformation is a specific transformation that uses an Elasticsearch statistics source.
 type ElasticsearchTransformation func(query cqr.CommonQueryRepresentation, source *stats.ElasticsearchStatisticsSource) Transformation
 
+// analyse runs the analyser of an Elasticsearch statistics source on the keywords of a query.
+func analyse(ctx context.Context, query cqr.CommonQueryRepresentation, source *stats.ElasticsearchStatisticsSource) (cqr.CommonQueryRepresentation, error) {
+	switch q := query.(type) {
+	case cqr.Keyword:
+		tokens, err := source.AnalyseContext(ctx, q.QueryString, source.Analyser)
+		if err != nil {
+			return nil, err
+		}
+		return cqr.NewKeyword(strings.Join(tokens, " "), q.Fields...), nil
+	case cqr.BooleanQuery:
+		children := make([]cqr.CommonQueryRepresentation, len(q.Children))
+		for i, child := range q.Children {
+			c, err := analyse(ctx, child, source)
+			if err != nil {
+				return nil, err
+			}
+			children[i] = c
+		}
+		q.Children = children
+		return q, nil
+	default:
+		return q, nil
+	}
+}
+
 // Analyse runs the specified Elasticsearch analyser on a query and returns a new, analysed query.
+//
+// Deprecated: Analyse panics if the query cannot be analysed; use AnalyseTransformation.
 func Analyse(query cqr.CommonQueryRepresentation, source *stats.ElasticsearchStatisticsSource) Transformation {
 	return func() cqr.CommonQueryRepresentation {
-		switch q := query.(type) {
-		case cqr.Keyword:
-			tokens, err := source.Analyse(q.QueryString, source.Analyser)
-			if err != nil {
-				panic(err)
-			}
-			return cqr.NewKeyword(strings.Join(tokens, " "), q.Fields...)
-		case cqr.BooleanQuery:
-			for i, child := range q.Children {
-				q.Children[i] = Analyse(child, source)()
-			}
-			return q
-		default:
-			return q
+		q, err := analyse(context.Background(), query, source)
+		if err != nil {
+			panic(err)
 		}
+		return q
 	}
 }
 
+// AnalyseTransformation runs the analyser of an Elasticsearch statistics source on the keywords of queries.
+var AnalyseTransformation = NewQueryTransformation("analyse", func(ctx context.Context, query cqr.CommonQueryRepresentation, topic string, ss stats.StatisticsSource) (cqr.CommonQueryRepresentation, error) {
+	es, ok := ss.(*stats.ElasticsearchStatisticsSource)
+	if !ok {
+		return nil, RequireElasticsearch(ss)
+	}
+	return analyse(ctx, query, es)
+}, RequireElasticsearch)
+
+// SetAnalyseFieldTransformation sets the text and title fields of queries to be analysed by the analyser of an
+// Elasticsearch statistics source (see SetAnalyseField).
+var SetAnalyseFieldTransformation = NewQueryTransformation("set_analyse_field", func(ctx context.Context, query cqr.CommonQueryRepresentation, topic string, ss stats.StatisticsSource) (cqr.CommonQueryRepresentation, error) {
+	es, ok := ss.(*stats.ElasticsearchStatisticsSource)
+	if !ok {
+		return nil, RequireElasticsearch(ss)
+	}
+	return SetAnalyseField(query, es)(), nil
+}, RequireElasticsearch)
+
 // SetAnalyseField sets the text and title fields to be analysed by the specified analyser.
 func SetAnalyseField(query cqr.CommonQueryRepresentation, source *stats.ElasticsearchStatisticsSource) Transformation {
 	return func() cqr.CommonQueryRepresentation {
@@ -0,0 +1,434 @@
+package preprocess
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/transmute"
+	"github.com/hscells/transmute/fields"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed filters/*.json
+var searchFilterFiles embed.FS
+
+const (
+	// FilterAnd restricts queries to the documents retrieved by a search filter.
+	FilterAnd = cqr.AND
+	// FilterNot removes the documents retrieved by a search filter from queries.
+	FilterNot = cqr.NOT
+)
+
+// SearchFilter is a validated search filter (sometimes called a hedge), such as the Cochrane Highly Sensitive
+// Search Strategy for randomised controlled trials. Filters are identified by a name and a version, since
+// published filters are revised over time.
+type SearchFilter struct {
+	Name      string
+	Version   string
+	Title     string
+	Category  string
+	Reference string
+	// Operator is how the filter is combined with queries, either FilterAnd or FilterNot.
+	Operator string
+	Query    cqr.CommonQueryRepresentation
+}
+
+// searchFilter is the format search filters are written in data files, e.g.:
+//
+//	{
+//	  "name": "humans-only",
+//	  "version": "2008",
+//	  "title": "Exclude studies of animals that are not also studies of humans",
+//	  "category": "population",
+//	  "reference": "Cochrane Handbook for Systematic Reviews of Interventions 5.0, Section 6.4.11.1",
+//	  "syntax": "pubmed",
+//	  "operator": "not",
+//	  "query": "animals[mh] NOT humans[mh]"
+//	}
+//
+// The query may be written in either PubMed ("pubmed") or Ovid MEDLINE ("medline") syntax.
+type searchFilter struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Title     string `json:"title"`
+	Category  string `json:"category"`
+	Reference string `json:"reference"`
+	Syntax    string `json:"syntax"`
+	Operator  string `json:"operator"`
+	Query     string `json:"query"`
+}
+
+// String is the reference of a search filter, in the format name@version.
+func (f SearchFilter) String() string {
+	return f.Name + "@" + f.Version
+}
+
+// compileFilter parses the query of a search filter. Since the parsers may panic on malformed input, any panic
+// is recovered and returned as an error.
+func compileFilter(query, syntax string) (q cqr.CommonQueryRepresentation, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("could not parse %s query: %v", syntax, r)
+		}
+	}()
+	switch syntax {
+	case "pubmed", "":
+		return transmute.CompilePubmed2Cqr(query)
+	case "medline":
+		return transmute.CompileMedline2Cqr(query)
+	}
+	return nil, fmt.Errorf("unknown query syntax %s", syntax)
+}
+
+// ReadSearchFilter reads a search filter from a data file (see searchFilter).
+func ReadSearchFilter(r io.Reader) (SearchFilter, error) {
+	var f searchFilter
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return SearchFilter{}, err
+	}
+	if len(f.Name) == 0 || len(f.Version) == 0 {
+		return SearchFilter{}, fmt.Errorf("search filter must have a name and a version")
+	}
+	operator := strings.ToLower(f.Operator)
+	if len(operator) == 0 {
+		operator = FilterAnd
+	}
+	if operator != FilterAnd && operator != FilterNot {
+		return SearchFilter{}, fmt.Errorf("search filter %s@%s has unknown operator %s", f.Name, f.Version, f.Operator)
+	}
+	q, err := compileFilter(f.Query, strings.ToLower(f.Syntax))
+	if err != nil {
+		return SearchFilter{}, fmt.Errorf("search filter %s@%s: %v", f.Name, f.Version, err)
+	}
+	return SearchFilter{
+		Name:      f.Name,
+		Version:   f.Version,
+		Title:     f.Title,
+		Category:  f.Category,
+		Reference: f.Reference,
+		Operator:  operator,
+		Query:     q,
+	}, nil
+}
+
+// FieldMapping maps the fields of a search filter to the fields a statistics source can search, in the same way
+// as the field mappings of transmute pipelines: a field with a mapping is replaced by the fields it maps to, any
+// other field is replaced by the "default" fields (if there are any), and is otherwise left unchanged.
+type FieldMapping map[string][]string
+
+// fieldFallbacks are the fields, in order of preference, that are searched instead of a field a statistics source
+// cannot search.
+var fieldFallbacks = map[string][]string{
+	fields.TextWord:              {fields.TitleAbstract, fields.AllFields},
+	fields.TitleAbstract:         {fields.TextWord, fields.AllFields},
+	fields.Title:                 {fields.TitleAbstract, fields.TextWord, fields.AllFields},
+	fields.Abstract:              {fields.TitleAbstract, fields.TextWord, fields.AllFields},
+	fields.MeSHTerms:             {fields.MeshHeadings},
+	fields.MeshHeadings:          {fields.MeSHTerms},
+	fields.MeSHMajorTopic:        {fields.MeshHeadings, fields.MeSHTerms},
+	fields.MajorFocusMeshHeading: {fields.MeSHMajorTopic, fields.MeshHeadings, fields.MeSHTerms},
+	fields.FloatingMeshHeadings:  {fields.MeSHSubheading, fields.MeshHeadings, fields.MeSHTerms},
+	fields.MeSHSubheading:        {fields.FloatingMeshHeadings},
+}
+
+// FieldMappingFor creates the field mapping used to apply search filters to queries issued to a statistics
+// source. Statistics sources that can only search certain fields (stats.FieldedStatisticsSource) have the fields
+// they cannot search mapped to the closest field they can; other statistics sources are given the fields of the
+// filter unchanged, since they map the fields themselves when queries are executed.
+func FieldMappingFor(ss stats.StatisticsSource) FieldMapping {
+	fs, ok := ss.(stats.FieldedStatisticsSource)
+	if !ok {
+		return nil
+	}
+	supported := make(map[string]bool)
+	for _, field := range fs.Fields() {
+		supported[field] = true
+	}
+	m := make(FieldMapping)
+	for field, fallbacks := range fieldFallbacks {
+		if supported[field] {
+			continue
+		}
+		for _, fallback := range fallbacks {
+			if supported[fallback] {
+				m[field] = []string{fallback}
+				break
+			}
+		}
+	}
+	return m
+}
+
+// mapFields replaces the fields of a keyword according to the field mapping.
+func (m FieldMapping) mapFields(f []string) []string {
+	var mapped []string
+	seen := make(map[string]bool)
+	for _, field := range f {
+		to, ok := m[field]
+		if !ok {
+			to, ok = m["default"]
+		}
+		if !ok {
+			to = []string{field}
+		}
+		for _, field := range to {
+			if !seen[field] {
+				seen[field] = true
+				mapped = append(mapped, field)
+			}
+		}
+	}
+	return mapped
+}
+
+// Map maps the fields of a query, leaving the original query unchanged.
+func (m FieldMapping) Map(query cqr.CommonQueryRepresentation) cqr.CommonQueryRepresentation {
+	switch q := query.(type) {
+	case cqr.Keyword:
+		return cqr.Keyword{
+			QueryString: q.QueryString,
+			Fields:      m.mapFields(q.Fields),
+			Options:     q.Options,
+		}
+	case cqr.BooleanQuery:
+		children := make([]cqr.CommonQueryRepresentation, len(q.Children))
+		for i, child := range q.Children {
+			children[i] = m.Map(child)
+		}
+		return cqr.BooleanQuery{
+			Operator: q.Operator,
+			Children: children,
+			Options:  q.Options,
+		}
+	}
+	return query
+}
+
+// Apply combines the filter with a query, using the fields of the filter unchanged.
+func (f SearchFilter) Apply(query cqr.CommonQueryRepresentation) cqr.CommonQueryRepresentation {
+	return cqr.NewBooleanQuery(f.Operator, []cqr.CommonQueryRepresentation{query, f.Query})
+}
+
+// Transformation creates a transformation that applies the filter to queries issued to a statistics source, with
+// the fields of the filter mapped for the statistics source (see FieldMappingFor). An error is returned if the
+// statistics source cannot search a field of the filter.
+func (f SearchFilter) Transformation(ss stats.StatisticsSource) (BooleanTransformation, error) {
+	mapped := f
+	mapped.Query = FieldMappingFor(ss).Map(f.Query)
+
+	if fs, ok := ss.(stats.FieldedStatisticsSource); ok {
+		supported := make(map[string]bool)
+		for _, field := range fs.Fields() {
+			supported[field] = true
+		}
+		for _, field := range filterFields(mapped.Query) {
+			if !supported[field] {
+				return nil, fmt.Errorf("search filter %s uses the field %s, which cannot be searched", f, field)
+			}
+		}
+	}
+
+	return func(query cqr.CommonQueryRepresentation, topic string) Transformation {
+		return func() cqr.CommonQueryRepresentation {
+			return mapped.Apply(query)
+		}
+	}, nil
+}
+
+// QueryTransformation creates a query transformation that applies the filter to queries, which requires that the
+// statistics source it is applied with can search the fields of the filter (see Transformation).
+func (f SearchFilter) QueryTransformation() QueryTransformation {
+	return NewQueryTransformation(f.String(), func(ctx context.Context, query cqr.CommonQueryRepresentation, topic string, ss stats.StatisticsSource) (cqr.CommonQueryRepresentation, error) {
+		t, err := f.Transformation(ss)
+		if err != nil {
+			return nil, err
+		}
+		return t(query, topic)(), nil
+	}, func(ss stats.StatisticsSource) error {
+		_, err := f.Transformation(ss)
+		return err
+	})
+}
+
+// filterFields are the fields of the keywords in a query.
+func filterFields(query cqr.CommonQueryRepresentation) []string {
+	switch q := query.(type) {
+	case cqr.Keyword:
+		return q.Fields
+	case cqr.BooleanQuery:
+		var f []string
+		for _, child := range q.Children {
+			f = append(f, filterFields(child)...)
+		}
+		return f
+	}
+	return nil
+}
+
+// SearchFilters is a catalogue of search filters, from which filters are referred to as either name@version, or
+// by name alone for the latest version of the filter.
+type SearchFilters struct {
+	filters map[string][]SearchFilter
+}
+
+// NewSearchFilters creates a new catalogue of search filters.
+func NewSearchFilters(filters ...SearchFilter) (*SearchFilters, error) {
+	s := &SearchFilters{filters: make(map[string][]SearchFilter)}
+	for _, f := range filters {
+		if err := s.Register(f); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// compareVersions compares two versions of a search filter; versions that are numbers (e.g. years) are compared
+// numerically.
+func compareVersions(a, b string) bool {
+	x, err1 := strconv.ParseFloat(a, 64)
+	y, err2 := strconv.ParseFloat(b, 64)
+	if err1 == nil && err2 == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// Register adds a search filter to the catalogue. An error is returned if the catalogue already contains the
+// version of the filter.
+func (s *SearchFilters) Register(f SearchFilter) error {
+	for _, other := range s.filters[f.Name] {
+		if other.Version == f.Version {
+			return fmt.Errorf("search filter %s is already registered", f)
+		}
+	}
+	versions := append(s.filters[f.Name], f)
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i].Version, versions[j].Version)
+	})
+	s.filters[f.Name] = versions
+	return nil
+}
+
+// Get looks up a search filter in the catalogue, referred to as either name@version or by name for the latest
+// version.
+func (s *SearchFilters) Get(ref string) (SearchFilter, error) {
+	name, version := ref, ""
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		name, version = ref[:i], ref[i+1:]
+	}
+	versions, ok := s.filters[name]
+	if !ok || len(versions) == 0 {
+		return SearchFilter{}, fmt.Errorf("no search filter named %s", name)
+	}
+	if len(version) == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, f := range versions {
+		if f.Version == version {
+			return f, nil
+		}
+	}
+	return SearchFilter{}, fmt.Errorf("no version %s of search filter %s", version, name)
+}
+
+// Filters are the search filters in the catalogue, sorted by name and version.
+func (s *SearchFilters) Filters() []SearchFilter {
+	names := make([]string, 0, len(s.filters))
+	for name := range s.filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var filters []SearchFilter
+	for _, name := range names {
+		filters = append(filters, s.filters[name]...)
+	}
+	return filters
+}
+
+// Transformation creates a transformation for a search filter in the catalogue (see SearchFilter.Transformation).
+func (s *SearchFilters) Transformation(ref string, ss stats.StatisticsSource) (BooleanTransformation, error) {
+	f, err := s.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	return f.Transformation(ss)
+}
+
+// LoadSearchFilters loads a catalogue of search filters from the data files (*.json) in a directory.
+func LoadSearchFilters(dir string) (*SearchFilters, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	s, _ := NewSearchFilters()
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		f, err := ReadSearchFilter(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if err := s.Register(f); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return s, nil
+}
+
+var (
+	defaultSearchFilters     *SearchFilters
+	defaultSearchFiltersErr  error
+	defaultSearchFiltersOnce sync.Once
+)
+
+// DefaultSearchFilters is the catalogue of search filters distributed with groove:
+//
+//	cochrane-hsss-sensitivity  Cochrane HSSS for randomised trials, sensitivity-maximising
+//	cochrane-hsss-precision    Cochrane HSSS for randomised trials, sensitivity- and precision-maximising
+//	dta-sensitive              diagnostic test accuracy studies, sensitive (Haynes 2004)
+//	dta-specific               diagnostic test accuracy studies, specific (Haynes 2004)
+//	humans-only                excludes studies of animals that are not also studies of humans
+//	english-language           studies published in English
+//	observational-studies      cohort, case-control and cross-sectional study designs (SIGN)
+func DefaultSearchFilters() (*SearchFilters, error) {
+	defaultSearchFiltersOnce.Do(func() {
+		defaultSearchFilters, _ = NewSearchFilters()
+		entries, err := searchFilterFiles.ReadDir("filters")
+		if err != nil {
+			defaultSearchFiltersErr = err
+			return
+		}
+		for _, entry := range entries {
+			file := path.Join("filters", entry.Name())
+			r, err := searchFilterFiles.Open(file)
+			if err != nil {
+				defaultSearchFiltersErr = err
+				return
+			}
+			f, err := ReadSearchFilter(r)
+			r.Close()
+			if err != nil {
+				defaultSearchFiltersErr = fmt.Errorf("%s: %v", file, err)
+				return
+			}
+			if err := defaultSearchFilters.Register(f); err != nil {
+				defaultSearchFiltersErr = fmt.Errorf("%s: %v", file, err)
+				return
+			}
+		}
+	})
+	return defaultSearchFilters, defaultSearchFiltersErr
+}
@@ -0,0 +1,62 @@
+package preprocess_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/preprocess"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/transmute/fields"
+	"testing"
+)
+
+// fieldedSource is a statistics source that can only search certain fields.
+type fieldedSource struct {
+	stats.StatisticsSource
+	fields []string
+}
+
+func (s fieldedSource) Fields() []string {
+	return s.fields
+}
+
+func TestDefaultSearchFilters(t *testing.T) {
+	filters, err := preprocess.DefaultSearchFilters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cochrane-hsss-sensitivity", "cochrane-hsss-precision", "dta-sensitive", "dta-specific", "humans-only", "english-language", "observational-studies"} {
+		if _, err := filters.Get(name); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := filters.Get("humans-only@1900"); err == nil {
+		t.Error("expected an error for a version that does not exist")
+	}
+
+	f, err := filters.Get("humans-only@2008")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Operator != preprocess.FilterNot {
+		t.Errorf("expected humans-only to be a %s filter, got %s", preprocess.FilterNot, f.Operator)
+	}
+
+	// The MeSH headings of the filter are mapped to the field the statistics source can search.
+	transformation, err := f.Transformation(fieldedSource{fields: []string{fields.TitleAbstract, fields.MeSHTerms}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := transformation(cqr.NewKeyword("cancer", fields.TitleAbstract), "1")().(cqr.BooleanQuery)
+	if q.Operator != cqr.NOT || len(q.Children) != 2 {
+		t.Fatalf("expected the query to be filtered, got %v", q)
+	}
+	for _, keyword := range q.Children[1].(cqr.BooleanQuery).Children {
+		if k := keyword.(cqr.Keyword); len(k.Fields) != 1 || k.Fields[0] != fields.MeSHTerms {
+			t.Errorf("expected %s to be mapped to %s, got %v", k.QueryString, fields.MeSHTerms, k.Fields)
+		}
+	}
+
+	// A statistics source that cannot search MeSH headings cannot use the filter.
+	if _, err := f.Transformation(fieldedSource{fields: []string{fields.TitleAbstract}}); err == nil {
+		t.Error("expected an error for a statistics source that cannot search MeSH headings")
+	}
+}
@@ -2,7 +2,10 @@
 package preprocess
 
 import (
+	"context"
 	"github.com/hscells/cqr"
+	"github.com/hscells/groove/preprocess/analyser"
+	"github.com/hscells/groove/stats"
 	"regexp"
 	"strings"
 )
@@ -32,10 +35,14 @@ func Lowercase(text string) string {
 	return strings.ToLower(text)
 }
 
-// ProcessQuery applies a query processor to a query.
+// ProcessQuery applies a query processor to a query. Keywords in controlled vocabulary fields (e.g. MeSH headings)
+// are not processed.
 func ProcessQuery(query cqr.CommonQueryRepresentation, processor QueryProcessor) cqr.CommonQueryRepresentation {
 	switch q := query.(type) {
 	case cqr.Keyword:
+		if analyser.IsControlledVocabulary(q.Fields) {
+			return q
+		}
 		q.QueryString = processor(q.QueryString)
 		return q
 	case cqr.BooleanQuery:
@@ -46,3 +53,10 @@ func ProcessQuery(query cqr.CommonQueryRepresentation, processor QueryProcessor)
 	}
 	return query
 }
+
+// TextAnalysis analyses the keywords of queries with an analyser (see analyser.Analyser.AnalyseQuery).
+func TextAnalysis(a analyser.Analyser) QueryTransformation {
+	return NewQueryTransformation("text_analysis", func(ctx context.Context, query cqr.CommonQueryRepresentation, topic string, ss stats.StatisticsSource) (cqr.CommonQueryRepresentation, error) {
+		return a.AnalyseQuery(query), nil
+	})
+}
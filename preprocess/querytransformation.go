@@ -0,0 +1,142 @@
+package preprocess
+
+import (
+	"context"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/stats"
+)
+
+// TransformationFunc transforms a query, using the statistics source queries will be issued to. Unlike a
+// Transformation, it reports failures as errors, and stops when its context is cancelled.
+type TransformationFunc func(ctx context.Context, query cqr.CommonQueryRepresentation, topic string, ss stats.StatisticsSource) (cqr.CommonQueryRepresentation, error)
+
+// SourceRequirement validates that a transformation can be applied with a statistics source.
+type SourceRequirement func(ss stats.StatisticsSource) error
+
+// QueryTransformation is a named transformation along with the requirements it has of the statistics source it is
+// applied with. Requirements are checked by Validate when a pipeline is constructed, rather than when queries are
+// transformed.
+type QueryTransformation struct {
+	Name      string
+	Transform TransformationFunc
+	Requires  []SourceRequirement
+}
+
+// NewQueryTransformation creates a new query transformation.
+func NewQueryTransformation(name string, transform TransformationFunc, requires ...SourceRequirement) QueryTransformation {
+	return QueryTransformation{
+		Name:      name,
+		Transform: transform,
+		Requires:  requires,
+	}
+}
+
+// Validate checks that the transformation can be applied with a statistics source.
+func (t QueryTransformation) Validate(ss stats.StatisticsSource) error {
+	for _, requirement := range t.Requires {
+		if err := requirement(ss); err != nil {
+			return fmt.Errorf("transformation %s: %v", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// Apply transforms a query. The context is checked before the query is transformed.
+func (t QueryTransformation) Apply(ctx context.Context, query cqr.CommonQueryRepresentation, topic string, ss stats.StatisticsSource) (cqr.CommonQueryRepresentation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	q, err := t.Transform(ctx, query, topic, ss)
+	if err != nil {
+		return nil, fmt.Errorf("transformation %s: %v", t.Name, err)
+	}
+	return q, nil
+}
+
+// RequireElasticsearch requires the statistics source to be an Elasticsearch statistics source.
+func RequireElasticsearch(ss stats.StatisticsSource) error {
+	if _, ok := ss.(*stats.ElasticsearchStatisticsSource); !ok {
+		return fmt.Errorf("requires an Elasticsearch statistics source, got %T", ss)
+	}
+	return nil
+}
+
+// recoverTransformation calls a transformation that may panic, returning the panic as an error.
+func recoverTransformation(t Transformation) (q cqr.CommonQueryRepresentation, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return t(), nil
+}
+
+// FromBooleanTransformation adapts a BooleanTransformation into a query transformation. A panic in the
+// transformation is returned as an error.
+func FromBooleanTransformation(name string, t BooleanTransformation) QueryTransformation {
+	return NewQueryTransformation(name, func(ctx context.Context, query cqr.CommonQueryRepresentation, topic string, ss stats.StatisticsSource) (cqr.CommonQueryRepresentation, error) {
+		return recoverTransformation(t(query, topic))
+	})
+}
+
+// FromElasticsearchTransformation adapts an ElasticsearchTransformation into a query transformation that requires
+// an Elasticsearch statistics source. A panic in the transformation is returned as an error.
+func FromElasticsearchTransformation(name string, t ElasticsearchTransformation) QueryTransformation {
+	return NewQueryTransformation(name, func(ctx context.Context, query cqr.CommonQueryRepresentation, topic string, ss stats.StatisticsSource) (cqr.CommonQueryRepresentation, error) {
+		es, ok := ss.(*stats.ElasticsearchStatisticsSource)
+		if !ok {
+			return nil, RequireElasticsearch(ss)
+		}
+		return recoverTransformation(t(query, es))
+	}, RequireElasticsearch)
+}
+
+// NewQueryTransformations creates the query transformations of a pipeline, validating each transformation
+// against the statistics source of the pipeline.
+func NewQueryTransformations(ss stats.StatisticsSource, transformations ...QueryTransformation) (QueryTransformations, error) {
+	t := QueryTransformations{Transformations: transformations}
+	if err := t.Validate(ss); err != nil {
+		return QueryTransformations{}, err
+	}
+	return t, nil
+}
+
+// All are the query transformations, with the Boolean and Elasticsearch transformations adapted, in the order they
+// are applied: Boolean transformations, then Elasticsearch transformations, then query transformations.
+func (t QueryTransformations) All() []QueryTransformation {
+	var all []QueryTransformation
+	for i, bt := range t.BooleanTransformations {
+		all = append(all, FromBooleanTransformation(fmt.Sprintf("boolean transformation %d", i), bt))
+	}
+	for i, et := range t.ElasticsearchTransformations {
+		all = append(all, FromElasticsearchTransformation(fmt.Sprintf("elasticsearch transformation %d", i), et))
+	}
+	return append(all, t.Transformations...)
+}
+
+// Validate checks that every transformation can be applied with a statistics source.
+func (t QueryTransformations) Validate(ss stats.StatisticsSource) error {
+	for _, qt := range t.All() {
+		if err := qt.Validate(ss); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply applies every transformation to a query in turn (see All).
+func (t QueryTransformations) Apply(ctx context.Context, query cqr.CommonQueryRepresentation, topic string, ss stats.StatisticsSource) (cqr.CommonQueryRepresentation, error) {
+	var err error
+	for _, qt := range t.All() {
+		query, err = qt.Apply(ctx, query, topic, ss)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
+}
@@ -0,0 +1,60 @@
+package preprocess_test
+
+import (
+	"context"
+	"errors"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/preprocess"
+	"github.com/hscells/transmute/fields"
+	"testing"
+)
+
+func TestQueryTransformations(t *testing.T) {
+	ss := fieldedSource{fields: []string{fields.TitleAbstract}}
+
+	// Elasticsearch transformations cannot be used with other statistics sources.
+	if _, err := preprocess.NewQueryTransformations(ss, preprocess.AnalyseTransformation); err == nil {
+		t.Error("expected the analyse transformation to require an Elasticsearch statistics source")
+	}
+	if err := (preprocess.QueryTransformations{ElasticsearchTransformations: []preprocess.ElasticsearchTransformation{preprocess.SetAnalyseField}}).Validate(ss); err == nil {
+		t.Error("expected Elasticsearch transformations to require an Elasticsearch statistics source")
+	}
+	// Applying them without validating the statistics source is an error rather than a panic.
+	for _, transformation := range []preprocess.QueryTransformation{preprocess.AnalyseTransformation, preprocess.SetAnalyseFieldTransformation} {
+		if _, err := transformation.Apply(context.Background(), cqr.NewKeyword("a", fields.TitleAbstract), "1", ss); err == nil {
+			t.Errorf("expected %s to require an Elasticsearch statistics source", transformation.Name)
+		}
+	}
+
+	failing := preprocess.FromBooleanTransformation("failing", func(q cqr.CommonQueryRepresentation, topic string) preprocess.Transformation {
+		return func() cqr.CommonQueryRepresentation {
+			panic(errors.New("failed"))
+		}
+	})
+	transformations, err := preprocess.NewQueryTransformations(ss, preprocess.FromBooleanTransformation("or", preprocess.OrSimplify), failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{cqr.NewKeyword("a", fields.TitleAbstract), cqr.NewKeyword("b", fields.TitleAbstract)})
+	if _, err := transformations.Apply(context.Background(), q, "1", ss); err == nil {
+		t.Error("expected the panic of a transformation to be returned as an error")
+	}
+
+	transformations, err = preprocess.NewQueryTransformations(ss, preprocess.FromBooleanTransformation("or", preprocess.OrSimplify))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tq, err := transformations.Apply(context.Background(), q, "1", ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op := tq.(cqr.BooleanQuery).Operator; op != cqr.OR {
+		t.Errorf("expected %s, got %s", cqr.OR, op)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := transformations.Apply(ctx, q, "1", ss); err == nil {
+		t.Error("expected a cancelled context to stop the transformations")
+	}
+}
@@ -0,0 +1,61 @@
+package preprocess
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/preprocess/analyser"
+)
+
+// ExpandSpelling expands each keyword of a query that has other spellings (e.g. tumour and tumor) into an OR clause
+// of the keyword and its variants (see analyser.SpellingVariants.Variants), leaving the original query unchanged.
+// Keywords in controlled vocabulary fields are not expanded, since the vocabulary has a single spelling of each
+// term.
+func ExpandSpelling(query cqr.CommonQueryRepresentation, variants analyser.SpellingVariants) cqr.CommonQueryRepresentation {
+	switch q := query.(type) {
+	case cqr.Keyword:
+		if analyser.IsControlledVocabulary(q.Fields) {
+			return q
+		}
+		v := variants.Variants(q.QueryString)
+		if len(v) == 0 {
+			return q
+		}
+		children := []cqr.CommonQueryRepresentation{q}
+		for _, variant := range v {
+			options := make(map[string]interface{}, len(q.Options))
+			for k, o := range q.Options {
+				options[k] = o
+			}
+			children = append(children, cqr.Keyword{
+				QueryString: variant,
+				Fields:      q.Fields,
+				Options:     options,
+			})
+		}
+		return cqr.NewBooleanQuery(cqr.OR, children)
+	case cqr.BooleanQuery:
+		children := make([]cqr.CommonQueryRepresentation, len(q.Children))
+		for i, child := range q.Children {
+			children[i] = ExpandSpelling(child, variants)
+		}
+		return cqr.BooleanQuery{
+			Operator: q.Operator,
+			Children: children,
+			Options:  q.Options,
+		}
+	}
+	return query
+}
+
+// SpellingVariantExpansion expands the keywords of queries with their other spellings (see ExpandSpelling). When no
+// variants are specified, analyser.DefaultSpellingVariants are used.
+func SpellingVariantExpansion(variants ...analyser.SpellingVariants) BooleanTransformation {
+	v := analyser.DefaultSpellingVariants
+	if len(variants) > 0 {
+		v = variants[0]
+	}
+	return func(query cqr.CommonQueryRepresentation, topic string) Transformation {
+		return func() cqr.CommonQueryRepresentation {
+			return ExpandSpelling(query, v)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package preprocess_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/preprocess"
+	"github.com/hscells/transmute/fields"
+	"testing"
+)
+
+func TestSpellingVariantExpansion(t *testing.T) {
+	q := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("oesophageal tumour", fields.TitleAbstract),
+		cqr.NewKeyword("Anemia", fields.MeshHeadings),
+		cqr.NewKeyword("screening", fields.TitleAbstract),
+	})
+	expanded := preprocess.SpellingVariantExpansion()(q, "1")().(cqr.BooleanQuery)
+
+	or, ok := expanded.Children[0].(cqr.BooleanQuery)
+	if !ok || or.Operator != cqr.OR || len(or.Children) != 2 {
+		t.Fatalf("expected the keyword to be expanded with its variant, got %v", expanded.Children[0])
+	}
+	if s := or.Children[1].(cqr.Keyword).QueryString; s != "esophageal tumor" {
+		t.Errorf("expected esophageal tumor, got %s", s)
+	}
+	if _, ok := expanded.Children[1].(cqr.Keyword); !ok {
+		t.Errorf("expected MeSH headings not to be expanded, got %v", expanded.Children[1])
+	}
+	if _, ok := expanded.Children[2].(cqr.Keyword); !ok {
+		t.Errorf("expected a keyword without variants not to be expanded, got %v", expanded.Children[2])
+	}
+}
@@ -22,6 +22,7 @@ type TransformedQueries []cqr.CommonQueryRepresentation
 type QueryTransformations struct {
 	BooleanTransformations       []BooleanTransformation
 	ElasticsearchTransformations []ElasticsearchTransformation
+	Transformations              []QueryTransformation
 	Output                       string
 }
 
@@ -137,6 +138,7 @@ func OrSimplify(query cqr.CommonQueryRepresentation, topic string) Transformatio
 // clinical trials as topic.sh.
 // randomly.ab.
 // trial.ti.
+// The validated versions of this filter are available in DefaultSearchFilters (e.g. cochrane-hsss-precision).
 func RCTFilter(query cqr.CommonQueryRepresentation, _ string) Transformation {
 	return func() cqr.CommonQueryRepresentation {
 		switch q := query.(type) {
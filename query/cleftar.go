@@ -0,0 +1,315 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/transmute"
+	"github.com/hscells/transmute/fields"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// OvidMedlineSyntax is the syntax of Ovid MEDLINE search strategies.
+	OvidMedlineSyntax = "medline"
+	// PubMedSyntax is the syntax of PubMed search strategies.
+	PubMedSyntax = "pubmed"
+
+	// DTACategory is the category of diagnostic test accuracy reviews.
+	DTACategory = "dta"
+	// InterventionCategory is the category of intervention reviews.
+	InterventionCategory = "intervention"
+	// PrognosisCategory is the category of prognosis reviews.
+	PrognosisCategory = "prognosis"
+	// QualitativeCategory is the category of qualitative reviews.
+	QualitativeCategory = "qualitative"
+
+	// CategoryMetadata is the category of review a CLEF TAR topic belongs to.
+	CategoryMetadata = "category"
+	// SyntaxMetadata is the syntax the query of a CLEF TAR topic was written in.
+	SyntaxMetadata = "syntax"
+)
+
+var (
+	categories = []string{DTACategory, InterventionCategory, PrognosisCategory, QualitativeCategory}
+
+	pubmedFieldRe = regexp.MustCompile(`(?i)\[(tiab|ti|ab|mesh|mh|majr|sh|pt|tw|all fields|mesh terms|mesh:noexp|title/abstract|title|text word|publication type|la|dp)(:noexp)?]`)
+	labelRe       = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*[A-Za-z]):(.*)$`)
+)
+
+// cleftarLabels are the labels of the sections that appear in CLEF TAR topic files.
+var cleftarLabels = map[string]bool{
+	"topic":               true,
+	"title":               true,
+	"objective":           true,
+	"objectives":          true,
+	"query":               true,
+	"pids":                true,
+	"type":                true,
+	"category":            true,
+	"type of study":       true,
+	"participants":        true,
+	"index tests":         true,
+	"target condition":    true,
+	"target conditions":   true,
+	"reference standard":  true,
+	"reference standards": true,
+	"dates":               true,
+}
+
+// TopicError is an error raised while loading a single topic.
+type TopicError struct {
+	File  string
+	Topic string
+	Err   error
+}
+
+func (e TopicError) Error() string {
+	if len(e.Topic) > 0 {
+		return fmt.Sprintf("topic %s (%s): %v", e.Topic, e.File, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+// TopicErrors are the errors raised while loading topics. Loading one topic does not
+// prevent the remaining topics from loading.
+type TopicErrors []TopicError
+
+func (e TopicErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return fmt.Sprintf("%d topics could not be loaded: %s", len(e), strings.Join(s, "; "))
+}
+
+// err is the errors as an error, or nil if there are no errors.
+func (e TopicErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// CLEFTARQuerySource loads topics from the CLEF Technology Assisted Review tasks (2017, 2018 and 2019). Topic files
+// in each year are a sequence of labelled sections, e.g.:
+//
+//	Topic: CD009551
+//
+//	Title: Polymerase chain reaction blood tests for the diagnosis of invasive aspergillosis
+//
+//	Objective: ...
+//
+//	Query:
+//	exp Aspergillosis/
+//	...
+//
+//	Pids:
+//	    25815649
+//
+// Topic files may also restrict the publication dates of the documents the query should retrieve, e.g.:
+//
+//	Dates: 19400101 20100114
+//
+// The query may be an Ovid MEDLINE or a PubMed search strategy; the syntax is detected automatically unless specified.
+// Topics that have no query (e.g. protocol-only topics) are given a keyword query of the title. The title, objective,
+// category (DTA, intervention, prognosis, or qualitative), syntax, original query, and any protocol sections
+// (e.g. participants) are available as metadata on each query. The category is read from the topic file, or inferred
+// from the directory the topic is in (as in the 2019 collection).
+type CLEFTARQuerySource struct {
+	syntax   string
+	category string
+}
+
+// CLEFTARSyntax forces the syntax of every query to be parsed as either OvidMedlineSyntax or PubMedSyntax.
+func CLEFTARSyntax(syntax string) func(*CLEFTARQuerySource) {
+	return func(s *CLEFTARQuerySource) {
+		s.syntax = syntax
+	}
+}
+
+// CLEFTARCategory forces the category of every topic.
+func CLEFTARCategory(category string) func(*CLEFTARQuerySource) {
+	return func(s *CLEFTARQuerySource) {
+		s.category = strings.ToLower(category)
+	}
+}
+
+// NewCLEFTARQuerySource creates a new CLEF TAR query source.
+func NewCLEFTARQuerySource(options ...func(*CLEFTARQuerySource)) CLEFTARQuerySource {
+	s := CLEFTARQuerySource{}
+	for _, option := range options {
+		option(&s)
+	}
+	return s
+}
+
+// DetectSyntax determines if a search strategy was written for PubMed or for Ovid MEDLINE.
+func DetectSyntax(query string) string {
+	if pubmedFieldRe.MatchString(query) {
+		return PubMedSyntax
+	}
+	return OvidMedlineSyntax
+}
+
+// inferCategory infers the category of a topic from the directories in its path.
+func inferCategory(file string) string {
+	for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(file)), "/") {
+		dir = strings.ToLower(dir)
+		for _, category := range categories {
+			if dir == category {
+				return category
+			}
+		}
+	}
+	return ""
+}
+
+// parseSections splits a topic file into its labelled sections.
+func parseSections(source []byte) map[string]string {
+	sections := make(map[string]string)
+	label := ""
+	s := bufio.NewScanner(bytes.NewReader(source))
+	s.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		if m := labelRe.FindStringSubmatch(line); m != nil && cleftarLabels[strings.ToLower(m[1])] {
+			label = strings.ToLower(m[1])
+			switch label {
+			case "objectives":
+				label = "objective"
+			case "target conditions":
+				label = "target condition"
+			case "reference standards":
+				label = "reference standard"
+			}
+			sections[label] = strings.TrimSpace(m[2])
+			continue
+		}
+		if len(label) == 0 {
+			continue
+		}
+		if len(sections[label]) > 0 {
+			sections[label] += "\n"
+		}
+		sections[label] += line
+	}
+	for k, v := range sections {
+		sections[k] = strings.TrimSpace(v)
+	}
+	return sections
+}
+
+// compile parses a search strategy into the common query representation. Since the parsers may panic on malformed
+// input, any panic is recovered and returned as an error.
+func compile(query, syntax string) (q cqr.CommonQueryRepresentation, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("could not parse %s query: %v", syntax, r)
+		}
+	}()
+	query = strings.Replace(query, `“`, `"`, -1)
+	query = strings.Replace(query, `”`, `"`, -1)
+	switch syntax {
+	case PubMedSyntax:
+		return transmute.CompilePubmed2Cqr(query)
+	case OvidMedlineSyntax:
+		return transmute.CompileMedline2Cqr(query)
+	}
+	return nil, fmt.Errorf("unknown query syntax %s", syntax)
+}
+
+// LoadSingle loads a single CLEF TAR topic file.
+func (s CLEFTARQuerySource) LoadSingle(file string) (pipeline.Query, error) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return pipeline.Query{}, TopicError{File: file, Err: err}
+	}
+	return s.parse(file, source)
+}
+
+// parse parses a CLEF TAR topic. The name of the file is used to infer the category of the topic.
+func (s CLEFTARQuerySource) parse(file string, source []byte) (pipeline.Query, error) {
+	sections := parseSections(source)
+	topic := sections["topic"]
+	if len(topic) == 0 {
+		return pipeline.Query{}, TopicError{File: file, Err: fmt.Errorf("topic file has no topic")}
+	}
+	title := strings.Join(strings.Fields(sections["title"]), " ")
+
+	var (
+		q      cqr.CommonQueryRepresentation
+		syntax string
+	)
+	if raw := sections["query"]; len(raw) > 0 {
+		syntax = s.syntax
+		if len(syntax) == 0 {
+			syntax = DetectSyntax(raw)
+		}
+		var err error
+		q, err = compile(raw, syntax)
+		if err != nil {
+			return pipeline.Query{}, TopicError{File: file, Topic: topic, Err: err}
+		}
+	} else if len(title) > 0 {
+		q = cqr.NewKeyword(title, fields.TitleAbstract)
+	} else {
+		return pipeline.Query{}, TopicError{File: file, Topic: topic, Err: fmt.Errorf("topic has neither a query nor a title")}
+	}
+
+	category := s.category
+	if len(category) == 0 {
+		category = strings.ToLower(sections["category"])
+	}
+	if len(category) == 0 {
+		category = strings.ToLower(sections["type"])
+	}
+	if len(category) == 0 {
+		category = inferCategory(file)
+	}
+
+	pq := pipeline.NewQuery(topic, topic, q).
+		SetMetadata(pipeline.TitleMetadata, title).
+		SetMetadata(pipeline.ObjectiveMetadata, strings.Join(strings.Fields(sections["objective"]), " "))
+	if len(category) > 0 {
+		pq = pq.SetMetadata(CategoryMetadata, category)
+	}
+	if len(syntax) > 0 {
+		pq = pq.SetMetadata(SyntaxMetadata, syntax).
+			SetMetadata(pipeline.OriginalQueryMetadata, sections["query"])
+	}
+	if dates := strings.Fields(sections["dates"]); len(dates) > 0 {
+		if len(dates) != 2 {
+			return pipeline.Query{}, TopicError{File: file, Topic: topic, Err: fmt.Errorf("dates must be a start and end date")}
+		}
+		d, err := pipeline.ParseDateRestriction(dates[0], dates[1])
+		if err != nil {
+			return pipeline.Query{}, TopicError{File: file, Topic: topic, Err: err}
+		}
+		pq = pq.SetDateRestriction(d)
+	}
+	for label, section := range map[string]string{
+		"type of study":      TypeOfStudySection,
+		"participants":       ParticipantsSection,
+		"index tests":        IndexTestsSection,
+		"target condition":   TargetConditionsSection,
+		"reference standard": ReferenceStandardsSection,
+	} {
+		if v, ok := sections[label]; ok && len(v) > 0 {
+			pq = pq.SetMetadata(pipeline.ProtocolMetadata(section), strings.Join(strings.Fields(v), " "))
+		}
+	}
+	return pq, nil
+}
+
+// Load loads every CLEF TAR topic file at a location (e.g. a directory, which is read recursively). Topics that
+// cannot be loaded do not prevent the remaining topics from loading; the topics that loaded are returned along with
+// TopicErrors.
+func (s CLEFTARQuerySource) Load(directory string) ([]pipeline.Query, error) {
+	return LoadLocation(directory, s.parse)
+}
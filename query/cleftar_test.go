@@ -0,0 +1,112 @@
+package query_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/query"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCLEFTARQuerySource_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "groove_cleftar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		// A 2019 topic, where the category is the directory the topic is in.
+		"DTA/CD008122": `Topic: CD008122
+
+Title: Rapid tests for the
+  diagnosis of malaria
+
+Query:
+malaria[tiab]
+
+Participants: Patients with
+ symptoms of malaria
+
+Dates: 19400101 20100114
+
+Pids:
+    25815649
+`,
+		// A protocol-only topic has no query.
+		"Intervention/CD012345": `Topic: CD012345
+Title: Exercise for osteoarthritis
+Type: Intervention
+`,
+		"no-topic":       "Title: A topic without a topic\n",
+		"duplicate":      "Topic: CD012345\nTitle: Again\n",
+		"invalid-dates":  "Topic: CD000001\nTitle: Invalid dates\nDates: 20100101 19400101\n",
+		"missing-dates":  "Topic: CD000002\nTitle: Missing dates\nDates: 20100101\n",
+		"empty-topic/CD": "Topic: CD000003\n",
+	}
+	for name, content := range files {
+		p := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queries, err := query.NewCLEFTARQuerySource().Load(dir)
+	errs, ok := err.(query.TopicErrors)
+	if !ok || len(errs) != 5 {
+		t.Fatalf("expected five topics not to load, got %v", err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("expected two topics to load, got %v", queries)
+	}
+
+	got := make(map[string]pipeline.Query)
+	for _, q := range queries {
+		got[q.Topic] = q
+	}
+
+	dta := got["CD008122"]
+	if k, ok := dta.Query.(cqr.Keyword); !ok || k.QueryString != "malaria" {
+		t.Errorf("expected the query to be parsed, got %v", dta.Query)
+	}
+	for key, expected := range map[string]string{
+		pipeline.TitleMetadata:         "Rapid tests for the diagnosis of malaria",
+		pipeline.OriginalQueryMetadata: "malaria[tiab]",
+		query.CategoryMetadata:         query.DTACategory,
+		query.SyntaxMetadata:           query.PubMedSyntax,
+	} {
+		if v, _ := dta.GetMetadata(key); v != expected {
+			t.Errorf("expected %s to be %q, got %q", key, expected, v)
+		}
+	}
+	if p := dta.Protocol(query.ParticipantsSection); p != "Patients with symptoms of malaria" {
+		t.Errorf("expected the participants section, got %q", p)
+	}
+	if d, err := dta.DateRestriction(); err != nil || d == nil || d.Start.Year() != 1940 || d.End.Year() != 2010 {
+		t.Errorf("expected a date restriction from 1940 to 2010, got %v (%v)", d, err)
+	}
+
+	intervention := got["CD012345"]
+	if k, ok := intervention.Query.(cqr.Keyword); !ok || k.QueryString != "Exercise for osteoarthritis" {
+		t.Errorf("expected a keyword query of the title, got %v", intervention.Query)
+	}
+	if c, _ := intervention.GetMetadata(query.CategoryMetadata); c != query.InterventionCategory {
+		t.Errorf("expected the intervention category, got %q", c)
+	}
+}
+
+func TestDetectSyntax(t *testing.T) {
+	for q, expected := range map[string]string{
+		"malaria[tiab] AND (diagnosis[mh] OR test*[tw])":  query.PubMedSyntax,
+		"1. exp Malaria/\n2. diagnos*.ti,ab.\n3. 1 and 2": query.OvidMedlineSyntax,
+	} {
+		if s := query.DetectSyntax(q); s != expected {
+			t.Errorf("expected %q to be %s, got %s", q, expected, s)
+		}
+	}
+}
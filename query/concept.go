@@ -0,0 +1,154 @@
+package query
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Concept is a concept (e.g. a UMLS concept) identified in a piece of text.
+type Concept struct {
+	// ID is the identifier of the concept (e.g. a CUI).
+	ID string
+	// Text is the text that was identified as the concept.
+	Text string
+	// Preferred is the preferred term of the concept, if it is known.
+	Preferred string
+	// Score is the similarity of the text to the concept, in the range (0, 1].
+	Score float64
+}
+
+// ConceptExtractor identifies the concepts in a piece of text, in the order they appear.
+type ConceptExtractor interface {
+	Extract(text string) ([]Concept, error)
+}
+
+// ConceptExtractorFunc is an adapter that allows an ordinary function (e.g. one that calls a QuickUMLS server) to be
+// used as a ConceptExtractor.
+type ConceptExtractorFunc func(text string) ([]Concept, error)
+
+// Extract calls f(text).
+func (f ConceptExtractorFunc) Extract(text string) ([]Concept, error) {
+	return f(text)
+}
+
+// dictionaryEntry is a concept in a dictionary.
+type dictionaryEntry struct {
+	id        string
+	preferred string
+}
+
+// DictionaryConceptExtractor identifies concepts using a dictionary of terms, so no external service is required.
+// Text is matched against the dictionary greedily, preferring the longest term at each position. Matching ignores
+// case and punctuation.
+type DictionaryConceptExtractor struct {
+	terms map[string]dictionaryEntry
+	// preferred maps the identifier of a concept to its preferred term.
+	preferred map[string]string
+	// longest is the number of tokens in the longest term in the dictionary.
+	longest int
+}
+
+// conceptTokens splits text into lowercase tokens of letters and digits.
+func conceptTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Add adds a term for a concept to the dictionary. The first term added for a concept is its preferred term.
+func (d *DictionaryConceptExtractor) Add(id, term string) {
+	tokens := conceptTokens(term)
+	if len(tokens) == 0 {
+		return
+	}
+	if d.terms == nil {
+		d.terms = make(map[string]dictionaryEntry)
+		d.preferred = make(map[string]string)
+	}
+	key := strings.Join(tokens, " ")
+	if _, ok := d.terms[key]; ok {
+		return
+	}
+
+	preferred, ok := d.preferred[id]
+	if !ok {
+		preferred = term
+		d.preferred[id] = term
+	}
+	d.terms[key] = dictionaryEntry{id: id, preferred: preferred}
+	if len(tokens) > d.longest {
+		d.longest = len(tokens)
+	}
+}
+
+// Extract identifies the concepts in the dictionary that appear in text. Each concept is identified at most once.
+func (d DictionaryConceptExtractor) Extract(text string) ([]Concept, error) {
+	var (
+		concepts []Concept
+		seen     = make(map[string]bool)
+		tokens   = conceptTokens(text)
+	)
+	for i := 0; i < len(tokens); {
+		n := d.longest
+		if i+n > len(tokens) {
+			n = len(tokens) - i
+		}
+		matched := 0
+		for ; n > 0; n-- {
+			key := strings.Join(tokens[i:i+n], " ")
+			if e, ok := d.terms[key]; ok {
+				if !seen[e.id] {
+					seen[e.id] = true
+					concepts = append(concepts, Concept{ID: e.id, Text: key, Preferred: e.preferred, Score: 1})
+				}
+				matched = n
+				break
+			}
+		}
+		if matched == 0 {
+			matched = 1
+		}
+		i += matched
+	}
+	return concepts, nil
+}
+
+// NewDictionaryConceptExtractor creates a dictionary concept extractor from tab-separated lines in the format:
+//
+//	C0004030	aspergillosis
+//	C0004030	aspergillus infection
+//
+// where the first column is the identifier of the concept, and the second column is a term for the concept. Blank
+// lines and lines starting with # are ignored.
+func NewDictionaryConceptExtractor(r io.Reader) (DictionaryConceptExtractor, error) {
+	var d DictionaryConceptExtractor
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		if len(cols) < 2 {
+			return d, fmt.Errorf("line %d of dictionary has %d columns, expected 2", n, len(cols))
+		}
+		d.Add(strings.TrimSpace(cols[0]), strings.TrimSpace(cols[1]))
+	}
+	return d, s.Err()
+}
+
+// LoadDictionaryConceptExtractor creates a dictionary concept extractor from a file (see NewDictionaryConceptExtractor).
+func LoadDictionaryConceptExtractor(file string) (DictionaryConceptExtractor, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return DictionaryConceptExtractor{}, err
+	}
+	defer f.Close()
+	return NewDictionaryConceptExtractor(f)
+}
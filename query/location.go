@@ -0,0 +1,371 @@
+package query
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/groove/pipeline"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Stdin is the location that refers to standard input.
+const Stdin = "-"
+
+// stdin is where queries are read from when the location is Stdin.
+var stdin io.Reader = os.Stdin
+
+// Document is a single document containing a query (or queries, for JSON Lines) read from a location.
+type Document struct {
+	// Name is the path of the document, or the path of the document within an archive.
+	Name   string
+	Source []byte
+}
+
+// Parser parses a single query from a document. The name is the path of the document (or the topic, for queries
+// read from JSON Lines), from which the topic of the query can be inferred.
+type Parser func(name string, source []byte) (pipeline.Query, error)
+
+// jsonLine is a single query in a JSON Lines file. The query is in the syntax of the source that is loading it.
+type jsonLine struct {
+	Topic    string            `json:"topic"`
+	Name     string            `json:"name"`
+	Query    string            `json:"query"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// inferTopic infers the topic of a query from the name of a document.
+func inferTopic(name string) (string, error) {
+	t := path.Base(filepath.ToSlash(name))
+	if len(t) == 0 || t == "." || t == "/" {
+		return "", fmt.Errorf("query topic cannot be inferred from %q", name)
+	}
+	return t, nil
+}
+
+// hidden determines if any component of a path is hidden (i.e. starts with a dot), or is an
+// artifact of an archive (e.g. __MACOSX).
+func hidden(name string) bool {
+	for _, c := range strings.Split(filepath.ToSlash(name), "/") {
+		if (strings.HasPrefix(c, ".") && c != "." && c != "..") || c == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+func isArchive(name string) bool {
+	n := strings.ToLower(name)
+	return strings.HasSuffix(n, ".zip") || strings.HasSuffix(n, ".tar") || strings.HasSuffix(n, ".tar.gz") || strings.HasSuffix(n, ".tgz")
+}
+
+func isJSONLines(doc Document) bool {
+	n := strings.ToLower(doc.Name)
+	if strings.HasSuffix(n, ".jsonl") || strings.HasSuffix(n, ".ndjson") {
+		return true
+	}
+	// Queries from standard input are JSON Lines when they look like JSON.
+	return doc.Name == Stdin && bytes.HasPrefix(bytes.TrimSpace(doc.Source), []byte("{"))
+}
+
+// readZip reads every document in a zip archive. Documents in the archive that cannot be read are returned as
+// TopicErrors, along with the documents that could be read.
+func readZip(file string) ([]Document, error) {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var (
+		docs []Document
+		errs TopicErrors
+	)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || hidden(f.Name) {
+			continue
+		}
+		b, err := readZipFile(f)
+		if err != nil {
+			errs = append(errs, TopicError{File: path.Join(file, f.Name), Err: err})
+			continue
+		}
+		docs = append(docs, Document{Name: f.Name, Source: b})
+	}
+	return docs, errs.err()
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// readTar reads every document in a (optionally gzipped) tar archive. A tar archive cannot be read past a corrupt
+// entry, so the documents before it are returned along with a TopicError.
+func readTar(file string) ([]Document, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	n := strings.ToLower(file)
+	if strings.HasSuffix(n, ".gz") || strings.HasSuffix(n, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var docs []Document
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return docs, TopicErrors{{File: file, Err: err}}
+		}
+		if h.Typeflag != tar.TypeReg || hidden(h.Name) {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return docs, TopicErrors{{File: path.Join(file, h.Name), Err: err}}
+		}
+		docs = append(docs, Document{Name: h.Name, Source: b})
+	}
+	return docs, nil
+}
+
+// readPath reads the documents in a file, archive, or directory (recursively). Files that cannot be read are
+// returned as TopicErrors, along with the documents that could be read.
+func readPath(p string) ([]Document, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		var docs []Document
+		if isArchive(p) {
+			if strings.HasSuffix(strings.ToLower(p), ".zip") {
+				docs, err = readZip(p)
+			} else {
+				docs, err = readTar(p)
+			}
+		} else {
+			var b []byte
+			b, err = ioutil.ReadFile(p)
+			if err == nil {
+				docs = []Document{{Name: p, Source: b}}
+			}
+		}
+		if _, ok := err.(TopicErrors); err != nil && !ok {
+			err = TopicErrors{{File: p, Err: err}}
+		}
+		return docs, err
+	}
+
+	var (
+		docs []Document
+		errs TopicErrors
+	)
+	err = filepath.Walk(p, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			errs = append(errs, TopicError{File: name, Err: err})
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if name != p && hidden(info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		d, err := readPath(name)
+		if e, ok := err.(TopicErrors); ok {
+			errs = append(errs, e...)
+		} else if err != nil {
+			return err
+		}
+		docs = append(docs, d...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docs, errs.err()
+}
+
+// ReadLocation reads every document at a location. A location may be:
+//
+//   - a directory, which is read recursively;
+//   - a single file;
+//   - a zip or tar (optionally gzipped) archive;
+//   - a glob pattern (e.g. topics/*.txt);
+//   - Stdin ("-"), which is read as a single document.
+//
+// Hidden files and directories are skipped. Documents are sorted by name. Files that cannot be read do not prevent
+// the remaining files from being read; the documents that could be read are returned along with TopicErrors.
+func ReadLocation(location string) ([]Document, error) {
+	if location == Stdin {
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		return []Document{{Name: Stdin, Source: b}}, nil
+	}
+
+	var paths []string
+	if _, err := os.Stat(location); err != nil && strings.ContainsAny(location, "*?[") {
+		paths, err = filepath.Glob(location)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no files match %s", location)
+		}
+	} else {
+		paths = []string{location}
+	}
+
+	var (
+		docs []Document
+		errs TopicErrors
+	)
+	for _, p := range paths {
+		if p != location && hidden(filepath.Base(p)) {
+			continue
+		}
+		d, err := readPath(p)
+		if e, ok := err.(TopicErrors); ok {
+			errs = append(errs, e...)
+		} else if err != nil {
+			return nil, err
+		}
+		docs = append(docs, d...)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Name < docs[j].Name
+	})
+	return docs, errs.err()
+}
+
+// LoadLocation loads the queries at a location (see ReadLocation) using a parser. Documents in JSON Lines
+// (.jsonl, or standard input that looks like JSON) contain one query per line, in the format:
+//
+//	{"topic": "CD008122", "name": "original", "query": "...", "metadata": {"title": "..."}}
+//
+// where the query is in the syntax understood by the parser. A document that cannot be read or parsed, a query with
+// an invalid date restriction, or a query with the same topic and name as one already loaded, does not prevent the
+// remaining queries from loading; the queries that loaded are returned along with TopicErrors.
+func LoadLocation(location string, parse Parser) ([]pipeline.Query, error) {
+	docs, err := ReadLocation(location)
+	errs, ok := err.(TopicErrors)
+	if err != nil && !ok {
+		return nil, err
+	}
+
+	var (
+		queries []pipeline.Query
+		seen    = make(map[[2]string]string)
+	)
+	fail := func(file string, err error) {
+		if e, ok := err.(TopicError); ok {
+			errs = append(errs, e)
+			return
+		}
+		errs = append(errs, TopicError{File: file, Err: err})
+	}
+	add := func(file string, q pipeline.Query) {
+		if _, err := q.DateRestriction(); err != nil {
+			fail(file, err)
+			return
+		}
+		// Several queries may be loaded for a topic, as long as they have different names.
+		key := [2]string{q.Topic, q.Name}
+		if other, ok := seen[key]; ok {
+			errs = append(errs, TopicError{File: file, Topic: q.Topic, Err: fmt.Errorf("duplicate query %s, already loaded from %s", q.Name, other)})
+			return
+		}
+		seen[key] = file
+		queries = append(queries, q)
+	}
+
+	for _, doc := range docs {
+		if !isJSONLines(doc) {
+			q, err := parse(doc.Name, doc.Source)
+			if err != nil {
+				fail(doc.Name, err)
+				continue
+			}
+			add(doc.Name, q)
+			continue
+		}
+
+		s := bufio.NewScanner(bytes.NewReader(doc.Source))
+		s.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+		n := 0
+		for s.Scan() {
+			n++
+			line := bytes.TrimSpace(s.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			file := fmt.Sprintf("%s:%d", doc.Name, n)
+			var l jsonLine
+			err := json.Unmarshal(line, &l)
+			if err != nil {
+				fail(file, err)
+				continue
+			}
+			if len(l.Topic) == 0 {
+				fail(file, fmt.Errorf("query has no topic"))
+				continue
+			}
+			q, err := parse(l.Topic, []byte(l.Query))
+			if err != nil {
+				fail(file, err)
+				continue
+			}
+			if len(l.Name) > 0 {
+				q.Name = l.Name
+			}
+			for k, v := range l.Metadata {
+				q = q.SetMetadata(k, v)
+			}
+			add(file, q)
+		}
+		if err := s.Err(); err != nil {
+			fail(doc.Name, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return queries, errs
+	}
+	return queries, nil
+}
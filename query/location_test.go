@@ -0,0 +1,87 @@
+package query_test
+
+import (
+	"archive/zip"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/query"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLoadLocation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "groove_location")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"1":       "cancer",
+		"sub/2":   "tumour",
+		".hidden": "ignored",
+		".git/3":  "ignored",
+		"queries.jsonl": `{"topic": "4", "query": "neoplasm", "metadata": {"title": "Neoplasms"}}
+{"topic": "4", "name": "variant", "query": "tumor"}
+{"topic": "1", "query": "duplicate"}
+{"query": "no topic"}`,
+		"broken.zip": "not an archive",
+	}
+	for name, content := range files {
+		p := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queries, err := query.NewKeywordQuerySource().Load(dir)
+	errs, ok := err.(query.TopicErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expected an unreadable archive error, a duplicate query error and a missing topic error, got %v", err)
+	}
+	if errs[0].File != path.Join(dir, "broken.zip") {
+		t.Errorf("expected the unreadable archive to be reported first, got %v", errs[0])
+	}
+
+	got := make(map[string]string)
+	for _, q := range queries {
+		got[q.Topic+"/"+q.Name] = q.Query.(cqr.Keyword).QueryString
+	}
+	if len(got) != 4 || got["1/1"] != "cancer" || got["2/2"] != "tumour" || got["4/4"] != "neoplasm" || got["4/variant"] != "tumor" {
+		t.Errorf("unexpected queries %v", queries)
+	}
+	for _, q := range queries {
+		if q.Topic == "4" && q.Name == "4" && q.Title() != "Neoplasms" {
+			t.Errorf("expected metadata from JSON Lines, got %v", q.Metadata)
+		}
+	}
+
+	// The same queries can be loaded from an archive.
+	archive := path.Join(dir, "queries.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for _, name := range []string{"topics/1", "topics/2"} {
+		zf, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = zf.Write([]byte(files["1"]))
+	}
+	_ = w.Close()
+	_ = f.Close()
+
+	queries, err = query.NewKeywordQuerySource().Load(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 || queries[0].Topic != "1" || queries[1].Topic != "2" {
+		t.Errorf("unexpected queries from archive %v", queries)
+	}
+}
@@ -0,0 +1,597 @@
+package query
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/transmute/fields"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ovidFields maps Ovid MEDLINE and Embase field codes to fields. Emtree headings in Embase (.de., .sh.)
+// are mapped to MeSH headings, as there is no separate field for them.
+var ovidFields = map[string]string{
+	"ti": fields.Title,
+	"ab": fields.Abstract,
+	"tw": fields.TextWord,
+	"kw": fields.TextWord,
+	"kf": fields.TextWord,
+	"ot": fields.TextWord,
+	"mp": fields.AllFields,
+	"af": fields.AllFields,
+	"sh": fields.MeshHeadings,
+	"hw": fields.MeshHeadings,
+	"de": fields.MeshHeadings,
+	"fs": fields.FloatingMeshHeadings,
+	"pt": fields.PublicationType,
+}
+
+// ovidDatabases matches the codes of Ovid databases that the use command restricts a line to (e.g. use prmz), so
+// that lines which merely end in the word use (e.g. substance use disorders) are not mistaken for the command.
+const ovidDatabases = `(?:amed|cctr|cmed|coch|dare|emcr|emczd|emed|emef|emefd|emez|emezd|emic|emcsd|esoc|medall|mesx|` +
+	`mesz|oemezd|ovft|ppez|prem|prmz|psyb|psyc|psyh|psyi)\b`
+
+var (
+	ovidNumberedRe    = regexp.MustCompile(`^(\s*(\d+)\s*[.)]?\s+)(\S.*)$`)
+	ovidCombineRe     = regexp.MustCompile(`(?i)^(or|and)/\s*(\d+(?:\s*-\s*\d+)?(?:\s*,\s*\d+(?:\s*-\s*\d+)?)*)$`)
+	ovidHitsRe        = regexp.MustCompile(`\s{2,}\(\d[\d,]*\)\s*$`)
+	ovidUnsupportedRe = regexp.MustCompile(`(?i)^(limit|remove duplicates|from)\b|\buse\s+` + ovidDatabases + `(?:\s*,\s*` + ovidDatabases + `)*\s*$`)
+	ovidFieldSuffixRe = regexp.MustCompile(`^\.([A-Za-z]{2}(?:,[A-Za-z]{2})*)(?:\.|$)`)
+	ovidSubheadingRe  = regexp.MustCompile(`^[A-Za-z]{2}(?:,[A-Za-z]{2})*`)
+	ovidAdjRe         = regexp.MustCompile(`(?i)^adj(\d*)$`)
+	ovidTruncationRe  = regexp.MustCompile(`\$\d*`)
+)
+
+// OvidSyntaxError is an error in an Ovid search strategy. Line is the line of the strategy text the error
+// occurred on, and Column is the position in that line (both start at one).
+type OvidSyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e OvidSyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+type ovidTokenType int
+
+const (
+	ovidWord ovidTokenType = iota
+	ovidPhrase
+	ovidNumber
+	ovidLParen
+	ovidRParen
+	ovidAnd
+	ovidOr
+	ovidNot
+	ovidAdj
+	ovidFieldSuffix
+	ovidHeading
+	ovidExp
+	ovidMajor
+)
+
+type ovidToken struct {
+	typ    ovidTokenType
+	text   string
+	column int
+}
+
+// lexOvid splits a line of an Ovid search strategy into tokens. The offset is the
+// column the line starts at, so that tokens can be reported in the original line.
+func lexOvid(line []rune, offset int) []ovidToken {
+	var tokens []ovidToken
+	i := 0
+	for i < len(line) {
+		r := line[i]
+		col := offset + i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, ovidToken{typ: ovidLParen, text: "(", column: col})
+			i++
+		case r == ')':
+			tokens = append(tokens, ovidToken{typ: ovidRParen, text: ")", column: col})
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(line) && line[j] != '"' {
+				j++
+			}
+			tokens = append(tokens, ovidToken{typ: ovidPhrase, text: string(line[i+1 : j]), column: col})
+			i = j + 1
+		case r == '/':
+			// A subject heading, optionally followed by subheadings (e.g. Neoplasms/di,su).
+			sub := ovidSubheadingRe.FindString(string(line[i+1:]))
+			tokens = append(tokens, ovidToken{typ: ovidHeading, text: sub, column: col})
+			i += 1 + len([]rune(sub))
+		case r == '.' && ovidFieldSuffixRe.MatchString(string(line[i:])):
+			m := ovidFieldSuffixRe.FindStringSubmatch(string(line[i:]))
+			tokens = append(tokens, ovidToken{typ: ovidFieldSuffix, text: m[1], column: col})
+			i += len([]rune(m[0]))
+		case r == '*' && i+1 < len(line) && unicode.IsLetter(line[i+1]):
+			tokens = append(tokens, ovidToken{typ: ovidMajor, text: "*", column: col})
+			i++
+		default:
+			j := i
+			for j < len(line) {
+				c := line[j]
+				if unicode.IsSpace(c) || c == '(' || c == ')' || c == '"' || c == '/' {
+					break
+				}
+				if c == '.' && ovidFieldSuffixRe.MatchString(string(line[j:])) {
+					break
+				}
+				j++
+			}
+			word := string(line[i:j])
+			t := ovidToken{typ: ovidWord, text: word, column: col}
+			switch lower := strings.ToLower(word); {
+			case lower == "and":
+				t.typ = ovidAnd
+			case lower == "or":
+				t.typ = ovidOr
+			case lower == "not":
+				t.typ = ovidNot
+			case lower == "exp":
+				t.typ = ovidExp
+			case ovidAdjRe.MatchString(lower):
+				t.typ = ovidAdj
+				if n := ovidAdjRe.FindStringSubmatch(lower)[1]; len(n) > 0 {
+					t.text = "adj" + n
+				} else {
+					t.text = "adj1"
+				}
+			case isNumber(word):
+				t.typ = ovidNumber
+			}
+			tokens = append(tokens, t)
+			i = j
+		}
+	}
+	return tokens
+}
+
+func isNumber(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+// ovidParser parses a single line of an Ovid search strategy. The precedence of operators
+// follows Ovid: adjacency binds the tightest, followed by and, not, and finally or.
+type ovidParser struct {
+	tokens []ovidToken
+	pos    int
+	line   int
+	column int
+	lines  map[int]cqr.CommonQueryRepresentation
+}
+
+func (p *ovidParser) errorf(column int, format string, args ...interface{}) error {
+	return OvidSyntaxError{Line: p.line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *ovidParser) peek() (ovidToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return ovidToken{}, false
+}
+
+func (p *ovidParser) next(typ ovidTokenType) bool {
+	t, ok := p.peek()
+	return ok && t.typ == typ
+}
+
+// binary parses a sequence of operands separated by an operator.
+func (p *ovidParser) binary(typ ovidTokenType, operator string, operand func() (cqr.CommonQueryRepresentation, error)) (cqr.CommonQueryRepresentation, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	children := []cqr.CommonQueryRepresentation{left}
+	for p.next(typ) {
+		p.pos++
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	if len(children) == 1 {
+		return left, nil
+	}
+	return cqr.NewBooleanQuery(operator, children), nil
+}
+
+func (p *ovidParser) or() (cqr.CommonQueryRepresentation, error) {
+	return p.binary(ovidOr, cqr.OR, p.not)
+}
+
+func (p *ovidParser) not() (cqr.CommonQueryRepresentation, error) {
+	return p.binary(ovidNot, cqr.NOT, p.and)
+}
+
+func (p *ovidParser) and() (cqr.CommonQueryRepresentation, error) {
+	return p.binary(ovidAnd, cqr.AND, p.adj)
+}
+
+func (p *ovidParser) adj() (cqr.CommonQueryRepresentation, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for p.next(ovidAdj) {
+		operator := p.tokens[p.pos].text
+		p.pos++
+		right, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		left = cqr.NewBooleanQuery(operator, []cqr.CommonQueryRepresentation{left, right})
+	}
+	return left, nil
+}
+
+// fieldSuffix parses an optional field suffix (e.g. .ti,ab.) following a term or a group.
+func (p *ovidParser) fieldSuffix() ([]string, error) {
+	t, ok := p.peek()
+	if !ok || t.typ != ovidFieldSuffix {
+		return nil, nil
+	}
+	p.pos++
+	var (
+		f     []string
+		seen  = make(map[string]bool)
+		title bool
+		abs   bool
+	)
+	for _, code := range strings.Split(strings.ToLower(t.text), ",") {
+		field, ok := ovidFields[code]
+		if !ok {
+			return nil, p.errorf(t.column, "unsupported field code .%s.", code)
+		}
+		switch field {
+		case fields.Title:
+			title = true
+		case fields.Abstract:
+			abs = true
+		}
+		if !seen[field] {
+			seen[field] = true
+			f = append(f, field)
+		}
+	}
+	// Searching both the title and abstract is the same as searching the title/abstract field.
+	if title && abs {
+		var c []string
+		for _, field := range f {
+			switch field {
+			case fields.Title:
+				c = append(c, fields.TitleAbstract)
+			case fields.Abstract:
+			default:
+				c = append(c, field)
+			}
+		}
+		f = c
+	}
+	return f, nil
+}
+
+func (p *ovidParser) primary() (cqr.CommonQueryRepresentation, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, p.errorf(p.column, "unexpected end of line")
+	}
+
+	switch t.typ {
+	case ovidLParen:
+		p.pos++
+		q, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.next(ovidRParen) {
+			return nil, p.errorf(t.column, "unbalanced parenthesis")
+		}
+		p.pos++
+		f, err := p.fieldSuffix()
+		if err != nil {
+			return nil, err
+		}
+		if len(f) > 0 {
+			q = applyOvidFields(q, f)
+		}
+		return q, nil
+	case ovidNumber:
+		// A number on its own refers to a previous line of the strategy.
+		if p.pos+1 == len(p.tokens) || isOvidOperator(p.tokens[p.pos+1].typ) || p.tokens[p.pos+1].typ == ovidRParen {
+			p.pos++
+			n, _ := strconv.Atoi(t.text)
+			q, ok := p.lines[n]
+			if !ok {
+				return nil, p.errorf(t.column, "line %d is referenced before it is defined", n)
+			}
+			return q, nil
+		}
+	}
+
+	var exp, major bool
+	if p.next(ovidExp) {
+		exp = true
+		p.pos++
+	}
+	if p.next(ovidMajor) {
+		major = true
+		p.pos++
+	}
+
+	var (
+		words  []string
+		phrase bool
+		start  = t.column
+	)
+	for {
+		w, ok := p.peek()
+		if !ok || (w.typ != ovidWord && w.typ != ovidNumber && w.typ != ovidPhrase) {
+			break
+		}
+		if w.typ == ovidPhrase {
+			phrase = true
+		}
+		words = append(words, w.text)
+		p.pos++
+	}
+	if len(words) == 0 {
+		if w, ok := p.peek(); ok {
+			return nil, p.errorf(w.column, "unexpected %q", w.text)
+		}
+		return nil, p.errorf(start, "expected a term")
+	}
+	text := strings.Join(words, " ")
+
+	if w, ok := p.peek(); ok && w.typ == ovidHeading {
+		p.pos++
+		if len(w.text) > 0 {
+			return nil, p.errorf(w.column, "unsupported subheading qualifier /%s", w.text)
+		}
+		field := fields.MeshHeadings
+		if major {
+			field = fields.MeSHMajorTopic
+		}
+		return cqr.NewKeyword(text, field).SetOption(cqr.ExplodedString, exp), nil
+	}
+	if exp || major {
+		return nil, p.errorf(start, "expected / after subject heading %q", text)
+	}
+
+	if phrase {
+		text = fmt.Sprintf(`"%s"`, text)
+	}
+	f, err := p.fieldSuffix()
+	if err != nil {
+		return nil, err
+	}
+	return ovidKeyword(text, f...), nil
+}
+
+func isOvidOperator(typ ovidTokenType) bool {
+	return typ == ovidAnd || typ == ovidOr || typ == ovidNot
+}
+
+// ovidKeyword creates a keyword, converting Ovid truncation ($ and $n) to *.
+func ovidKeyword(text string, f ...string) cqr.CommonQueryRepresentation {
+	text = ovidTruncationRe.ReplaceAllString(text, "*")
+	kw := cqr.NewKeyword(text, f...)
+	if strings.ContainsAny(text, "*?#") {
+		return kw.SetOption("truncated", true)
+	}
+	return kw
+}
+
+// applyOvidFields sets the fields of every keyword that does not already have fields.
+func applyOvidFields(q cqr.CommonQueryRepresentation, f []string) cqr.CommonQueryRepresentation {
+	switch x := q.(type) {
+	case cqr.Keyword:
+		if len(x.Fields) == 0 {
+			x.Fields = f
+		}
+		return x
+	case cqr.BooleanQuery:
+		children := make([]cqr.CommonQueryRepresentation, len(x.Children))
+		for i, child := range x.Children {
+			children[i] = applyOvidFields(child, f)
+		}
+		x.Children = children
+		return x
+	}
+	return q
+}
+
+// ovidLine is a single non-empty line of a search strategy.
+type ovidLine struct {
+	line   int
+	number int
+	text   string
+	column int
+}
+
+// ovidLines splits a search strategy into lines. Strategies may be numbered (e.g. `1. exp Neoplasms/`),
+// as exported from Ovid (e.g. `1     exp Neoplasms/     (12345)`), or unnumbered, where each line
+// is numbered implicitly.
+func ovidLines(strategy string) ([]ovidLine, error) {
+	var lines []ovidLine
+	s := bufio.NewScanner(strings.NewReader(strategy))
+	s.Buffer(make([]byte, 1024*1024), 1024*1024)
+	n := 0
+	for s.Scan() {
+		n++
+		text := strings.TrimRight(s.Text(), " \t\r")
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+		lines = append(lines, ovidLine{line: n, text: text})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	// The strategy is only numbered when every line is numbered consecutively from one.
+	numbered := len(lines) > 0
+	for i, l := range lines {
+		m := ovidNumberedRe.FindStringSubmatch(l.text)
+		if m == nil || m[2] != strconv.Itoa(i+1) {
+			numbered = false
+			break
+		}
+	}
+
+	for i, l := range lines {
+		lines[i].number = i + 1
+		if numbered {
+			m := ovidNumberedRe.FindStringSubmatch(l.text)
+			lines[i].column = len([]rune(m[1]))
+			lines[i].text = ovidHitsRe.ReplaceAllString(m[3], "")
+		} else {
+			trimmed := strings.TrimLeftFunc(l.text, unicode.IsSpace)
+			lines[i].column = len([]rune(l.text)) - len([]rune(trimmed))
+			lines[i].text = trimmed
+		}
+	}
+	return lines, nil
+}
+
+// ParseOvid parses an Ovid MEDLINE or Embase line-numbered search strategy, e.g.:
+//
+//  1. exp Neoplasms/
+//  2. (cancer or tumo?r$).ti,ab.
+//  3. (breast adj3 carcinoma).tw.
+//  4. or/1-3
+//
+// Lines that refer to previous lines (e.g. `1 or 2`, `or/1-4`) are resolved into a single query, which is
+// the query of the last line. Field codes are mapped to fields, adjacency (adjN) is mapped to an adjN operator,
+// and terms without a field code search all fields (as .mp. does in Ovid). Constructs that cannot be represented
+// (e.g. limit, subheading qualifiers, unknown field codes) result in an OvidSyntaxError.
+func ParseOvid(strategy string) (cqr.CommonQueryRepresentation, error) {
+	strategy = strings.NewReplacer(`“`, `"`, `”`, `"`, `‘`, `'`, `’`, `'`).Replace(strategy)
+	lines, err := ovidLines(strategy)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("search strategy is empty")
+	}
+
+	parsed := make(map[int]cqr.CommonQueryRepresentation, len(lines))
+	var q cqr.CommonQueryRepresentation
+	for _, l := range lines {
+		p := &ovidParser{line: l.line, column: l.column + 1, lines: parsed}
+
+		if m := ovidCombineRe.FindStringSubmatch(l.text); m != nil {
+			q, err = p.combine(m[1], m[2])
+			if err != nil {
+				return nil, err
+			}
+			parsed[l.number] = q
+			continue
+		}
+		if loc := ovidUnsupportedRe.FindStringIndex(l.text); loc != nil {
+			return nil, p.errorf(l.column+len([]rune(l.text[:loc[0]]))+1, "unsupported command %q", strings.TrimSpace(l.text[loc[0]:loc[1]]))
+		}
+
+		p.tokens = lexOvid([]rune(l.text), l.column)
+		q, err = p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); ok {
+			if t.typ == ovidRParen {
+				return nil, p.errorf(t.column, "unbalanced parenthesis")
+			}
+			return nil, p.errorf(t.column, "unexpected %q", t.text)
+		}
+		parsed[l.number] = applyOvidFields(q, []string{fields.AllFields})
+		q = parsed[l.number]
+	}
+	return q, nil
+}
+
+// combine resolves a line that combines previous lines (e.g. or/1-4, and/1,3).
+func (p *ovidParser) combine(operator, refs string) (cqr.CommonQueryRepresentation, error) {
+	var children []cqr.CommonQueryRepresentation
+	for _, ref := range strings.Split(refs, ",") {
+		bounds := strings.Split(ref, "-")
+		from, _ := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		to := from
+		if len(bounds) == 2 {
+			to, _ = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		}
+		if to < from {
+			return nil, p.errorf(p.column, "invalid range of lines %s", strings.TrimSpace(ref))
+		}
+		for n := from; n <= to; n++ {
+			q, ok := p.lines[n]
+			if !ok {
+				return nil, p.errorf(p.column, "line %d is referenced before it is defined", n)
+			}
+			children = append(children, q)
+		}
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	op := cqr.OR
+	if strings.ToLower(operator) == "and" {
+		op = cqr.AND
+	}
+	return cqr.NewBooleanQuery(op, children), nil
+}
+
+// OvidQuerySource loads Ovid MEDLINE and Embase search strategies. The topic of each query is its file name.
+type OvidQuerySource struct{}
+
+// NewOvidQuerySource creates a new Ovid query source.
+func NewOvidQuerySource() OvidQuerySource {
+	return OvidQuerySource{}
+}
+
+// LoadSingle loads a single Ovid search strategy.
+func (s OvidQuerySource) LoadSingle(file string) (pipeline.Query, error) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return pipeline.Query{}, err
+	}
+	return s.parse(file, source)
+}
+
+// parse parses an Ovid search strategy. The topic is the name of the file.
+func (OvidQuerySource) parse(name string, source []byte) (pipeline.Query, error) {
+	t, err := inferTopic(name)
+	if err != nil {
+		return pipeline.Query{}, err
+	}
+	q, err := ParseOvid(string(source))
+	if err != nil {
+		return pipeline.Query{}, TopicError{File: name, Topic: t, Err: err}
+	}
+	return pipeline.NewQuery(t, t, q).
+		SetMetadata(pipeline.OriginalQueryMetadata, string(source)), nil
+}
+
+// Load loads every Ovid search strategy at a location. Strategies that cannot be parsed do not prevent the
+// remaining strategies from loading; the queries that loaded are returned along with TopicErrors.
+func (s OvidQuerySource) Load(directory string) ([]pipeline.Query, error) {
+	return LoadLocation(directory, s.parse)
+}
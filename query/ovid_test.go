@@ -0,0 +1,87 @@
+package query_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/query"
+	"github.com/hscells/transmute/fields"
+	"testing"
+)
+
+func TestParseOvid(t *testing.T) {
+	strategy := `1. exp Neoplasms/
+2. (cancer or tumo?r$).ti,ab.
+3. (breast adj3 carcinoma).tw.
+4. or/1-3
+5. animals/ not humans/
+6. 4 not 5`
+
+	q, err := query.ParseOvid(strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bq, ok := q.(cqr.BooleanQuery)
+	if !ok || bq.Operator != cqr.NOT || len(bq.Children) != 2 {
+		t.Fatalf("expected a not clause with two children, got %v", q)
+	}
+	or, ok := bq.Children[0].(cqr.BooleanQuery)
+	if !ok || or.Operator != cqr.OR || len(or.Children) != 3 {
+		t.Fatalf("expected or/1-3 to resolve to an or clause with three children, got %v", bq.Children[0])
+	}
+
+	heading := or.Children[0].(cqr.Keyword)
+	if heading.QueryString != "Neoplasms" || heading.Fields[0] != fields.MeshHeadings || heading.Options[cqr.ExplodedString] != true {
+		t.Errorf("expected exploded MeSH heading, got %v", heading)
+	}
+
+	tumour := or.Children[1].(cqr.BooleanQuery).Children[1].(cqr.Keyword)
+	if tumour.QueryString != "tumo?r*" || tumour.Fields[0] != fields.TitleAbstract || tumour.Options["truncated"] != true {
+		t.Errorf("expected truncated title/abstract keyword, got %v", tumour)
+	}
+
+	adj := or.Children[2].(cqr.BooleanQuery)
+	if adj.Operator != "adj3" || adj.Children[0].(cqr.Keyword).Fields[0] != fields.TextWord {
+		t.Errorf("expected adj3 clause in text words, got %v", adj)
+	}
+}
+
+func TestParseOvidUse(t *testing.T) {
+	// Lines that end in the word use are not the use command.
+	for _, strategy := range []string{
+		"1. drug use x",
+		"1. substance use disorders",
+		"1. (cannabis adj2 use).tw.",
+	} {
+		if _, err := query.ParseOvid(strategy); err != nil {
+			t.Errorf("expected %q to parse, got %v", strategy, err)
+		}
+	}
+}
+
+func TestParseOvidErrors(t *testing.T) {
+	tests := []struct {
+		strategy string
+		line     int
+		column   int
+	}{
+		{"1. cancer.ti.\n2. limit 1 to english", 2, 4},
+		{"1. cancer.yr.", 1, 10},
+		{"1. Neoplasms/di", 1, 13},
+		{"1. (cancer or tumour.ti.", 1, 4},
+		{"1. cancer.ti.\n2. or/1-3", 2, 4},
+		{"1. exp Neoplasms/\n2. 1 use prmz", 2, 6},
+		{"1. exp Neoplasms/\n2. 1 use ppez, emez", 2, 6},
+	}
+
+	for _, test := range tests {
+		_, err := query.ParseOvid(test.strategy)
+		e, ok := err.(query.OvidSyntaxError)
+		if !ok {
+			t.Errorf("expected syntax error for %q, got %v", test.strategy, err)
+			continue
+		}
+		if e.Line != test.line || e.Column != test.column {
+			t.Errorf("expected error at %d:%d for %q, got %v", test.line, test.column, test.strategy, e)
+		}
+	}
+}
@@ -1,133 +1,387 @@
 package query
 
 import (
+	"bytes"
+	"encoding/json"
 	"encoding/xml"
+	"fmt"
+	"github.com/hscells/cqr"
 	"github.com/hscells/groove/pipeline"
 	"github.com/hscells/groove/stats"
-	"io/ioutil"
+	"github.com/hscells/transmute/fields"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
 )
 
-// ProtocolQuerySource loads systematic review protocols from XML files that
-// follow the structure of:
+// Sections of a systematic review protocol. The text of each section of a protocol is available in the metadata of
+// a query under pipeline.ProtocolMetadata(section).
+const (
+	TypeOfStudySection        = "type_of_study"
+	ParticipantsSection       = "participants"
+	IndexTestsSection         = "index_tests"
+	TargetConditionsSection   = "target_conditions"
+	ReferenceStandardsSection = "reference_standards"
+	InterventionsSection      = "interventions"
+	ComparatorsSection        = "comparators"
+	OutcomesSection           = "outcomes"
+	ContextSection            = "context"
+)
+
+// EntityOption is the option on keywords generated from a concept that contains the identifier of the concept. It
+// is the same option used by the formulation package.
+const EntityOption = "entity"
+
+// Protocol is a systematic review protocol. A protocol can be read from XML, JSON, or PROSPERO-like text (see
+// ParseProtocol).
+type Protocol struct {
+	Topic              string `json:"topic,omitempty" xml:"topic"`
+	Title              string `json:"title,omitempty" xml:"title"`
+	Objective          string `json:"objective,omitempty" xml:"objective"`
+	TypeOfStudy        string `json:"type_of_study,omitempty" xml:"type_of_study"`
+	Participants       string `json:"participants,omitempty" xml:"participants"`
+	IndexTests         string `json:"index_tests,omitempty" xml:"index_tests"`
+	TargetConditions   string `json:"target_conditions,omitempty" xml:"target_conditions"`
+	ReferenceStandards string `json:"reference_standards,omitempty" xml:"reference_standards"`
+	Interventions      string `json:"interventions,omitempty" xml:"interventions"`
+	Comparators        string `json:"comparators,omitempty" xml:"comparators"`
+	Outcomes           string `json:"outcomes,omitempty" xml:"outcomes"`
+	Context            string `json:"context,omitempty" xml:"context"`
+}
+
+// Sections returns the non-empty sections of a protocol (other than the topic, title, and objective), keyed by
+// section name.
+func (p Protocol) Sections() map[string]string {
+	s := make(map[string]string)
+	for name, text := range map[string]string{
+		TypeOfStudySection:        p.TypeOfStudy,
+		ParticipantsSection:       p.Participants,
+		IndexTestsSection:         p.IndexTests,
+		TargetConditionsSection:   p.TargetConditions,
+		ReferenceStandardsSection: p.ReferenceStandards,
+		InterventionsSection:      p.Interventions,
+		ComparatorsSection:        p.Comparators,
+		OutcomesSection:           p.Outcomes,
+		ContextSection:            p.Context,
+	} {
+		if text = strings.Join(strings.Fields(text), " "); len(text) > 0 {
+			s[name] = text
+		}
+	}
+	return s
+}
+
+// ParseProtocolXML parses a protocol in XML, in the format:
 //
-// ```
-//<?xml version='1.0' encoding='UTF-8'?>
-//<root>
-//<objective>
-//Our primary objective was to assess the diagnostic accuracy of galactomannan detection in serum for the diagnosis of invasive aspergillosis in immunocompromised patients, at different cut-off values for test positivity.
-//Secondary objectives
-//We aimed to study several possible sources of heterogeneity: subgroups of patients, different interpretations of the EORTC/MSG criteria as the reference standard and study design features.</objective>
-//<type_of_study>
-//Studies that assessed the diagnostic accuracy of galactomannan detection by the Platelia© sandwich ELISA test, with either prospective or retrospective data collection, were eligible. The galactomannan ELISA could be assessed alone or in comparison to other tests.</type_of_study>
-//<participants>
-//Studies had to include patients with neutropenia or patients whose neutrophils are functionally compromised. We included studies with the following patient groups:
-//patients with haematological malignancies, receiving haematopoietic stem cell transplants, chemotherapeutics or immunosuppressive drugs;
-//solid organ transplant recipients and other patients who are receiving immunosuppressive drugs for a prolonged time;
-//patients with cancer who are receiving chemotherapeutics;
-//patients with a medical condition compromising the immune system, such as HIV/AIDS and chronic granulomatous disease (CGD, an inherited abnormality of the neutrophils).</participants>
-//<index_tests>
-//A commercially available galactomannan sandwich ELISA (Platelia©) was the test under evaluation. We only included studies concerning galactomannan detection in serum. We excluded studies addressing detection in BAL fluid, a number of other body fluids, such as CSF or peritoneal fluid, and tissue. We also excluded studies evaluating in-house serum galactomannan tests.</index_tests>
-//<target_conditions>
-//The target condition of this review was invasive aspergillosis, also called invasive pulmonary aspergillosis or systemic aspergillosis.</target_conditions>
-//<reference_standards>
-//The following reference standards can be used to define the target condition:
-//autopsy;
-//the criteria of the EORTC/MSG (Ascioglu 2002; De Pauw 2008); or
-//the demonstration of hyphal invasion in biopsies, combined with a positive culture for Aspergillus species from the same specimens.
-//The gold standard for this diagnosis is autopsy, combined with a positive culture of Aspergillus species from the autopsy specimens, or with histopathological evidence of Aspergillus. Autopsy is rarely reported, therefore we decided to take the criteria of the EORTC/MSG as the reference standard. These criteria divide the patient population into four categories: patients with proven invasive aspergillosis, patients who probably have invasive aspergillosis, patients who possibly have invasive aspergillosis and patients without invasive aspergillosis (see Table 1). This division is based on host factor criteria, microbiological criteria and clinical criteria. Clinical studies have shown that these criteria do not match autopsy results perfectly. This especially true for the possible category. For clinical trials investigating the effect of treatment, for example, it is recommended that only the proven and probable categories are used (Borlenghi 2007; Subira 2003).
-//The exclusion of patients with 'possible' invasive aspergillosis, which can be regarded as group of 'difficult or atypical' patients, is likely to affect the observed diagnostic accuracy of a test. Also, the exclusion of any other of the reference standard groups may affect the accuracy of the index test. We therefore excluded studies explicitly excluding one of the four categories of patients from the review, as well as studies in which it is not clear how many patients with proven, probable, possible or no invasive aspergillosis had positive or negative index test results.</reference_standards>
-//</root>
-// ```
+//	<root>
+//	<objective>...</objective>
+//	<type_of_study>...</type_of_study>
+//	<participants>...</participants>
+//	<index_tests>...</index_tests>
+//	<target_conditions>...</target_conditions>
+//	<reference_standards>...</reference_standards>
+//	</root>
 //
-// The source then generates queries according to the package github.com/hscells/groove/learning/seed.
-type ProtocolQuerySource struct {
+// The root element may have any name, and may also contain any of the other sections of a Protocol.
+func ParseProtocolXML(source []byte) (Protocol, error) {
+	var p Protocol
+	err := xml.Unmarshal(source, &p)
+	return p, err
 }
 
-// QuickUMLSProtocolQuerySource uses QuickUMLS to perform additional steps in the query formulation process.
-type QuickUMLSProtocolQuerySource struct {
-	threshold float64
-	url       string
-	ss        stats.StatisticsSource
+// ParseProtocolJSON parses a protocol in JSON, where the keys are the same as the elements of the XML format (e.g.
+// {"title": "...", "objective": "...", "participants": "..."}).
+func ParseProtocolJSON(source []byte) (Protocol, error) {
+	var p Protocol
+	err := json.Unmarshal(source, &p)
+	return p, err
 }
 
-// protocol is a representation of a systematic review protocol in XML.
-type protocol struct {
-	Objective          string `xml:"objective"`
-	TypeOfStudy        string `xml:"type_of_study"`
-	Participants       string `xml:"participants"`
-	IndexTests         string `xml:"index_tests"`
-	TargetConditions   string `xml:"target_conditions"`
-	ReferenceStandards string `xml:"reference_standards"`
+// protocolHeadings maps the headings of PROSPERO-like protocols (and common alternatives) to sections.
+var protocolHeadings = map[string]string{
+	"topic":                             "topic",
+	"review id":                         "topic",
+	"title":                             "title",
+	"review title":                      "title",
+	"objective":                         "objective",
+	"objectives":                        "objective",
+	"review question":                   "objective",
+	"review question(s)":                "objective",
+	"type of study":                     TypeOfStudySection,
+	"types of study":                    TypeOfStudySection,
+	"types of studies":                  TypeOfStudySection,
+	"types of study to be included":     TypeOfStudySection,
+	"participants":                      ParticipantsSection,
+	"population":                        ParticipantsSection,
+	"participants/population":           ParticipantsSection,
+	"index test":                        IndexTestsSection,
+	"index tests":                       IndexTestsSection,
+	"index test(s)":                     IndexTestsSection,
+	"target condition":                  TargetConditionsSection,
+	"target conditions":                 TargetConditionsSection,
+	"target condition(s)":               TargetConditionsSection,
+	"condition or domain being studied": TargetConditionsSection,
+	"reference standard":                ReferenceStandardsSection,
+	"reference standards":               ReferenceStandardsSection,
+	"reference standard(s)":             ReferenceStandardsSection,
+	"interventions":                     InterventionsSection,
+	"intervention(s), exposure(s)":      InterventionsSection,
+	"intervention(s)":                   InterventionsSection,
+	"exposure(s)":                       InterventionsSection,
+	"comparators":                       ComparatorsSection,
+	"comparator(s)/control":             ComparatorsSection,
+	"comparator(s)":                     ComparatorsSection,
+	"control":                           ComparatorsSection,
+	"outcomes":                          OutcomesSection,
+	"main outcome(s)":                   OutcomesSection,
+	"additional outcome(s)":             OutcomesSection,
+	"primary outcome(s)":                OutcomesSection,
+	"secondary outcome(s)":              OutcomesSection,
+	"context":                           ContextSection,
 }
 
-func (ProtocolQuerySource) Load(directory string) ([]pipeline.Query, error) {
-	// First, get a list of files in the directory.
-	files, err := ioutil.ReadDir(directory)
-	if err != nil {
-		return nil, err
+// headingNumber matches the numbering of a heading (e.g. "12. " or "* ").
+var headingNumber = regexp.MustCompile(`^(\d+[.)]?|[*-])\s+`)
+
+// protocolHeading determines if a line starts with a heading, returning the section of the heading and any text
+// that follows the heading on the same line.
+func protocolHeading(line string) (string, string, bool) {
+	l := headingNumber.ReplaceAllString(strings.TrimSpace(line), "")
+	heading, rest := l, ""
+	if i := strings.Index(l, ":"); i >= 0 {
+		heading, rest = l[:i], l[i+1:]
 	}
+	section, ok := protocolHeadings[strings.ToLower(strings.TrimSpace(heading))]
+	return section, strings.TrimSpace(rest), ok
+}
 
-	// Next, read all files, generating queries for each file.
-	var queries []pipeline.Query
-	for _, f := range files {
-		if f.IsDir() {
-			continue
+// ParseProtocolText parses a protocol in PROSPERO-like structured text, where each section starts with a heading
+// on its own line (or followed by a colon and the start of the section), e.g.:
+//
+//	Review title
+//	Galactomannan detection for invasive aspergillosis in immunocompromised patients
+//	Review question: What is the diagnostic accuracy of galactomannan detection in serum?
+//	Condition or domain being studied
+//	Invasive aspergillosis.
+//	Participants/population
+//	Immunocompromised patients.
+//
+// Headings may be numbered, and are matched ignoring case. Text under unknown headings belongs to the preceding
+// section. Sections that appear more than once (e.g. main and additional outcomes) are combined.
+func ParseProtocolText(source []byte) (Protocol, error) {
+	sections := make(map[string][]string)
+	current := ""
+	for _, line := range strings.Split(string(source), "\n") {
+		if section, rest, ok := protocolHeading(line); ok {
+			current = section
+			line = rest
 		}
-
-		if len(f.Name()) == 0 {
-			continue
+		if len(current) > 0 && len(strings.TrimSpace(line)) > 0 {
+			sections[current] = append(sections[current], strings.TrimSpace(line))
 		}
+	}
+	if len(sections) == 0 {
+		return Protocol{}, fmt.Errorf("protocol contains no known headings")
+	}
 
-		source, err := ioutil.ReadFile(directory + "/" + f.Name())
-		if err != nil {
-			return nil, err
-		}
+	s := func(name string) string {
+		return strings.Join(sections[name], "\n")
+	}
+	return Protocol{
+		Topic:              s("topic"),
+		Title:              s("title"),
+		Objective:          s("objective"),
+		TypeOfStudy:        s(TypeOfStudySection),
+		Participants:       s(ParticipantsSection),
+		IndexTests:         s(IndexTestsSection),
+		TargetConditions:   s(TargetConditionsSection),
+		ReferenceStandards: s(ReferenceStandardsSection),
+		Interventions:      s(InterventionsSection),
+		Comparators:        s(ComparatorsSection),
+		Outcomes:           s(OutcomesSection),
+		Context:            s(ContextSection),
+	}, nil
+}
+
+// ParseProtocol parses a protocol in XML, JSON, or PROSPERO-like text. The format is determined by the extension
+// of the name (.xml, .json, or anything else for text), or when there is no extension, by the first character of
+// the source. The topic of the protocol is inferred from the name when the protocol does not contain one.
+func ParseProtocol(name string, source []byte) (Protocol, error) {
+	var (
+		p   Protocol
+		err error
+	)
+	ext := strings.ToLower(path.Ext(filepath.ToSlash(name)))
+	trimmed := bytes.TrimSpace(source)
+	switch {
+	case ext == ".xml" || (len(ext) == 0 && bytes.HasPrefix(trimmed, []byte("<"))):
+		p, err = ParseProtocolXML(source)
+	case ext == ".json" || (len(ext) == 0 && bytes.HasPrefix(trimmed, []byte("{"))):
+		p, err = ParseProtocolJSON(source)
+	default:
+		p, err = ParseProtocolText(source)
+	}
+	if err != nil {
+		return p, err
+	}
 
-		var p protocol
-		err = xml.Unmarshal(source, &p)
+	p.Topic = strings.TrimSpace(p.Topic)
+	if len(p.Topic) == 0 {
+		t, err := inferTopic(name)
 		if err != nil {
-			return nil, err
+			return p, err
 		}
+		p.Topic = strings.TrimSuffix(t, path.Ext(t))
 	}
-	return queries, nil
+	return p, nil
 }
 
-func NewProtocolQuerySource() ProtocolQuerySource {
-	return ProtocolQuerySource{}
+// ProtocolQuerySource loads systematic review protocols (see ParseProtocol) and formulates a query for each
+// protocol from the concepts identified in it. The population (participants and target conditions) and the
+// intervention (index tests and interventions) of the protocol each form a clause of the query, which is a
+// disjunction of the concepts identified in those sections. When no concepts are identified (or there is no
+// concept extractor), the query is a keyword query of the title (or objective) of the protocol. The title,
+// objective, and sections of the protocol are available in the metadata of the query.
+type ProtocolQuerySource struct {
+	extractor ConceptExtractor
+	fields    []string
 }
 
-func (q QuickUMLSProtocolQuerySource) Load(directory string) ([]pipeline.Query, error) {
-	// First, get a list of files in the directory.
-	files, err := ioutil.ReadDir(directory)
-	if err != nil {
-		return nil, err
+// protocolFacets are the sections of a protocol that form each clause of a query.
+var protocolFacets = [][]string{
+	{ParticipantsSection, TargetConditionsSection},
+	{IndexTestsSection, InterventionsSection},
+}
+
+// ProtocolConceptExtractor sets the concept extractor used to identify concepts in protocols (e.g. a
+// DictionaryConceptExtractor).
+func ProtocolConceptExtractor(extractor ConceptExtractor) func(*ProtocolQuerySource) {
+	return func(s *ProtocolQuerySource) {
+		s.extractor = extractor
 	}
+}
 
-	// Next, read all files, generating queries for each file.
-	var queries []pipeline.Query
-	for _, f := range files {
-		if f.IsDir() {
-			continue
-		}
+// ProtocolFields sets the fields that keywords in queries formulated from protocols search (title and abstract by
+// default).
+func ProtocolFields(f ...string) func(*ProtocolQuerySource) {
+	return func(s *ProtocolQuerySource) {
+		s.fields = f
+	}
+}
 
-		if len(f.Name()) == 0 {
-			continue
-		}
+// Formulate formulates a query from a protocol.
+func (s ProtocolQuerySource) Formulate(p Protocol) (pipeline.Query, error) {
+	sections := p.Sections()
 
-		source, err := ioutil.ReadFile(directory + "/" + f.Name())
-		if err != nil {
-			return nil, err
+	var clauses []cqr.CommonQueryRepresentation
+	if s.extractor != nil {
+		for _, facet := range protocolFacets {
+			var (
+				keywords []cqr.CommonQueryRepresentation
+				seen     = make(map[string]bool)
+			)
+			for _, section := range facet {
+				text, ok := sections[section]
+				if !ok {
+					continue
+				}
+				concepts, err := s.extractor.Extract(text)
+				if err != nil {
+					return pipeline.Query{}, err
+				}
+				for _, c := range concepts {
+					for _, term := range []string{c.Text, c.Preferred} {
+						term = strings.ToLower(strings.TrimSpace(term))
+						if len(term) == 0 || seen[term] {
+							continue
+						}
+						seen[term] = true
+						keywords = append(keywords, cqr.NewKeyword(term, s.fields...).SetOption(EntityOption, c.ID))
+					}
+				}
+			}
+			switch len(keywords) {
+			case 0:
+			case 1:
+				clauses = append(clauses, keywords[0])
+			default:
+				clauses = append(clauses, cqr.NewBooleanQuery(cqr.OR, keywords))
+			}
 		}
+	}
 
-		var p protocol
-		err = xml.Unmarshal(source, &p)
-		if err != nil {
-			return nil, err
+	var q cqr.CommonQueryRepresentation
+	switch len(clauses) {
+	case 0:
+		text := p.Title
+		if len(strings.TrimSpace(text)) == 0 {
+			text = p.Objective
+		}
+		text = strings.Join(strings.Fields(text), " ")
+		if len(text) == 0 {
+			return pipeline.Query{}, fmt.Errorf("no query can be formulated for protocol %s: it has no concepts, title, or objective", p.Topic)
 		}
+		q = cqr.NewKeyword(text, s.fields...)
+	case 1:
+		q = clauses[0]
+	default:
+		q = cqr.NewBooleanQuery(cqr.AND, clauses)
+	}
+
+	pq := pipeline.NewQuery(p.Topic, p.Topic, q).
+		SetMetadata(pipeline.TitleMetadata, strings.Join(strings.Fields(p.Title), " ")).
+		SetMetadata(pipeline.ObjectiveMetadata, strings.Join(strings.Fields(p.Objective), " "))
+	for section, text := range sections {
+		pq = pq.SetMetadata(pipeline.ProtocolMetadata(section), text)
+	}
+	return pq, nil
+}
+
+// parse parses a single protocol and formulates a query for it.
+func (s ProtocolQuerySource) parse(name string, source []byte) (pipeline.Query, error) {
+	p, err := ParseProtocol(name, source)
+	if err != nil {
+		return pipeline.Query{}, err
 	}
-	return queries, nil
+	return s.Formulate(p)
+}
+
+// Load loads every protocol at a location (e.g. a directory, which is read recursively) and formulates a query
+// for each. Protocols that cannot be loaded do not prevent the remaining protocols from loading; the queries that
+// were formulated are returned along with TopicErrors.
+func (s ProtocolQuerySource) Load(directory string) ([]pipeline.Query, error) {
+	return LoadLocation(directory, s.parse)
+}
+
+// NewProtocolQuerySource creates a new protocol query source. Without a concept extractor (see
+// ProtocolConceptExtractor), queries are keyword queries of the title of each protocol.
+func NewProtocolQuerySource(options ...func(*ProtocolQuerySource)) ProtocolQuerySource {
+	s := ProtocolQuerySource{
+		fields: []string{fields.TitleAbstract},
+	}
+	for _, option := range options {
+		option(&s)
+	}
+	return s
+}
+
+// QuickUMLSProtocolQuerySource uses QuickUMLS to perform additional steps in the query formulation process.
+//
+// Deprecated: QuickUMLSProtocolQuerySource does not identify concepts itself; use a ProtocolQuerySource with a
+// ConceptExtractor (e.g. a ConceptExtractorFunc that calls a QuickUMLS server, or a DictionaryConceptExtractor).
+type QuickUMLSProtocolQuerySource struct {
+	threshold float64
+	url       string
+	ss        stats.StatisticsSource
+}
+
+// Load loads protocols in the same way as a ProtocolQuerySource without a concept extractor.
+func (q QuickUMLSProtocolQuerySource) Load(directory string) ([]pipeline.Query, error) {
+	return NewProtocolQuerySource().Load(directory)
 }
 
+// Deprecated: use NewProtocolQuerySource with ProtocolConceptExtractor.
 func NewQuickUMLSProtocolQuerySource(url string, ss stats.StatisticsSource, threshold float64) QuickUMLSProtocolQuerySource {
 	return QuickUMLSProtocolQuerySource{
 		url:       url,
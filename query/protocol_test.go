@@ -0,0 +1,68 @@
+package query_test
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/query"
+	"strings"
+	"testing"
+)
+
+func TestProtocolQuerySource(t *testing.T) {
+	protocol := `Review title
+Galactomannan detection for invasive aspergillosis in immunocompromised patients
+1. Review question: What is the diagnostic accuracy of galactomannan detection in serum?
+Condition or domain being studied
+Invasive Aspergillosis.
+Participants/population
+Immunocompromised patients, e.g. after a bone marrow transplant.
+Index test(s)
+The Platelia galactomannan ELISA.
+Main outcome(s)
+Sensitivity and specificity.`
+
+	p, err := query.ParseProtocol("CD007394", []byte(protocol))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Topic != "CD007394" || p.Objective != "What is the diagnostic accuracy of galactomannan detection in serum?" || p.TargetConditions != "Invasive Aspergillosis." {
+		t.Errorf("unexpected protocol %+v", p)
+	}
+
+	dictionary, err := query.NewDictionaryConceptExtractor(strings.NewReader(`C0004030	invasive aspergillosis
+C0004030	aspergillosis, invasive
+C0021081	immunocompromised patient
+C0021081	immunocompromised patients
+C0005961	bone marrow transplant
+C0060359	galactomannan`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := query.NewProtocolQuerySource(query.ProtocolConceptExtractor(dictionary)).Formulate(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bq, ok := q.Query.(cqr.BooleanQuery)
+	if !ok || bq.Operator != cqr.AND || len(bq.Children) != 2 {
+		t.Fatalf("expected a conjunction of population and intervention, got %v", q.Query)
+	}
+	population := bq.Children[0].(cqr.BooleanQuery)
+	if len(population.Children) != 4 {
+		t.Errorf("expected four population keywords, got %v", population)
+	}
+	if k := bq.Children[1].(cqr.Keyword); k.QueryString != "galactomannan" || k.Options[query.EntityOption] != "C0060359" {
+		t.Errorf("unexpected intervention %v", k)
+	}
+	if q.Title() == "" || q.Protocol(query.OutcomesSection) != "Sensitivity and specificity." {
+		t.Errorf("unexpected metadata %v", q.Metadata)
+	}
+
+	// Without a concept extractor, the query is the title.
+	q, err = query.NewProtocolQuerySource().Formulate(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k, ok := q.Query.(cqr.Keyword); !ok || !strings.HasPrefix(k.QueryString, "Galactomannan detection") {
+		t.Errorf("expected a keyword query of the title, got %v", q.Query)
+	}
+}
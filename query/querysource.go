@@ -6,5 +6,7 @@ import "github.com/hscells/groove/pipeline"
 // QueriesSource represents a source for queries and how to parse them.
 type QueriesSource interface {
 	// Load determines how a query is loaded and parsed into the common query representation format.
+	// Queries may be loaded from any location understood by ReadLocation (a directory, file, glob,
+	// archive, JSON Lines, or standard input).
 	Load(directory string) ([]pipeline.Query, error)
 }
@@ -15,15 +15,21 @@ import (
 	"strings"
 )
 
+// TARTask2QueriesSource loads topics from the CLEF TAR 2018 task 2.
+//
+// Deprecated: use CLEFTARQuerySource, which supports the topics from every year.
 type TARTask2QueriesSource struct {
 }
 
-func (TARTask2QueriesSource) LoadSingle(file string) (pipeline.Query, error) {
+func (t TARTask2QueriesSource) LoadSingle(file string) (pipeline.Query, error) {
 	source, err := ioutil.ReadFile(file)
 	if err != nil {
 		return pipeline.Query{}, err
 	}
+	return t.parse(file, source)
+}
 
+func (TARTask2QueriesSource) parse(_ string, source []byte) (pipeline.Query, error) {
 	s := bufio.NewScanner(bytes.NewBuffer(source))
 	n := 0
 	lines := 0
@@ -72,30 +78,7 @@ func (TARTask2QueriesSource) LoadSingle(file string) (pipeline.Query, error) {
 }
 
 func (t TARTask2QueriesSource) Load(directory string) ([]pipeline.Query, error) {
-	// First, get a list of files in the directory.
-	files, err := ioutil.ReadDir(directory)
-	if err != nil {
-		return nil, err
-	}
-
-	// Next, read all files, generating queries for each file.
-	var queries []pipeline.Query
-	for _, f := range files {
-		if f.IsDir() {
-			continue
-		}
-
-		if len(f.Name()) == 0 {
-			continue
-		}
-		q, err := t.LoadSingle(path.Join(directory, f.Name()))
-		if err != nil {
-			return nil, err
-		}
-
-		queries = append(queries, q)
-	}
-	return queries, nil
+	return LoadLocation(directory, t.parse)
 }
 
 func simplifyOriginal(query cqr.CommonQueryRepresentation) cqr.CommonQueryRepresentation {
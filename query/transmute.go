@@ -1,7 +1,6 @@
 package query
 
 import (
-	"errors"
 	"github.com/hscells/cqr"
 	gpipeline "github.com/hscells/groove/pipeline"
 	"github.com/hscells/transmute/backend"
@@ -10,7 +9,6 @@ import (
 	tpipeline "github.com/hscells/transmute/pipeline"
 	"io/ioutil"
 	"log"
-	"path"
 )
 
 var (
@@ -54,20 +52,16 @@ type TransmuteQuerySource struct {
 	queries  []gpipeline.Query
 }
 
-func (ts TransmuteQuerySource) LoadSingle(file string) (gpipeline.Query, error) {
-	dir, topic := path.Split(file)
-	if len(dir) == 0 {
-		return gpipeline.Query{}, errors.New("query topic cannot be inferred from pathname")
-	}
-
-	source, err := ioutil.ReadFile(file)
+// parse parses the source of a query using the transmute pipeline. The topic is the name of the file.
+func (ts TransmuteQuerySource) parse(name string, source []byte) (gpipeline.Query, error) {
+	t, err := inferTopic(name)
 	if err != nil {
 		return gpipeline.Query{}, err
 	}
 
 	bq, err := ts.pipeline.Execute(string(source))
 	if err != nil {
-		log.Printf("transmute error in topic %s\n", topic)
+		log.Printf("transmute error in topic %s\n", t)
 		return gpipeline.Query{}, err
 	}
 
@@ -75,36 +69,22 @@ func (ts TransmuteQuerySource) LoadSingle(file string) (gpipeline.Query, error)
 	if err != nil {
 		return gpipeline.Query{}, err
 	}
-	return gpipeline.NewQuery(topic, topic, repr.(cqr.CommonQueryRepresentation)), nil
+	return gpipeline.NewQuery(t, t, repr.(cqr.CommonQueryRepresentation)).
+		SetMetadata(gpipeline.OriginalQueryMetadata, string(source)), nil
 }
 
-// Load takes a directory of queries and parses them using a supplied transmute gpipeline.
-func (ts TransmuteQuerySource) Load(directory string) ([]gpipeline.Query, error) {
-	// First, get a list of files in the directory.
-	files, err := ioutil.ReadDir(directory)
+// LoadSingle loads a single query from a file.
+func (ts TransmuteQuerySource) LoadSingle(file string) (gpipeline.Query, error) {
+	source, err := ioutil.ReadFile(file)
 	if err != nil {
-		return nil, err
-	}
-
-	// Next, use the transmute gpipeline to parse them.
-	queries := make([]gpipeline.Query, len(files))
-	for i, f := range files {
-		if f.IsDir() {
-			continue
-		}
-
-		if len(f.Name()) == 0 {
-			continue
-		}
-
-		queries[i], err = ts.LoadSingle(path.Join(directory, f.Name()))
-		if err != nil {
-			return nil, err
-		}
+		return gpipeline.Query{}, err
 	}
+	return ts.parse(file, source)
+}
 
-	// Finally, return the parsed queries.
-	return queries, nil
+// Load takes a location of queries and parses them using a supplied transmute gpipeline.
+func (ts TransmuteQuerySource) Load(directory string) ([]gpipeline.Query, error) {
+	return LoadLocation(directory, ts.parse)
 }
 
 // NewTransmuteQuerySource creates a new query source from a transmute gpipeline.
@@ -54,7 +54,7 @@ func clf(query pipeline.Query, posting *Posting, e stats.EntrezStatisticsSource,
 
 		for i, c := range q.Children {
 			var err error
-			r[i], err = clf(pipeline.NewQuery(query.Name, query.Topic, c), posting, e, options)
+			r[i], err = clf(query.WithQuery(c), posting, e, options)
 			if err != nil {
 				return nil, err
 			}
@@ -262,7 +262,7 @@ func clm(query pipeline.Query, posting *Posting, e stats.EntrezStatisticsSource)
 		lists := make([]merging.Items, len(r))
 		for i, child := range q.Children {
 			var err error
-			r[i], err = clm(pipeline.NewQuery(query.Name, query.Topic, child), posting, e)
+			r[i], err = clm(query.WithQuery(child), posting, e)
 			if err != nil {
 				return nil, err
 			}
@@ -480,13 +480,15 @@ func writeResults(list trecresults.ResultList, dir string) error {
 	return nil
 }
 
-func clfVariations(query cqr.CommonQueryRepresentation, topic string, e stats.EntrezStatisticsSource, options CLFOptions) error {
+func clfVariations(query pipeline.Query, e stats.EntrezStatisticsSource, options CLFOptions) error {
+	topic := query.Topic
 	learning.ComputeFeatures = false
 	candidates, err := learning.Variations(learning.CandidateQuery{
 		TransformationID: -1,
 		Topic:            topic,
-		Query:            query,
+		Query:            query.Query,
 		Chain:            nil,
+		Metadata:         query.Metadata,
 	}, e, analysis.NewMemoryMeasurementExecutor(), nil,
 		learning.NewLogicalOperatorTransformer(),
 		learning.NewFieldRestrictionsTransformer(),
@@ -509,7 +511,7 @@ func clfVariations(query cqr.CommonQueryRepresentation, topic string, e stats.En
 	if err != nil {
 		return err
 	}
-	N, err := e.RetrievalSize(query)
+	N, err := stats.RetrievalSize(e, query)
 	if err != nil {
 		return err
 	}
@@ -520,7 +522,7 @@ func clfVariations(query cqr.CommonQueryRepresentation, topic string, e stats.En
 	for i, candidate := range candidates {
 	r:
 		// Skip this candidate if it retrieves more than the original query.
-		n, err := e.RetrievalSize(candidate.Query)
+		n, err := stats.RetrievalSize(e, candidate.PipelineQuery())
 		if err != nil {
 			fmt.Println(err)
 			goto r
@@ -685,6 +687,7 @@ type CLFOptions struct {
 	mapping          cui2vec.Mapping
 	quickumlscache   quickumlsrest.Cache
 
+	// Titles is a directory of topic titles, used when the title is not in the metadata of a query.
 	Titles  string `json:"titles"`
 	Headway *headway.Client
 }
@@ -733,13 +736,18 @@ func CLF(query pipeline.Query, e stats.EntrezStatisticsSource, options CLFOption
 			cqr.NewKeyword("accuracy", fields.TitleAbstract),
 		}))
 
-		title, err := ioutil.ReadFile(path.Join(options.Titles, query.Topic))
-		if err != nil {
-			return nil, err
+		// Prefer the title in the metadata of the query, and only fall back to the titles directory.
+		title := query.Title()
+		if len(title) == 0 {
+			b, err := ioutil.ReadFile(path.Join(options.Titles, query.Topic))
+			if err != nil {
+				return nil, err
+			}
+			title = string(b)
 		}
-		fmt.Println(string(title))
+		fmt.Println(title)
 
-		titleParsed, err := prose.NewDocument(stopwords.CleanString(string(title), "en", false), prose.WithTagging(false), prose.WithExtraction(false), prose.WithSegmentation(false))
+		titleParsed, err := prose.NewDocument(stopwords.CleanString(title, "en", false), prose.WithTagging(false), prose.WithExtraction(false), prose.WithSegmentation(false))
 		if err != nil {
 			return nil, err
 		}
@@ -786,7 +794,7 @@ func CLF(query pipeline.Query, e stats.EntrezStatisticsSource, options CLFOption
 			//if err != nil {
 			//	return nil, err
 			//}
-			return nil, clfVariations(query.Query, query.Topic, e, options)
+			return nil, clfVariations(query, e, options)
 		} else {
 			fmt.Printf("skipping topic %s, already exists\n", query.Topic)
 		}
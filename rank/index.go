@@ -2,6 +2,7 @@ package rank
 
 import (
 	"fmt"
+	"github.com/hscells/groove/preprocess/analyser"
 	"github.com/hscells/guru"
 	"gopkg.in/cheggaaa/pb.v1"
 	"gopkg.in/jdkato/prose.v2"
@@ -25,7 +26,42 @@ type Posting struct {
 	TermIdx   map[uint32]int
 	MaxDocLen float64
 
-	dvCache map[uint32][]float64
+	dvCache  map[uint32][]float64
+	analyser *analyser.Analyser
+}
+
+// IndexAnalyser analyses the titles and abstracts of documents with an analyser when they are indexed, and the
+// terms used to look up statistics in the posting, so that documents and queries are analysed the same way. By
+// default, text is tokenised with prose and lowercased. The analyser is not encoded with the posting, so it must be
+// set again on postings that are decoded (see RunnerAnalyser).
+func IndexAnalyser(a analyser.Analyser) func(*Posting) {
+	return func(p *Posting) {
+		p.analyser = &a
+	}
+}
+
+// tokens splits the text of a document into tokens.
+func (p *Posting) tokens(text string) ([]string, error) {
+	if p.analyser != nil {
+		return p.analyser.Analyse(text), nil
+	}
+	doc, err := prose.NewDocument(strings.ToLower(text), prose.WithTagging(false), prose.WithExtraction(false), prose.WithSegmentation(false))
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]string, len(doc.Tokens()))
+	for i, tok := range doc.Tokens() {
+		tokens[i] = tok.Text
+	}
+	return tokens, nil
+}
+
+// term hashes a term of a field, analysing the term in the same way as documents. MeSH headings are not analysed.
+func (p *Posting) term(term, field string) uint32 {
+	if p.analyser != nil && field != "mh" {
+		term = strings.Join(p.analyser.Analyse(term), " ")
+	}
+	return hash(term)
 }
 
 var (
@@ -49,7 +85,12 @@ func hash(s string) uint32 {
 	return H.Sum32()
 }
 
-func Index(documents guru.MedlineDocuments) (*Posting, error) {
+func Index(documents guru.MedlineDocuments, options ...func(*Posting)) (*Posting, error) {
+	p := &Posting{}
+	for _, option := range options {
+		option(p)
+	}
+
 	ii := make(map[uint32]map[uint32]map[uint32]Statistics)
 	dl := make(map[string]map[uint32]float64, len(documents))
 	da := make(map[uint32]int64, len(documents))
@@ -76,27 +117,25 @@ func Index(documents guru.MedlineDocuments) (*Posting, error) {
 
 		dl[pmid] = make(map[uint32]float64)
 
-		tiLower := strings.ToLower(doc.TI)
 		abLower := strings.ToLower(doc.AB)
 
 		// Extract tokens for the title and abstract.
-		ti, err := prose.NewDocument(tiLower, prose.WithTagging(false), prose.WithExtraction(false), prose.WithSegmentation(false))
+		ti, err := p.tokens(doc.TI)
 		if err != nil {
 			return nil, err
 		}
-		dl[pmid][TI] = float64(len(ti.Tokens()))
+		dl[pmid][TI] = float64(len(ti))
 
 		ab, err := prose.NewDocument(abLower, prose.WithTagging(false), prose.WithExtraction(false), prose.WithSegmentation(false))
 		if err != nil {
 			return nil, err
 		}
-		dl[pmid][AB] = float64(len(ab.Tokens()))
 
 		// Compute the term frequency values for the title.
 		tiTf := make(map[uint32]float64)
 		tiPos := make(map[uint32]float64)
-		for i, tok := range ti.Tokens() {
-			t := hash(tok.Text)
+		for i, tok := range ti {
+			t := hash(tok)
 			if _, ok := ii[t]; !ok {
 				ii[t] = make(map[uint32]map[uint32]Statistics)
 				ii[t][TI] = make(map[uint32]Statistics)
@@ -105,20 +144,22 @@ func Index(documents guru.MedlineDocuments) (*Posting, error) {
 			}
 			tiTf[t]++
 			if _, ok := tiPos[t]; !ok {
-				tiPos[t] = 1 + (1 - (float64(i) / float64(len(ti.Tokens()))))
+				tiPos[t] = 1 + (1 - (float64(i) / float64(len(ti))))
 			}
 		}
 
-		// Compute the term frequency values for the abstract.
+		// Compute the term frequency values for the abstract. The length of the abstract is the number of tokens the
+		// term frequencies are counted from, so that both are computed by the same analyser.
 		abTf := make(map[uint32]float64)
 		abPos := make(map[uint32]float64)
 		for i, sent := range ab.Sentences() {
-			toks, err := prose.NewDocument(strings.ToLower(sent.Text), prose.WithTagging(false), prose.WithExtraction(false), prose.WithSegmentation(false))
+			toks, err := p.tokens(sent.Text)
 			if err != nil {
 				return nil, err
 			}
-			for _, tok := range toks.Tokens() {
-				t := hash(tok.Text)
+			dl[pmid][AB] += float64(len(toks))
+			for _, tok := range toks {
+				t := hash(tok)
 				if _, ok := ii[t]; !ok {
 					ii[t] = make(map[uint32]map[uint32]Statistics)
 					ii[t][TI] = make(map[uint32]Statistics)
@@ -186,13 +227,12 @@ func Index(documents guru.MedlineDocuments) (*Posting, error) {
 		i++
 	}
 
-	return &Posting{
-		Index:     ii,
-		DocLens:   dl,
-		MaxDocLen: maxL,
-		TermIdx:   tm,
-		DocDates:  da,
-	}, nil
+	p.Index = ii
+	p.DocLens = dl
+	p.MaxDocLen = maxL
+	p.TermIdx = tm
+	p.DocDates = da
+	return p, nil
 }
 
 func (p *Posting) DocumentVector(pmid uint32) []float64 {
@@ -263,7 +303,7 @@ func (p *Posting) Tf(term, field, pmid string) float64 {
 	//}
 	//
 	//return tf
-	t := hash(term)
+	t := p.term(term, field)
 	f := hash(field)
 	d := hash(pmid)
 	//var pos float64
@@ -294,7 +334,7 @@ func (p *Posting) Pos(term, field, pmid string) float64 {
 	//	terms = append(terms, hash(term))
 	//}
 
-	t := hash(term)
+	t := p.term(term, field)
 	f := hash(field)
 	d := hash(pmid)
 	//var pos float64
@@ -329,7 +369,7 @@ func (p *Posting) AvgDocLen(field string) float64 {
 }
 
 func (p *Posting) TTf(term, field string) float64 {
-	t := hash(term)
+	t := p.term(term, field)
 	f := hash(term)
 	if _, ok := p.Index[t]; !ok {
 		return 0
@@ -358,7 +398,7 @@ func (p *Posting) VocabSize(field string) float64 {
 }
 
 func (p *Posting) DocumentTermProbability(term, field, pmid string) float64 {
-	t := hash(term)
+	t := p.term(term, field)
 	f := hash(term)
 	if _, ok := p.Index[t]; !ok {
 		return 0
@@ -370,7 +410,7 @@ func (p *Posting) DocumentTermProbability(term, field, pmid string) float64 {
 }
 
 func (p *Posting) CollectionTermProbability(term, field string) float64 {
-	t := hash(term)
+	t := p.term(term, field)
 	f := hash(term)
 	if _, ok := p.Index[t]; !ok {
 		return 0
@@ -382,7 +422,7 @@ func (p *Posting) CollectionTermProbability(term, field string) float64 {
 }
 
 func (p *Posting) DirichlectTermProbability(term, field, pmid string, mu float64) float64 {
-	t := hash(term)
+	t := p.term(term, field)
 	f := hash(term)
 	if _, ok := p.Index[t]; !ok {
 		return 0
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/gob"
 	"fmt"
+	"github.com/hscells/groove/preprocess/analyser"
 	"github.com/hscells/groove/stats"
 	"github.com/hscells/guru"
 	"gopkg.in/cheggaaa/pb.v1"
@@ -21,11 +22,31 @@ type Runner struct {
 	fields  []string
 	stats.EntrezStatisticsSource
 	scorer Scorer
+
+	analyser     *analyser.Analyser
+	analyserName string
+}
+
+// RunnerAnalyser analyses documents and queries with an analyser (see IndexAnalyser). Analysers are not cached with
+// indexes, so the name of the analyser is used to tell cached indexes of different analysers apart.
+func RunnerAnalyser(name string, a analyser.Analyser) func(*Runner) {
+	return func(r *Runner) {
+		r.analyser = &a
+		r.analyserName = name
+	}
+}
+
+// postingOptions are the options used to index documents and to restore the analyser of cached indexes.
+func (r Runner) postingOptions() []func(*Posting) {
+	if r.analyser == nil {
+		return nil
+	}
+	return []func(*Posting){IndexAnalyser(*r.analyser)}
 }
 
 var docCache = make(map[int]guru.MedlineDocument)
 
-func index(pmids []int, e stats.EntrezStatisticsSource) (*Posting, error) {
+func index(pmids []int, e stats.EntrezStatisticsSource, options ...func(*Posting)) (*Posting, error) {
 	var docs guru.MedlineDocuments
 	sem := make(chan bool, 1)
 	n := 300
@@ -81,7 +102,7 @@ func index(pmids []int, e stats.EntrezStatisticsSource) (*Posting, error) {
 
 	fmt.Printf("added %d docs to cache\n", addedDocs)
 
-	return Index(docs)
+	return Index(docs, options...)
 }
 
 func newPostingFromPMIDS(pmids []int, topic string, indexPath string, e stats.EntrezStatisticsSource) (*Posting, error) {
@@ -117,9 +138,15 @@ func newPostingFromPMIDS(pmids []int, topic string, indexPath string, e stats.En
 	return posting, nil
 }
 
-func newPosting(query, indexPath string, e stats.EntrezStatisticsSource) (*Posting, error) {
+// newPosting creates a posting for the documents retrieved by a query, or loads it from the cache. The name of the
+// analyser is part of the cache key, and since analysers cannot be encoded, the options are applied again to postings
+// loaded from the cache.
+func newPosting(query, indexPath string, e stats.EntrezStatisticsSource, analyserName string, options ...func(*Posting)) (*Posting, error) {
 	h := sha256.New()
 	h.Write([]byte(query))
+	if len(analyserName) > 0 {
+		h.Write([]byte("\x00" + analyserName))
+	}
 	id := fmt.Sprintf("%x", h.Sum(nil))
 
 	cachePath := path.Join(indexPath, id)
@@ -135,13 +162,19 @@ func newPosting(query, indexPath string, e stats.EntrezStatisticsSource) (*Posti
 		if err != nil {
 			return nil, err
 		}
+		for _, option := range options {
+			option(posting)
+		}
 	} else {
 		p, err := e.Search(query)
 		if err != nil {
 			return nil, err
 		}
 
-		posting, err := index(p, e)
+		posting, err = index(p, e, options...)
+		if err != nil {
+			return nil, err
+		}
 
 		fmt.Printf("caching a copy using id %s\n", id)
 		err = os.MkdirAll(indexPath, 0777)
@@ -172,7 +205,7 @@ func (r Runner) run(done chan bool, scoredc chan ScoredDocuments, errc chan erro
 	indexPath := path.Join(cd, r.cache)
 
 	for _, query := range r.queries {
-		posting, err := newPosting(query, indexPath, r.EntrezStatisticsSource)
+		posting, err := newPosting(query, indexPath, r.EntrezStatisticsSource, r.analyserName, r.postingOptions()...)
 		if err != nil {
 			errc <- err
 			return
@@ -254,12 +287,16 @@ func (r Runner) Run() ([]ScoredDocuments, error) {
 	return docs, nil
 }
 
-func NewRunner(cache string, queries, fields []string, e stats.EntrezStatisticsSource, scorer Scorer) Runner {
-	return Runner{
+func NewRunner(cache string, queries, fields []string, e stats.EntrezStatisticsSource, scorer Scorer, options ...func(*Runner)) Runner {
+	r := Runner{
 		cache:                  cache,
 		queries:                queries,
 		fields:                 fields,
 		EntrezStatisticsSource: e,
 		scorer:                 scorer,
 	}
+	for _, option := range options {
+		option(&r)
+	}
+	return r
 }
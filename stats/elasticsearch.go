@@ -228,8 +228,14 @@ func (es *ElasticsearchStatisticsSource) TermVector(document string) (TermVector
 // ExecuteFast executes an Elasticsearch query and retrieves only the document ids in the fastest possible way. Do not
 // use this for ranked results as the concurrency of this method does not guarantee order.
 func (es *ElasticsearchStatisticsSource) ExecuteFast(query gpipeline.Query, options SearchOptions) ([]uint32, error) {
+	// Restrict the query to its publication dates.
+	restricted, err := query.Restricted()
+	if err != nil {
+		return nil, err
+	}
+
 	// Transform the query to an Elasticsearch query.
-	q, err := toElasticsearch(query.Query)
+	q, err := toElasticsearch(restricted)
 	if err != nil {
 		return nil, err
 	}
@@ -318,8 +324,14 @@ func (es *ElasticsearchStatisticsSource) ExecuteFast(query gpipeline.Query, opti
 
 // Execute runs the query on Elasticsearch and returns results in trec format.
 func (es *ElasticsearchStatisticsSource) Execute(query gpipeline.Query, options SearchOptions) (trecresults.ResultList, error) {
+	// Restrict the query to its publication dates.
+	restricted, err := query.Restricted()
+	if err != nil {
+		return nil, err
+	}
+
 	// Transform the query to an Elasticsearch query.
-	q, err := toElasticsearch(query.Query)
+	q, err := toElasticsearch(restricted)
 	if err != nil {
 		return nil, err
 	}
@@ -413,7 +425,12 @@ func (es *ElasticsearchStatisticsSource) CollectionSize() (float64, error) {
 
 // Analyse is a specific Elasticsearch method used in the analyse transformation.
 func (es *ElasticsearchStatisticsSource) Analyse(text, analyser string) (tokens []string, err error) {
-	res, err := es.client.IndexAnalyze().Index(es.index).Analyzer(analyser).Text(text).Do(context.Background())
+	return es.AnalyseContext(context.Background(), text, analyser)
+}
+
+// AnalyseContext is the same as Analyse, but the request to Elasticsearch is cancelled with the context.
+func (es *ElasticsearchStatisticsSource) AnalyseContext(ctx context.Context, text, analyser string) (tokens []string, err error) {
+	res, err := es.client.IndexAnalyze().Index(es.index).Analyzer(analyser).Text(text).Do(ctx)
 	if err != nil {
 		return
 	}
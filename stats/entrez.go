@@ -11,6 +11,7 @@ import (
 	"github.com/hscells/guru"
 	"github.com/hscells/transmute"
 	"github.com/hscells/transmute/backend"
+	"github.com/hscells/transmute/fields"
 	"github.com/hscells/trecresults"
 	"github.com/mailru/easyjson"
 	"gopkg.in/jdkato/prose.v2"
@@ -87,6 +88,28 @@ type Search struct {
 	Count int `xml:"Count"`
 }
 
+// PubMedFields are the fields that can be searched in PubMed.
+var PubMedFields = []string{
+	fields.Title,
+	fields.Abstract,
+	fields.TitleAbstract,
+	fields.TextWord,
+	fields.AllFields,
+	fields.MeshHeadings,
+	fields.MeSHTerms,
+	fields.MeSHSubheading,
+	fields.MeSHMajorTopic,
+	fields.FloatingMeshHeadings,
+	fields.MajorFocusMeshHeading,
+	fields.PublicationType,
+	fields.PublicationDate,
+}
+
+// Fields are the fields that can be searched using Entrez.
+func (e EntrezStatisticsSource) Fields() []string {
+	return PubMedFields
+}
+
 func (e EntrezStatisticsSource) SetDB(db string) EntrezStatisticsSource {
 	e.db = db
 	return e
@@ -520,8 +543,14 @@ func (e EntrezStatisticsSource) VocabularySize(field string) (float64, error) {
 }
 
 func (e EntrezStatisticsSource) Execute(query pipeline.Query, options SearchOptions) (trecresults.ResultList, error) {
+	// Restrict the query to its publication dates.
+	restricted, err := query.Restricted()
+	if err != nil {
+		return nil, err
+	}
+
 	// First we need to transform the query into a PubMed query (suitable for entrez)
-	d, err := backend.NewCQRQuery(query.Query).String()
+	d, err := backend.NewCQRQuery(restricted).String()
 	if err != nil {
 		return nil, err
 	}
@@ -48,6 +48,35 @@ type StatisticsSource interface {
 	CollectionSize() (float64, error)
 }
 
+// FieldedStatisticsSource is a statistics source that can only search certain fields.
+type FieldedStatisticsSource interface {
+	StatisticsSource
+	Fields() []string
+}
+
+// Unwrap is the statistics source that a statistics source wraps (e.g. to share the documents that queries retrieve),
+// or the statistics source itself if it does not wrap another. Use it before asserting the type of a statistics
+// source.
+func Unwrap(ss StatisticsSource) StatisticsSource {
+	for {
+		w, ok := ss.(interface{ Unwrap() StatisticsSource })
+		if !ok {
+			return ss
+		}
+		ss = w.Unwrap()
+	}
+}
+
+// RetrievalSize is the number of documents a query retrieves, restricted to the publication dates of the query (if
+// it has a date restriction).
+func RetrievalSize(ss StatisticsSource, query pipeline.Query) (float64, error) {
+	q, err := query.Restricted()
+	if err != nil {
+		return 0, err
+	}
+	return ss.RetrievalSize(q)
+}
+
 // ToPipelineQuery creates a pipeline query from a term vector. This can be used to perform analysis on documents (since
 // the term vector is a representation of a document).
 func (tv TermVector) ToPipelineQuery(topic, name string) pipeline.Query {
@@ -68,7 +97,7 @@ func GetDocumentIDs(query pipeline.Query, ss StatisticsSource) ([]uint32, error)
 	var docs []uint32
 
 	// Elasticsearch has a "fast" execute to scroll quickly so we can account for that here.
-	switch x := ss.(type) {
+	switch x := Unwrap(ss).(type) {
 	case *ElasticsearchStatisticsSource:
 		ids, err := x.ExecuteFast(query, x.SearchOptions())
 		if err != nil {
@@ -159,8 +159,14 @@ func (t TerrierStatisticsSource) Execute(query gpipeline.Query, options SearchOp
 	)
 	trecResultSet := trecresults.ResultList{}
 
+	// Restrict the query to its publication dates.
+	restricted, err := query.Restricted()
+	if err != nil {
+		return trecResultSet, err
+	}
+
 	// Grab the result set from terrier.
-	resultSet, err := execute(t.env, query.Query, options, t)
+	resultSet, err := execute(t.env, restricted, options, t)
 	if err != nil {
 		return trecResultSet, err
 	}